@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ============= 负载感知的可扩展选择器：Power-of-d-choices 与有界负载一致性哈希 =============
+
+// nodeLoad 节点负载：排队与执行中的作业数（RequestQueue只记录最近请求，稳态下各节点都会饱和）
+func nodeLoad(node *PrefillNode) float64 {
+	return float64(node.QueueLength())
+}
+
+// contiguousPrefixHits 计算节点上从请求开头起连续命中的block数
+func contiguousPrefixHits(request *Request, node *PrefillNode) int {
+	hits := 0
+	for _, hashID := range request.HashIDs {
+		if _, exists := node.CacheBlocks[hashID]; !exists {
+			break
+		}
+		hits++
+	}
+	return hits
+}
+
+// assignmentWindow 选择器自身在最近size次分配中各节点的分配数。
+// RequestQueue只保留最近100个请求，稳态下各节点都会饱和，需要区分负载的选择器用它作为负载
+type assignmentWindow struct {
+	size     int
+	recent   []*PrefillNode // 环形缓冲
+	pos      int
+	assigned map[*PrefillNode]int
+}
+
+func newAssignmentWindow(size int) *assignmentWindow {
+	return &assignmentWindow{
+		size:     max(size, 1),
+		assigned: make(map[*PrefillNode]int),
+	}
+}
+
+// record 登记一次分配，窗口满时移出最早的一次
+func (w *assignmentWindow) record(node *PrefillNode) {
+	if len(w.recent) < w.size {
+		w.recent = append(w.recent, node)
+	} else {
+		w.assigned[w.recent[w.pos]]--
+		w.recent[w.pos] = node
+		w.pos = (w.pos + 1) % w.size
+	}
+	w.assigned[node]++
+}
+
+func (w *assignmentWindow) load(node *PrefillNode) int {
+	return w.assigned[node]
+}
+
+// total 窗口内的分配总数
+func (w *assignmentWindow) total() int {
+	return len(w.recent)
+}
+
+// retain 移除不在keep中的节点的分配记录（保持时间顺序），使total只统计当前节点
+func (w *assignmentWindow) retain(keep map[*PrefillNode]bool) {
+	ordered := append(append([]*PrefillNode{}, w.recent[w.pos:]...), w.recent[:w.pos]...)
+	w.recent, w.pos = w.recent[:0], 0
+	for _, node := range ordered {
+		if keep[node] {
+			w.recent = append(w.recent, node)
+		} else {
+			delete(w.assigned, node)
+		}
+	}
+}
+
+// ============= 接口实现：Power-of-d-choices选择器 =============
+
+// PowerOfDChoicesSelector 随机抽取D个节点，选负载最低者；负载相同时选连续前缀命中更长的节点
+type PowerOfDChoicesSelector struct {
+	D   int
+	rng *rand.Rand
+}
+
+func NewPowerOfDChoicesSelector(d int, seed int64) *PowerOfDChoicesSelector {
+	return &PowerOfDChoicesSelector{
+		D:   d,
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (p *PowerOfDChoicesSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	var bestNode *PrefillNode
+	bestLoad, bestHits := 0.0, 0
+	for _, node := range p.sample(nodes) {
+		load := nodeLoad(node)
+		if bestNode != nil && load > bestLoad {
+			continue
+		}
+		hits := contiguousPrefixHits(request, node)
+		if bestNode == nil || load < bestLoad || hits > bestHits {
+			bestNode, bestLoad, bestHits = node, load, hits
+		}
+	}
+	return bestNode
+}
+
+// sample 无放回抽取min(D, n)个候选节点（部分Fisher-Yates，只记录被交换的下标）
+func (p *PowerOfDChoicesSelector) sample(nodes []*PrefillNode) []*PrefillNode {
+	d := max(p.D, 1)
+	if d >= len(nodes) {
+		return nodes
+	}
+	swapped := make(map[int]int, d)
+	at := func(i int) int {
+		if v, exists := swapped[i]; exists {
+			return v
+		}
+		return i
+	}
+	candidates := make([]*PrefillNode, d)
+	for i := 0; i < d; i++ {
+		j := i + p.rng.Intn(len(nodes)-i)
+		vi, vj := at(i), at(j)
+		swapped[i], swapped[j] = vj, vi
+		candidates[i] = nodes[vj]
+	}
+	return candidates
+}
+
+func (p *PowerOfDChoicesSelector) GetName() string {
+	return fmt.Sprintf("PowerOfDChoices(d=%d)", p.D)
+}
+
+// ============= 接口实现：有界负载一致性哈希选择器 =============
+
+// ConsistentHashSelector 以请求前k个block为键做一致性哈希（相同前缀落到同一节点），
+// 节点负载超过 ceil(c × 平均负载) 时顺时针跳到下一个节点（Mirrokni等的有界负载一致性哈希）。
+// 负载按最近1000次分配计算
+type ConsistentHashSelector struct {
+	PrefixBlocks int     // 参与哈希的前缀block数k
+	LoadFactor   float64 // 负载上限系数c（>1）
+	VirtualNodes int     // 每个节点在环上的虚拟节点数
+
+	ring      []ringPoint
+	ringNodes []*PrefillNode // 构建环时的节点列表，用于检测节点集合变化
+	ringSlice **PrefillNode  // 上次传入切片的底层数组
+	window    *assignmentWindow
+}
+
+type ringPoint struct {
+	hash uint64
+	node *PrefillNode
+}
+
+func NewConsistentHashSelector(prefixBlocks int, loadFactor float64, virtualNodes int) *ConsistentHashSelector {
+	return &ConsistentHashSelector{
+		PrefixBlocks: prefixBlocks,
+		LoadFactor:   loadFactor,
+		VirtualNodes: virtualNodes,
+		window:       newAssignmentWindow(1000),
+	}
+}
+
+func (c *ConsistentHashSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	c.ensureRing(nodes)
+
+	// 负载上限：按加入本请求后的平均负载计算（窗口只含当前节点的分配，见ensureRing）
+	capacity := int(math.Ceil(c.LoadFactor * float64(c.window.total()+1) / float64(len(nodes))))
+
+	key := c.requestKey(request)
+	start := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= key })
+
+	var selected *PrefillNode
+	for i := 0; i < len(c.ring); i++ {
+		node := c.ring[(start+i)%len(c.ring)].node
+		if c.window.load(node) < capacity {
+			selected = node
+			break
+		}
+		if selected == nil || c.window.load(node) < c.window.load(selected) {
+			selected = node
+		}
+	}
+	c.window.record(selected)
+	return selected
+}
+
+// ensureRing 节点集合变化时重建哈希环，并移除已离开节点的分配记录。
+// 调用方通常每次传入同一个切片，先按底层数组与首尾节点快速判断，只有切片变化时才逐个比较
+func (c *ConsistentHashSelector) ensureRing(nodes []*PrefillNode) {
+	if len(nodes) == len(c.ringNodes) {
+		if &nodes[0] == c.ringSlice && nodes[0] == c.ringNodes[0] && nodes[len(nodes)-1] == c.ringNodes[len(nodes)-1] {
+			return
+		}
+		same := true
+		for i, node := range nodes {
+			if c.ringNodes[i] != node {
+				same = false
+				break
+			}
+		}
+		if same {
+			c.ringSlice = &nodes[0]
+			return
+		}
+	}
+
+	virtualNodes := max(c.VirtualNodes, 1)
+	c.ringNodes = append([]*PrefillNode{}, nodes...)
+	c.ringSlice = &nodes[0]
+	members := make(map[*PrefillNode]bool, len(nodes))
+	for _, node := range nodes {
+		members[node] = true
+	}
+	c.window.retain(members)
+	c.ring = make([]ringPoint, 0, len(nodes)*virtualNodes)
+	for _, node := range nodes {
+		for v := 0; v < virtualNodes; v++ {
+			h := fnv.New64a()
+			fmt.Fprintf(h, "%s#%d", node.ID, v)
+			c.ring = append(c.ring, ringPoint{hash: h.Sum64(), node: node})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i].hash < c.ring[j].hash })
+}
+
+// requestKey 请求前k个block的哈希
+func (c *ConsistentHashSelector) requestKey(request *Request) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, hashID := range request.HashIDs[:min(c.PrefixBlocks, len(request.HashIDs))] {
+		binary.LittleEndian.PutUint64(buf, uint64(hashID))
+		h.Write(buf)
+	}
+	return h.Sum64()
+}
+
+func (c *ConsistentHashSelector) GetName() string {
+	return fmt.Sprintf("ConsistentHashBoundedLoad(k=%d,c=%.2f)", c.PrefixBlocks, c.LoadFactor)
+}
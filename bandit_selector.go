@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// ============= 多臂老虎机元选择器：在线切换策略 =============
+//
+// 每个epoch（固定请求数）由老虎机算法选定一个子选择器（臂），epoch内的请求全部交给它路由。
+// 按epoch切换而不是按请求切换，避免频繁切换破坏各策略自身的缓存亲和性。
+// 奖励在请求完成时计算（TTFT只有完成时才知道），归入请求所属的epoch。
+
+// RewardFunction 奖励函数，返回值在[0, 1]内
+type RewardFunction interface {
+	Reward(request *Request, result *PrefillResult) float64
+	GetName() string
+}
+
+// HitRateReward 请求的block命中率
+type HitRateReward struct{}
+
+func (h *HitRateReward) Reward(request *Request, result *PrefillResult) float64 {
+	total := result.CacheHits + result.CacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(result.CacheHits) / float64(total)
+}
+
+func (h *HitRateReward) GetName() string {
+	return "hit-rate"
+}
+
+// TTFTReward SLO/(SLO+TTFT)：TTFT为0时为1，等于SLO时为0.5
+type TTFTReward struct {
+	SLOMs float64
+}
+
+func (t *TTFTReward) Reward(request *Request, result *PrefillResult) float64 {
+	return t.SLOMs / (t.SLOMs + result.TTFT)
+}
+
+func (t *TTFTReward) GetName() string {
+	return fmt.Sprintf("ttft(slo=%.0fms)", t.SLOMs)
+}
+
+// GPUCostReward GPU成本加权收益：免计算的前缀token比例按GPU权重计收益，
+// 新写入缓存的block比例按存储权重计成本，线性映射到[0, 1]
+type GPUCostReward struct {
+	GPUWeight     float64
+	StorageWeight float64
+}
+
+func (g *GPUCostReward) Reward(request *Request, result *PrefillResult) float64 {
+	saved, written := 0.0, 0.0
+	if request.InputLength > 0 {
+		saved = float64(result.CachedTokens) / float64(request.InputLength)
+	}
+	if len(request.HashIDs) > 0 {
+		written = float64(result.CacheMisses) / float64(len(request.HashIDs))
+	}
+	return (g.GPUWeight*saved - g.StorageWeight*written + g.StorageWeight) / (g.GPUWeight + g.StorageWeight)
+}
+
+func (g *GPUCostReward) GetName() string {
+	return fmt.Sprintf("gpu-cost(%.0f:%.0f)", g.GPUWeight, g.StorageWeight)
+}
+
+// BanditAlgorithm 臂选择算法
+type BanditAlgorithm int
+
+const (
+	BanditUCB      BanditAlgorithm = iota // UCB1
+	BanditThompson                        // Beta后验的Thompson采样
+)
+
+func (a BanditAlgorithm) String() string {
+	if a == BanditThompson {
+		return "Thompson"
+	}
+	return "UCB"
+}
+
+// BanditEpoch 一个epoch的记录
+type BanditEpoch struct {
+	Epoch          int
+	Arm            int
+	StartTimestamp int     // epoch第一个请求的到达时间（毫秒）
+	Requests       int     // 路由的请求数
+	Rewarded       int     // 已获得奖励的请求数
+	RewardSum      float64 // 奖励之和
+}
+
+// MeanReward epoch内已完成请求的平均奖励
+func (e *BanditEpoch) MeanReward() float64 {
+	if e.Rewarded == 0 {
+		return 0
+	}
+	return e.RewardSum / float64(e.Rewarded)
+}
+
+type banditArm struct {
+	epochs    int     // 被选中的epoch数
+	rewarded  int     // 已获得奖励的请求数
+	rewardSum float64 // 奖励之和
+}
+
+func (a *banditArm) mean() float64 {
+	if a.rewarded == 0 {
+		return 0
+	}
+	return a.rewardSum / float64(a.rewarded)
+}
+
+// BanditSelector 以老虎机算法在多个子选择器之间在线切换
+type BanditSelector struct {
+	Arms          []PrefillNodeSelector
+	Algorithm     BanditAlgorithm
+	Reward        RewardFunction
+	EpochRequests int     // 每个epoch的请求数
+	Exploration   float64 // UCB探索系数c
+
+	History []BanditEpoch // 各epoch选中的臂（按时间顺序）
+
+	arms    []banditArm
+	pending map[*Request]int // 请求 -> 所属epoch
+	rng     *rand.Rand
+}
+
+func NewBanditSelector(arms []PrefillNodeSelector, algorithm BanditAlgorithm, reward RewardFunction, epochRequests int, seed int64) *BanditSelector {
+	return &BanditSelector{
+		Arms:          arms,
+		Algorithm:     algorithm,
+		Reward:        reward,
+		EpochRequests: max(epochRequests, 1),
+		Exploration:   0.1, // 各策略的奖励差异通常只有几个百分点，c=1时几乎退化为轮询
+		arms:          make([]banditArm, len(arms)),
+		pending:       make(map[*Request]int),
+		rng:           rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (b *BanditSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(b.Arms) == 0 {
+		return nil
+	}
+	if len(b.History) == 0 || b.History[len(b.History)-1].Requests >= b.EpochRequests {
+		arm := b.chooseArm()
+		b.arms[arm].epochs++
+		b.History = append(b.History, BanditEpoch{
+			Epoch:          len(b.History),
+			Arm:            arm,
+			StartTimestamp: request.Timestamp,
+		})
+	}
+
+	epoch := &b.History[len(b.History)-1]
+	node := b.Arms[epoch.Arm].SelectNode(request, nodes)
+	if node != nil {
+		epoch.Requests++
+		b.pending[request] = epoch.Epoch
+	}
+	return node
+}
+
+// chooseArm 先让每个臂各运行一个epoch，之后按算法选择
+func (b *BanditSelector) chooseArm() int {
+	for i := range b.arms {
+		if b.arms[i].epochs == 0 {
+			return i
+		}
+	}
+
+	best, bestScore := 0, math.Inf(-1)
+	for i := range b.arms {
+		arm := &b.arms[i]
+		var score float64
+		switch b.Algorithm {
+		case BanditThompson:
+			n := float64(arm.epochs)
+			score = sampleBeta(b.rng, 1+arm.mean()*n, 1+(1-arm.mean())*n)
+		default:
+			score = arm.mean() + b.Exploration*math.Sqrt(2*math.Log(float64(len(b.History)))/float64(arm.epochs))
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// OnRequestCompleted 实现SelectionObserver：把奖励记入请求所属epoch与臂，并转发给子选择器
+func (b *BanditSelector) OnRequestCompleted(request *Request, result *PrefillResult) {
+	index, exists := b.pending[request]
+	if !exists {
+		return
+	}
+	delete(b.pending, request)
+
+	epoch := &b.History[index]
+	reward := b.Reward.Reward(request, result)
+	epoch.Rewarded++
+	epoch.RewardSum += reward
+	b.arms[epoch.Arm].rewarded++
+	b.arms[epoch.Arm].rewardSum += reward
+
+	if observer, ok := b.Arms[epoch.Arm].(SelectionObserver); ok {
+		observer.OnRequestCompleted(request, result)
+	}
+}
+
+// OnRequestFailed 实现FailureObserver：失败请求不计奖励，转发给子选择器
+func (b *BanditSelector) OnRequestFailed(request *Request, at float64) {
+	index, exists := b.pending[request]
+	if !exists {
+		return
+	}
+	delete(b.pending, request)
+
+	if observer, ok := b.Arms[b.History[index].Arm].(FailureObserver); ok {
+		observer.OnRequestFailed(request, at)
+	}
+}
+
+// BestEffort 实现BestEffortHinter：转发给路由该请求的子选择器
+func (b *BanditSelector) BestEffort(request *Request) bool {
+	index, exists := b.pending[request]
+	if !exists {
+		return false
+	}
+	hinter, ok := b.Arms[b.History[index].Arm].(BestEffortHinter)
+	return ok && hinter.BestEffort(request)
+}
+
+// ArmSummary 各臂被选中的epoch数与平均奖励
+func (b *BanditSelector) ArmSummary() (epochs []int, meanRewards []float64) {
+	epochs = make([]int, len(b.arms))
+	meanRewards = make([]float64, len(b.arms))
+	for i := range b.arms {
+		epochs[i] = b.arms[i].epochs
+		meanRewards[i] = b.arms[i].mean()
+	}
+	return epochs, meanRewards
+}
+
+func (b *BanditSelector) GetName() string {
+	return fmt.Sprintf("Bandit(%s,%s,epoch=%d,arms=%d)", b.Algorithm, b.Reward.GetName(), b.EpochRequests, len(b.Arms))
+}
+
+// sampleBeta 由两个Gamma样本构造Beta(a, b)样本
+func sampleBeta(rng *rand.Rand, a, b float64) float64 {
+	x := sampleGamma(rng, a)
+	y := sampleGamma(rng, b)
+	return x / (x + y)
+}
+
+// sampleGamma Marsaglia-Tsang方法采样Gamma(shape, 1)，shape < 1时用提升技巧
+func sampleGamma(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ============= 节点批处理调度：迭代级连续批处理 =============
+//
+// 默认的节点队列是单服务台，每个请求独占节点、耗时与未缓存token数成正比。
+// 开启批处理后节点按迭代执行：每次迭代从在批作业（连续批处理，优先继续）与就绪的等待作业
+// （按优先级与到达顺序）中组批，受批次token数、批次请求数与单请求分块预算约束；
+// 迭代延迟由批次延迟模型按本次计算的未缓存token总数给出，固定开销被同批请求分摊。
+// 请求的最后一段算完时完成，排队时间为首次进入批次前的等待。
+
+// BatchLatencyModel 批次延迟模型（屋顶线模型见compute_model.go）
+type BatchLatencyModel interface {
+	// IterationMs 一次迭代同时计算steps中各请求的延迟（毫秒），steps为空时为固定开销
+	IterationMs(steps []BatchStep) float64
+	GetName() string
+}
+
+// LinearBatchModel 线性批次模型：固定迭代开销 + 每token计算时间
+type LinearBatchModel struct {
+	OverheadMs float64 // 每次迭代的固定开销（调度、kernel启动、采样）
+	MsPerToken float64
+}
+
+func (m *LinearBatchModel) IterationMs(steps []BatchStep) float64 {
+	tokens := 0
+	for _, step := range steps {
+		tokens += step.NewTokens
+	}
+	return m.OverheadMs + float64(tokens)*m.MsPerToken
+}
+
+func (m *LinearBatchModel) GetName() string {
+	return fmt.Sprintf("Linear(%.0fms+%.3fms/token)", m.OverheadMs, m.MsPerToken)
+}
+
+// BatchConfig 节点批处理调度配置
+type BatchConfig struct {
+	MaxBatchTokens int // 单次迭代最多计算的token数
+	MaxBatchSize   int // 单次迭代最多包含的请求数
+	ChunkBudget    int // 单个请求每次迭代最多计算的token数（分块prefill），0表示请求必须整体放入一次迭代
+	Model          BatchLatencyModel
+}
+
+// DefaultBatchConfig 8k token/迭代、最多32个请求、单请求每迭代2k token，默认屋顶线模型加5ms迭代开销
+func DefaultBatchConfig() *BatchConfig {
+	model := DefaultComputeModel()
+	model.OverheadMs = 5
+	return &BatchConfig{
+		MaxBatchTokens: 8192,
+		MaxBatchSize:   32,
+		ChunkBudget:    2048,
+		Model:          model,
+	}
+}
+
+// 单次迭代的最短时间：零开销模型下迭代也必须推进时钟，避免在同一时刻反复组批
+const minIterationMs = 1e-3
+
+// validate 检查配置能让每次迭代至少推进一个作业
+func (c *BatchConfig) validate() error {
+	if c.Model == nil {
+		return fmt.Errorf("batch config has no latency model")
+	}
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", c.MaxBatchSize)
+	}
+	if c.ChunkBudget < 0 {
+		return fmt.Errorf("chunk budget must not be negative, got %d", c.ChunkBudget)
+	}
+	if c.MaxBatchTokens <= 0 {
+		return fmt.Errorf("batch token budget must be positive, got %d", c.MaxBatchTokens)
+	}
+	return nil
+}
+
+func (c *BatchConfig) String() string {
+	return fmt.Sprintf("batch≤%d tokens/%d reqs,chunk=%d,%s", c.MaxBatchTokens, c.MaxBatchSize, c.ChunkBudget, c.Model.GetName())
+}
+
+// step 作业本次迭代可计算的token数，left为批次剩余token预算；0表示本迭代放不下
+func (c *BatchConfig) step(job *prefillJob, left int, empty bool) int {
+	if c.ChunkBudget > 0 {
+		return max(min(min(job.remaining, c.ChunkBudget), left), 0)
+	}
+	if job.remaining <= left || empty {
+		return job.remaining // 超过批次预算的请求在空批次中独占一次迭代
+	}
+	return 0
+}
+
+// SetBatchScheduler 为节点开启批处理调度（nil恢复单服务台）
+func (n *PrefillNode) SetBatchScheduler(config *BatchConfig) {
+	n.jobs.batching = config
+}
+
+// SetBatchScheduler 为所有节点（包括之后扩容的节点）开启批处理调度，配置无效时返回错误
+func (s *Simulator) SetBatchScheduler(config *BatchConfig) error {
+	if config != nil {
+		if err := config.validate(); err != nil {
+			return err
+		}
+	}
+	s.batching = config
+	for _, node := range s.nodes {
+		node.SetBatchScheduler(config)
+	}
+	return nil
+}
+
+// advanceBatchesTo 批处理模式下执行到now为止能结束的迭代，按完成顺序返回完成的作业
+func (q *nodeQueue) advanceBatchesTo(now float64) []*prefillJob {
+	var completed []*prefillJob
+	for {
+		if len(q.batch) == 0 {
+			ready, exists := q.earliestReady()
+			if !exists || ready > now {
+				return completed
+			}
+			q.formBatch(max(q.iterEnd, ready))
+			if len(q.batch) == 0 {
+				return completed
+			}
+		}
+		if q.iterEnd > now {
+			return completed
+		}
+
+		// 迭代结束：推进各作业进度，算完的作业出批
+		continuing := q.batch[:0]
+		for _, job := range q.batch {
+			job.remaining -= job.step
+			if job.remaining > 0 {
+				continuing = append(continuing, job)
+				continue
+			}
+			job.FinishMs = q.iterEnd
+			completed = append(completed, job)
+		}
+		q.batch = continuing
+		q.formBatch(q.iterEnd)
+	}
+}
+
+// earliestReady 等待作业中最早可开始的时间
+func (q *nodeQueue) earliestReady() (float64, bool) {
+	if len(q.waiting) == 0 {
+		return 0, false
+	}
+	ready := q.waiting[0].ArrivalMs
+	for _, job := range q.waiting[1:] {
+		ready = math.Min(ready, job.ArrivalMs)
+	}
+	return ready, true
+}
+
+// formBatch 在at时刻组成下一次迭代：在批作业优先继续，再按队列顺序加入已就绪的等待作业，
+// 遇到放不下的作业即停止（不越过队首，避免大请求饥饿）
+func (q *nodeQueue) formBatch(at float64) {
+	config := q.batching
+	tokens := 0
+	var steps []BatchStep
+	for _, job := range q.batch {
+		job.step = config.step(job, config.MaxBatchTokens-tokens, tokens == 0)
+		tokens += job.step
+		steps = append(steps, job.batchStep())
+	}
+
+	transfer := 0.0
+	waiting := q.waiting[:0]
+	full := false
+	for _, job := range q.waiting {
+		if full || job.ArrivalMs > at {
+			waiting = append(waiting, job)
+			continue
+		}
+		job.remaining = job.Tokens
+		job.step = config.step(job, config.MaxBatchTokens-tokens, len(q.batch) == 0)
+		if job.step == 0 || len(q.batch) >= config.MaxBatchSize {
+			full = true
+			waiting = append(waiting, job)
+			continue
+		}
+		job.StartMs = at
+		tokens += job.step
+		steps = append(steps, job.batchStep())
+		transfer += job.TransferMs // 新加入作业的KV传输在首次迭代中完成
+		q.batch = append(q.batch, job)
+	}
+	q.waiting = waiting
+	if len(q.batch) == 0 {
+		return
+	}
+
+	latency := config.Model.IterationMs(steps) + transfer
+	if slow := q.batch[0].Node.SlowFactor; slow > 1 {
+		latency *= slow
+	}
+	q.iterEnd = at + max(latency, minIterationMs)
+}
+
+// batchStep 作业本次迭代的计算量
+func (job *prefillJob) batchStep() BatchStep {
+	return BatchStep{NewTokens: job.step, PrefixTokens: job.Prefix + job.Tokens - job.remaining}
+}
+
+// batchQueuedWork 批处理模式下的积压估计：当前迭代的剩余时间 + 剩余计算合并为一次前向的时间
+// + 其余迭代的固定开销
+func (q *nodeQueue) batchQueuedWork(now float64) float64 {
+	work := 0.0
+	tokens := 0
+	var steps []BatchStep
+	for _, job := range q.batch {
+		left := job.remaining - job.step
+		if left > 0 {
+			steps = append(steps, BatchStep{NewTokens: left, PrefixTokens: job.Prefix + job.Tokens - left})
+			tokens += left
+		}
+	}
+	if len(q.batch) > 0 {
+		work += max(q.iterEnd-now, 0)
+	}
+	for _, job := range q.waiting {
+		steps = append(steps, BatchStep{NewTokens: job.Tokens, PrefixTokens: job.Prefix})
+		tokens += job.Tokens
+		work += job.TransferMs
+	}
+	if tokens == 0 {
+		return work
+	}
+	model := q.batching.Model
+	iterations := ceilDiv(tokens, max(q.batching.MaxBatchTokens, 1))
+	return work + model.IterationMs(steps) + float64(iterations-1)*model.IterationMs(nil)
+}
@@ -0,0 +1,259 @@
+package main
+
+import "fmt"
+
+// ============= 缓存准入策略（与淘汰算法分离） =============
+
+// CacheAdmissionPolicy 缓存准入策略接口：决定未命中的block是否写入节点缓存
+type CacheAdmissionPolicy interface {
+	// RecordAccess 记录一次block访问（命中或未命中），供基于频率的策略统计
+	RecordAccess(node *PrefillNode, hashID int)
+	// Admit 判断请求中第position个未命中block是否允许写入节点缓存
+	Admit(node *PrefillNode, request *Request, position int) bool
+	// GetName 获取策略名称
+	GetName() string
+}
+
+// VictimPeeker 可预览下一个淘汰对象的淘汰算法（TinyLFU用于比较候选与牺牲者频率）
+type VictimPeeker interface {
+	PeekVictim() int
+}
+
+// hasFreeSlot 判断写入一个block是否无需淘汰
+func hasFreeSlot(node *PrefillNode) bool {
+	return float64(node.MaxMemoryMB)-node.UsedMemoryMB >= blockMemoryMB
+}
+
+// ============= 接口实现：总是准入 =============
+
+type AlwaysAdmitPolicy struct{}
+
+func (a *AlwaysAdmitPolicy) RecordAccess(node *PrefillNode, hashID int) {}
+
+func (a *AlwaysAdmitPolicy) Admit(node *PrefillNode, request *Request, position int) bool {
+	return true
+}
+
+func (a *AlwaysAdmitPolicy) GetName() string {
+	return "Always"
+}
+
+// ============= 接口实现：TinyLFU准入 =============
+
+// TinyLFUAdmission 基于Count-Min Sketch的频率准入：候选block的估计频率高于牺牲者时才准入
+type TinyLFUAdmission struct {
+	Width      int // sketch每行计数器个数
+	SampleSize int // 累计记录次数达到该值后所有计数减半（老化）
+	sketches   map[string]*countMinSketch
+}
+
+func NewTinyLFUAdmission(width, sampleSize int) *TinyLFUAdmission {
+	return &TinyLFUAdmission{
+		Width:      width,
+		SampleSize: sampleSize,
+		sketches:   make(map[string]*countMinSketch),
+	}
+}
+
+func (t *TinyLFUAdmission) sketchFor(node *PrefillNode) *countMinSketch {
+	sketch, exists := t.sketches[node.ID]
+	if !exists {
+		sketch = newCountMinSketch(t.Width, t.SampleSize)
+		t.sketches[node.ID] = sketch
+	}
+	return sketch
+}
+
+func (t *TinyLFUAdmission) RecordAccess(node *PrefillNode, hashID int) {
+	t.sketchFor(node).Increment(hashID)
+}
+
+func (t *TinyLFUAdmission) Admit(node *PrefillNode, request *Request, position int) bool {
+	if hasFreeSlot(node) {
+		return true
+	}
+	peeker, ok := node.EvictionAlgo.(VictimPeeker)
+	if !ok {
+		return true
+	}
+	victim := peeker.PeekVictim()
+	if victim == -1 {
+		return true
+	}
+	sketch := t.sketchFor(node)
+	return sketch.Estimate(request.HashIDs[position]) > sketch.Estimate(victim)
+}
+
+func (t *TinyLFUAdmission) GetName() string {
+	return fmt.Sprintf("TinyLFU(w=%d)", t.Width)
+}
+
+// countMinSketch 4行Count-Min Sketch，带周期性减半老化
+type countMinSketch struct {
+	rows       [4][]uint16
+	width      int
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(width, sampleSize int) *countMinSketch {
+	if width <= 0 {
+		width = 1024
+	}
+	cms := &countMinSketch{width: width, sampleSize: sampleSize}
+	for i := range cms.rows {
+		cms.rows[i] = make([]uint16, width)
+	}
+	return cms
+}
+
+// index 计算第row行的计数器下标（splitmix64混合，每行使用不同种子）
+func (c *countMinSketch) index(row int, key int) int {
+	x := uint64(key) + uint64(row+1)*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return int(x % uint64(c.width))
+}
+
+func (c *countMinSketch) Increment(key int) {
+	for row := range c.rows {
+		idx := c.index(row, key)
+		if c.rows[row][idx] < ^uint16(0) {
+			c.rows[row][idx]++
+		}
+	}
+	c.additions++
+	if c.sampleSize > 0 && c.additions >= c.sampleSize {
+		c.reset()
+	}
+}
+
+func (c *countMinSketch) Estimate(key int) int {
+	estimate := int(^uint16(0))
+	for row := range c.rows {
+		if v := int(c.rows[row][c.index(row, key)]); v < estimate {
+			estimate = v
+		}
+	}
+	return estimate
+}
+
+// reset 所有计数减半，使频率统计偏向近期访问
+func (c *countMinSketch) reset() {
+	for row := range c.rows {
+		for i := range c.rows[row] {
+			c.rows[row][i] >>= 1
+		}
+	}
+	c.additions /= 2
+}
+
+// ============= 接口实现：二次命中准入 =============
+
+// SecondHitAdmission block在同一节点上第二次被访问时才准入，过滤一次性访问
+type SecondHitAdmission struct {
+	MaxTracked int                     // 每个节点记录的候选block上限，超过后清空（门卫重置）
+	seen       map[string]map[int]bool // nodeID -> 已见过一次的block
+}
+
+func NewSecondHitAdmission(maxTracked int) *SecondHitAdmission {
+	return &SecondHitAdmission{
+		MaxTracked: maxTracked,
+		seen:       make(map[string]map[int]bool),
+	}
+}
+
+func (s *SecondHitAdmission) RecordAccess(node *PrefillNode, hashID int) {}
+
+func (s *SecondHitAdmission) Admit(node *PrefillNode, request *Request, position int) bool {
+	seen := s.seen[node.ID]
+	if seen == nil {
+		seen = make(map[int]bool)
+		s.seen[node.ID] = seen
+	}
+
+	hashID := request.HashIDs[position]
+	if seen[hashID] {
+		delete(seen, hashID)
+		return true
+	}
+
+	if s.MaxTracked > 0 && len(seen) >= s.MaxTracked {
+		seen = make(map[int]bool)
+		s.seen[node.ID] = seen
+	}
+	seen[hashID] = true
+	return false
+}
+
+func (s *SecondHitAdmission) GetName() string {
+	return "SecondHit"
+}
+
+// ============= 接口实现：请求长度阈值准入 =============
+
+// SizeThresholdAdmission 输入长度超过阈值的请求不写入缓存，防止一次性长prompt冲刷热点
+type SizeThresholdAdmission struct {
+	MaxInputTokens int
+}
+
+func (s *SizeThresholdAdmission) RecordAccess(node *PrefillNode, hashID int) {}
+
+func (s *SizeThresholdAdmission) Admit(node *PrefillNode, request *Request, position int) bool {
+	return request.InputLength <= s.MaxInputTokens
+}
+
+func (s *SizeThresholdAdmission) GetName() string {
+	return fmt.Sprintf("SizeThreshold(%d)", s.MaxInputTokens)
+}
+
+// ============= 接口实现：前缀深度限制准入 =============
+
+// PrefixDepthAdmission 只缓存请求前MaxDepth个block，共享前缀通常集中在前部
+type PrefixDepthAdmission struct {
+	MaxDepth int
+}
+
+func (p *PrefixDepthAdmission) RecordAccess(node *PrefillNode, hashID int) {}
+
+func (p *PrefixDepthAdmission) Admit(node *PrefillNode, request *Request, position int) bool {
+	return position < p.MaxDepth
+}
+
+func (p *PrefixDepthAdmission) GetName() string {
+	return fmt.Sprintf("PrefixDepth(%d)", p.MaxDepth)
+}
+
+// ============= 拒绝准入记录 =============
+
+// rejectionHistoryBlocks 每个节点每一代拒绝记录的容量（两代合计最多保留2倍）
+const rejectionHistoryBlocks = 4096
+
+// rejectionHistory 节点上近期被拒绝准入的block，用于统计拒绝后再访问的次数。
+// 分两代轮换：当前代写满后降为上一代，更早的记录整体丢弃，内存随时间有界
+type rejectionHistory struct {
+	current  map[int]bool
+	previous map[int]bool
+}
+
+func newRejectionHistory() *rejectionHistory {
+	return &rejectionHistory{current: make(map[int]bool)}
+}
+
+func (h *rejectionHistory) contains(hashID int) bool {
+	return h.current[hashID] || h.previous[hashID]
+}
+
+func (h *rejectionHistory) add(hashID int) {
+	if len(h.current) >= rejectionHistoryBlocks {
+		h.previous = h.current
+		h.current = make(map[int]bool)
+	}
+	h.current[hashID] = true
+}
+
+func (h *rejectionHistory) remove(hashID int) {
+	delete(h.current, hashID)
+	delete(h.previous, hashID)
+}
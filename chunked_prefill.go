@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ============= 分块prefill：超长上下文的跨节点流水线 =============
+//
+// 参照Mooncake的分块流水线并行（Chunked Pipeline Parallelism）：输入超过阈值的请求按block切成
+// 若干连续分块，依次交给不同节点。后一块的注意力需要前面全部上下文的KV，这些KV按层流式前送：
+// 前一块算完第一层后后一块即可开始，最后一层也只比前一块晚一层结束，因此各分块的计算大部分重叠。
+// 分块作业的最早开始时间在入队时按前一块所在节点的积压估计（节点FIFO时即为准确值），
+// 节点会为尚未就绪的分块预留服务台。请求在所有分块完成后才算完成，TTFT取最后完成的分块。
+
+// ChunkedPrefillConfig 分块prefill配置
+type ChunkedPrefillConfig struct {
+	ThresholdTokens int // 输入超过该token数的请求分块
+	ChunkTokens     int // 每块的目标token数（按block取整）
+	MaxNodes        int // 单个请求最多分到的节点数，分块数超过时合并为更大的块
+	Layers          int // 模型层数：相邻分块按层流水的粒度
+}
+
+// DefaultChunkedPrefillConfig 超过32k token的请求按16k分块，最多4个节点，80层（70B级模型）
+func DefaultChunkedPrefillConfig() *ChunkedPrefillConfig {
+	return &ChunkedPrefillConfig{
+		ThresholdTokens: 32 * 1024,
+		ChunkTokens:     16 * 1024,
+		MaxNodes:        4,
+		Layers:          80,
+	}
+}
+
+func (c *ChunkedPrefillConfig) String() string {
+	return fmt.Sprintf(">%dk按%dk分块,≤%d节点", c.ThresholdTokens/1024, c.ChunkTokens/1024, c.MaxNodes)
+}
+
+// SetChunkedPrefill 设置分块prefill（nil表示不分块）
+func (p *BasicPrefillProcessor) SetChunkedPrefill(config *ChunkedPrefillConfig) {
+	p.chunking = config
+}
+
+// SetChunkedPrefill 为模拟器的处理器设置分块prefill
+func (s *Simulator) SetChunkedPrefill(config *ChunkedPrefillConfig) {
+	if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+		processor.SetChunkedPrefill(config)
+	}
+}
+
+// chunkPipeline 一个分块请求在各节点上的分块作业
+type chunkPipeline struct {
+	jobs   []*prefillJob
+	lags   []float64 // 各分块相对前一块的一层延迟（首块为0）
+	done   int
+	failed bool // 某个分块所在节点崩溃
+}
+
+// complete 登记一个分块完成，返回整个请求是否就此完成
+func (c *chunkPipeline) complete() bool {
+	c.done++
+	return c.done == len(c.jobs) && !c.failed
+}
+
+// span 请求到达、首个分块开始与最后一个分块完成的时间。
+// 每块的最后一层依赖前一块的最后一层，因此不早于前一块完成后一层；批处理调度按token进度执行，
+// 节点排队也可能使实际顺序偏离入队时的估计，这里按流水线依赖修正
+func (c *chunkPipeline) span() (arrival, start, finish float64) {
+	arrival, start = c.jobs[0].ArrivalMs, math.Inf(1)
+	for i, job := range c.jobs {
+		start = math.Min(start, job.StartMs)
+		finish = math.Max(job.FinishMs, finish+c.lags[i])
+	}
+	return arrival, start, finish
+}
+
+// chunkCount 请求应切分的块数，1表示不分块
+func (p *BasicPrefillProcessor) chunkCount(request *Request, candidates int) int {
+	if p.chunking == nil || request.InputLength <= p.chunking.ThresholdTokens {
+		return 1
+	}
+	chunkBlocks := max(p.chunking.ChunkTokens/blockTokens, 1)
+	return min(min(ceilDiv(len(request.HashIDs), chunkBlocks), p.chunking.MaxNodes), candidates)
+}
+
+// processChunked 把请求切成chunks块流水线式分布到多个节点：首块由选择器选定的节点处理，
+// 后续每块选择尚未使用的节点中缓存该块连续前缀最多者（相同时选积压最少者）
+func (p *BasicPrefillProcessor) processChunked(request *Request, first *PrefillNode, candidates []*PrefillNode, chunks int) *PrefillResult {
+	now := float64(request.Timestamp)
+	size := ceilDiv(len(request.HashIDs), chunks)
+	result := &PrefillResult{
+		SelectedNode:    first,
+		ProcessedBlocks: request.HashIDs,
+	}
+	pipeline := &chunkPipeline{}
+	used := make(map[*PrefillNode]bool, chunks)
+
+	node := first
+	computed := 0.0
+	var previous *prefillJob
+	for from := 0; from < len(request.HashIDs); from += size {
+		to := min(from+size, len(request.HashIDs))
+		if previous != nil {
+			node = pickChunkNode(request, from, to, candidates, used, now)
+		}
+		used[node] = true
+		result.ChunkNodes = append(result.ChunkNodes, node)
+
+		// 前面分块的KV不在本节点的部分需要前送
+		forwarded := 0
+		for _, hashID := range request.HashIDs[:from] {
+			if _, exists := node.CacheBlocks[hashID]; !exists {
+				forwarded++
+			}
+		}
+		chunkTokens := max(min(to*blockTokens, request.InputLength)-from*blockTokens, 0)
+		cachedTokens := min(contiguousChunkHits(request, from, to, node)*blockTokens, chunkTokens)
+		result.CachedTokens += cachedTokens
+
+		hits, misses := p.processBlocks(node, request, from, to)
+		result.CacheHits += hits
+		result.CacheMisses += misses
+
+		prefix := from*blockTokens + cachedTokens
+		processTime := p.compute.PrefillMs(chunkTokens-cachedTokens, prefix)
+		computed += processTime
+		if node.SlowFactor > 1 {
+			processTime *= node.SlowFactor
+		}
+		transferTime := float64(misses+forwarded) * blockMemoryMB / node.NetworkBandwidth
+		p.stats.TransferredBlocks += forwarded
+		result.ProcessTime += processTime
+		result.TransferTime += transferTime
+
+		job := &prefillJob{
+			Request:    request,
+			Node:       node,
+			Result:     result,
+			ArrivalMs:  now,
+			ServiceMs:  transferTime + processTime,
+			TransferMs: transferTime,
+			Tokens:     max(chunkTokens-cachedTokens, 1),
+			Prefix:     prefix,
+			Priority:   request.Priority,
+			Pipeline:   pipeline,
+		}
+		// 估计开始时间：节点积压清空且前一块已算完第一层；结束不早于前一块结束后一层
+		start := now + node.QueuedWork(now)
+		lag := 0.0
+		if previous != nil {
+			lag = previous.ServiceMs / float64(max(p.chunking.Layers, 1))
+			job.ArrivalMs = previous.StartMs + lag
+			start = math.Max(start, job.ArrivalMs)
+			job.ServiceMs = math.Max(job.ServiceMs, previous.FinishMs+lag-start)
+		}
+		job.StartMs, job.FinishMs = start, start+job.ServiceMs // 估计值，执行时按实际排队覆盖
+
+		pipeline.jobs = append(pipeline.jobs, job)
+		pipeline.lags = append(pipeline.lags, lag)
+		p.submit(job)
+		previous = job
+	}
+
+	p.stats.ChunkedRequests++
+	p.recordRequest(request, result)
+	result.computeMs = computed
+	p.advanceTo(now)
+	return result
+}
+
+// contiguousChunkHits 节点上从分块开头起连续命中的block数
+func contiguousChunkHits(request *Request, from, to int, node *PrefillNode) int {
+	hits := 0
+	for _, hashID := range request.HashIDs[from:to] {
+		if _, exists := node.CacheBlocks[hashID]; !exists {
+			break
+		}
+		hits++
+	}
+	return hits
+}
+
+// pickChunkNode 为[from, to)分块选择节点
+func pickChunkNode(request *Request, from, to int, candidates []*PrefillNode, used map[*PrefillNode]bool, now float64) *PrefillNode {
+	var best *PrefillNode
+	bestHits, bestWork := -1, 0.0
+	for _, node := range candidates {
+		if used[node] {
+			continue
+		}
+		hits, work := contiguousChunkHits(request, from, to, node), node.QueuedWork(now)
+		if hits > bestHits || (hits == bestHits && work < bestWork) {
+			best, bestHits, bestWork = node, hits, work
+		}
+	}
+	return best
+}
+
+// ContextLengthTTFT 按输入长度分组记录TTFT（实现SelectionObserver），衡量分块对长上下文的效果
+type ContextLengthTTFT struct {
+	ThresholdTokens int
+	Long            []float64 // 输入超过阈值的请求的TTFT
+	Short           []float64
+}
+
+func (c *ContextLengthTTFT) OnRequestCompleted(request *Request, result *PrefillResult) {
+	if request.InputLength > c.ThresholdTokens {
+		c.Long = append(c.Long, result.TTFT)
+	} else {
+		c.Short = append(c.Short, result.TTFT)
+	}
+}
+
+// summarizeTTFT 返回样本的平均值与P99
+func summarizeTTFT(samples []float64) (avg, p99 float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	total := 0.0
+	for _, ttft := range sorted {
+		total += ttft
+	}
+	return total / float64(len(sorted)), percentileFloat(sorted, 0.99)
+}
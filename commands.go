@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============= 子命令 =============
+
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var subcommands = []subcommand{
+	{"generate", "生成合成工作负载轨迹（JSONL/CSV/K3TB）", runGenerateCommand},
+	{"analyze", "分析轨迹：前缀共享、复用距离、Zipf热度、到达率、长度分布", runAnalyzeCommand},
+	{"transform", "变换轨迹：合并（hash ID重映射）、采样、时间缩放、热点突发注入", runTransformCommand},
+	{"convert", "将prompt日志（文本或token ID）转换为链式block哈希轨迹", runConvertCommand},
+}
+
+// runSubcommand 分发子命令
+func runSubcommand(name string, args []string) error {
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			return cmd.run(args)
+		}
+	}
+	printUsage()
+	if name != "help" && name != "-h" && name != "--help" {
+		return fmt.Errorf("未知子命令: %s", name)
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: k3 [子命令] [参数]")
+	fmt.Fprintln(os.Stderr, "\n不带子命令时运行策略验证（读取当前目录下的mooncake_trace.jsonl，参数见 k3 -h）。\n\n子命令:")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// validationOptions 策略验证运行（不带子命令）的参数
+type validationOptions struct {
+	eviction      string // 淘汰算法名称
+	evictionAlgo  EvictionFactory
+	cacheMemoryMB int          // 每节点缓存内存上限（MB），0表示使用节点默认值
+	blockTTL      int          // block存活时间（模拟毫秒，命中续期），0表示不过期
+	faults        []FaultEvent // 故障注入对比的时间表（相对轨迹起点），为空时使用内置时间表
+	costModel     *CostModel   // 成本分析使用的成本模型（单价可由-cost-config覆盖）
+}
+
+var validation = validationOptions{eviction: "LFU", evictionAlgo: evictionRegistry["LFU"], costModel: DefaultCostModel()}
+
+// parseValidationFlags 解析策略验证运行的参数
+func parseValidationFlags(args []string) error {
+	fs := flag.NewFlagSet("k3", flag.ExitOnError)
+	fs.Usage = func() {
+		printUsage()
+		fmt.Fprintln(os.Stderr, "\n策略验证参数:")
+		fs.PrintDefaults()
+	}
+	eviction := fs.String("eviction", validation.eviction,
+		fmt.Sprintf("对比实验使用的淘汰算法（%s）", strings.Join(EvictionAlgorithmNames(), "/")))
+	cacheMB := fs.Int("cache-mb", 0, "每节点缓存内存上限（MB），0表示节点默认值")
+	blockTTL := fs.Int("block-ttl", 0, "block存活时间（毫秒，命中时续期），0表示不过期")
+	var faults faultFlags
+	fs.Var(&faults, "fault", "故障注入对比的故障事件，如\"crash@120s:node-1\"、\"slow@60s:node-2:4\"（可重复，时间相对轨迹起点，节点为node-0..node-3）")
+	costConfig := fs.String("cost-config", "", "成本单价JSON文件（如cost_prices.json，未指定时使用默认单价）")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("多余的参数: %s", strings.Join(fs.Args(), " "))
+	}
+	factory, err := LookupEvictionAlgorithm(*eviction)
+	if err != nil {
+		return fmt.Errorf("-eviction: %w", err)
+	}
+	if *cacheMB < 0 || *blockTTL < 0 {
+		return fmt.Errorf("-cache-mb 与 -block-ttl 不能为负数")
+	}
+	for _, event := range faults {
+		known := false
+		for i := 0; i < faultComparisonNodes; i++ {
+			known = known || event.NodeID == fmt.Sprintf("node-%d", i)
+		}
+		if !known {
+			return fmt.Errorf("-fault %s: 故障注入对比只有node-0..node-%d", event, faultComparisonNodes-1)
+		}
+	}
+	costModel := DefaultCostModel()
+	if *costConfig != "" {
+		prices, err := LoadCostPrices(*costConfig)
+		if err != nil {
+			return fmt.Errorf("-cost-config: %w", err)
+		}
+		costModel.Prices = prices
+	}
+	validation = validationOptions{eviction: *eviction, evictionAlgo: factory, cacheMemoryMB: *cacheMB, blockTTL: *blockTTL, faults: faults, costModel: costModel}
+	return nil
+}
+
+// newValidationSimulator 创建模拟器并应用验证参数中的缓存内存上限与block TTL
+func newValidationSimulator(nodeCount, cacheSize int, selector PrefillNodeSelector, evictionAlgo EvictionFactory) *Simulator {
+	sim := NewSimulator(nodeCount, cacheSize, selector, evictionAlgo)
+	if validation.cacheMemoryMB > 0 {
+		sim.SetCacheMemory(validation.cacheMemoryMB)
+	}
+	sim.SetBlockTTL(validation.blockTTL)
+	return sim
+}
+
+// runGenerateCommand generate子命令
+func runGenerateCommand(args []string) error {
+	cfg := DefaultWorkloadConfig()
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	output := fs.String("o", "synthetic_trace.jsonl", "输出文件（扩展名决定格式，可追加.gz，\"-\"为标准输出）")
+	fs.IntVar(&cfg.NumRequests, "n", cfg.NumRequests, "请求数")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "随机种子")
+	rate := fs.Float64("rate", 6.5, "Poisson到达率（请求/秒）")
+	mmpp := fs.String("mmpp", "", "MMPP各状态到达率，逗号分隔（如\"2,20\"），设置后替代Poisson")
+	dwell := fs.String("mmpp-dwell", "60000,10000", "MMPP各状态平均停留时间（毫秒），逗号分隔")
+	fs.IntVar(&cfg.TreeDepth, "tree-depth", cfg.TreeDepth, "共享前缀树深度")
+	fs.IntVar(&cfg.TreeBranching, "tree-branching", cfg.TreeBranching, "共享前缀树分叉数")
+	fs.IntVar(&cfg.BlocksPerLevel, "tree-blocks", cfg.BlocksPerLevel, "前缀树每层block数")
+	fs.Float64Var(&cfg.ZipfS, "zipf", cfg.ZipfS, "模板热度Zipf指数（>1）")
+	fs.Float64Var(&cfg.TemplateProbability, "template-prob", cfg.TemplateProbability, "新会话使用共享模板的概率")
+	fs.Float64Var(&cfg.SessionContinueProb, "session-prob", cfg.SessionContinueProb, "请求属于已有会话的概率")
+	fs.IntVar(&cfg.MaxTurns, "max-turns", cfg.MaxTurns, "会话最大轮数")
+	inputMedian := fs.Float64("input-median", 4000, "首轮输入长度中位数（token）")
+	outputMedian := fs.Float64("output-median", 150, "输出长度中位数（token）")
+	fs.Parse(args)
+
+	if *mmpp != "" {
+		rates, err := parseFloatList(*mmpp)
+		if err != nil {
+			return fmt.Errorf("-mmpp: %w", err)
+		}
+		dwells, err := parseFloatList(*dwell)
+		if err != nil {
+			return fmt.Errorf("-mmpp-dwell: %w", err)
+		}
+		if len(rates) != len(dwells) {
+			return fmt.Errorf("-mmpp 与 -mmpp-dwell 的状态数不一致 (%d vs %d)", len(rates), len(dwells))
+		}
+		if cfg.Arrival, err = NewMMPPArrival(rates, dwells); err != nil {
+			return fmt.Errorf("-mmpp: %w", err)
+		}
+	} else {
+		if !isPositiveFinite(*rate) {
+			return fmt.Errorf("-rate 必须为正数: %v", *rate)
+		}
+		cfg.Arrival = &PoissonArrival{RatePerSec: *rate}
+	}
+	cfg.InputLength.(*LogNormalLength).Median = *inputMedian
+	cfg.OutputLength.(*LogNormalLength).Median = *outputMedian
+
+	generator, err := NewWorkloadGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	writer, err := CreateTrace(*output)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for {
+		request, err := generator.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		if err := writer.Write(request); err != nil {
+			writer.Close()
+			return err
+		}
+		count++
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if *output != "-" {
+		fmt.Printf("已生成%d个请求 (%s) → %s\n", count, cfg.Arrival.GetName(), *output)
+	}
+	return nil
+}
+
+func parseFloatList(value string) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// runAnalyzeCommand analyze子命令
+func runAnalyzeCommand(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	window := fs.Duration("window", time.Minute, "到达率统计窗口")
+	top := fs.Int("top", 10, "输出的热门block数")
+	jsonOut := fs.String("json", "", "将完整报告导出为JSON文件")
+	strict := fs.Bool("strict", false, "遇到非法记录立即失败")
+	fs.Parse(args)
+
+	if *top < 0 {
+		return fmt.Errorf("-top 不能为负数: %d", *top)
+	}
+	filename := "mooncake_trace.jsonl"
+	if fs.NArg() > 0 {
+		filename = fs.Arg(0)
+	}
+
+	requests, err := loadTraceForCommand(filename, *strict)
+	if err != nil {
+		return err
+	}
+
+	analysis := AnalyzeTrace(requests, int(window.Milliseconds()), *top)
+	analysis.Print()
+
+	if *jsonOut != "" {
+		data, err := json.MarshalIndent(analysis, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*jsonOut, data, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("\n报告已导出 → %s\n", *jsonOut)
+	}
+	return nil
+}
+
+// loadTraceForCommand 加载轨迹并在标准错误上报告被跳过的记录
+func loadTraceForCommand(filename string, strict bool) ([]*Request, error) {
+	requests, skipped, err := LoadRequestsWithOptions(filename, TraceLoadOptions{Strict: strict, MaxErrors: 1})
+	if err != nil {
+		return nil, err
+	}
+	if skipped.Count > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  %s: 跳过%d条非法记录（首条: %v）\n", filename, skipped.Count, skipped.Errors[0])
+	}
+	return requests, nil
+}
+
+// faultFlags 可重复的-fault参数
+type faultFlags []FaultEvent
+
+func (f *faultFlags) String() string {
+	return fmt.Sprintf("%d faults", len(*f))
+}
+
+func (f *faultFlags) Set(value string) error {
+	event, err := ParseFaultEvent(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, event)
+	return nil
+}
+
+// burstFlags 可重复的-burst参数
+type burstFlags []HotspotBurst
+
+func (b *burstFlags) String() string {
+	return fmt.Sprintf("%d bursts", len(*b))
+}
+
+func (b *burstFlags) Set(value string) error {
+	burst, err := ParseHotspotBurst(value)
+	if err != nil {
+		return err
+	}
+	*b = append(*b, burst)
+	return nil
+}
+
+// runTransformCommand transform子命令：合并 → 会话推断 → 采样 → 时间缩放 → 热点注入
+func runTransformCommand(args []string) error {
+	fs := flag.NewFlagSet("transform", flag.ExitOnError)
+	output := fs.String("o", "", "输出文件（必填，扩展名决定格式）")
+	scale := fs.Float64("scale", 1, "到达率倍数（2表示时间戳间隔减半）")
+	sample := fs.Float64("sample", 1, "采样比例 (0, 1]")
+	sampleBy := fs.String("sample-by", "request", "采样单位: request 或 session")
+	align := fs.Bool("align", true, "合并时将各轨迹起始时间对齐到0")
+	sessions := fs.Bool("sessions", false, "为缺少session_id的请求按前缀链延续推断会话ID并写出")
+	seed := fs.Int64("seed", 1, "随机种子")
+	var bursts burstFlags
+	fs.Var(&bursts, "burst", "注入热点突发，如\"start=600s,duration=30s,rate=20,prefix=8,suffix=4\"（可重复，时间为变换后的时间轴）")
+	fs.Parse(args)
+
+	if *output == "" || fs.NArg() == 0 {
+		return fmt.Errorf("用法: transform -o out.jsonl [选项] trace1 [trace2 ...]")
+	}
+	if *scale <= 0 || *sample <= 0 || *sample > 1 {
+		return fmt.Errorf("-scale 必须大于0，-sample 必须在(0, 1]内")
+	}
+
+	traces := make([][]*Request, 0, fs.NArg())
+	for _, filename := range fs.Args() {
+		requests, err := loadTraceForCommand(filename, false)
+		if err != nil {
+			return err
+		}
+		traces = append(traces, requests)
+	}
+
+	requests := traces[0]
+	if len(traces) > 1 {
+		requests = MergeTraces(traces, *align)
+	}
+	if *sessions {
+		requests = FillSessionIDs(requests)
+	}
+	if *sample < 1 {
+		switch *sampleBy {
+		case "request":
+			requests = SampleRequests(requests, *sample, *seed)
+		case "session":
+			requests = SampleSessions(requests, *sample, *seed)
+		default:
+			return fmt.Errorf("未知采样单位 %q", *sampleBy)
+		}
+	}
+	if *scale != 1 {
+		requests = ScaleTimestamps(requests, *scale)
+	}
+	if len(bursts) > 0 {
+		requests = InjectHotspotBursts(requests, bursts, *seed)
+	}
+
+	if err := WriteRequests(*output, requests); err != nil {
+		return err
+	}
+	fmt.Printf("已写出%d个请求 → %s\n", len(requests), *output)
+	return nil
+}
+
+// runConvertCommand convert子命令
+func runConvertCommand(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	output := fs.String("o", "", "输出轨迹文件（必填，扩展名决定格式）")
+	tokenizerName := fs.String("tokenizer", "whitespace", "分词器（token_ids字段存在时不使用）")
+	blockSize := fs.Int("block-size", blockTokens, "每个block的token数")
+	partial := fs.Bool("partial", true, "末尾不完整block也参与哈希（Mooncake轨迹语义）")
+	strict := fs.Bool("strict", false, "遇到非法记录立即失败")
+	fs.Parse(args)
+
+	if *output == "" || fs.NArg() != 1 {
+		return fmt.Errorf("用法: convert -o trace.jsonl [选项] prompts.jsonl")
+	}
+	if *blockSize <= 0 {
+		return fmt.Errorf("-block-size 必须为正数: %d", *blockSize)
+	}
+	hasher, err := NewBlockHasher(*blockSize, *partial)
+	if err != nil {
+		return err
+	}
+	tokenizer, err := LookupTokenizer(*tokenizerName)
+	if err != nil {
+		return err
+	}
+
+	input, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	writer, err := CreateTrace(*output)
+	if err != nil {
+		return err
+	}
+	converter := NewPromptConverter(tokenizer, hasher)
+	written, skipped, err := ConvertPromptLog(input, writer, converter, TraceLoadOptions{Strict: *strict, MaxErrors: 1})
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if skipped.Count > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  跳过%d条非法记录（首条: %v）\n", skipped.Count, skipped.Errors[0])
+	}
+	fmt.Printf("已转换%d条prompt (%s分词, block=%d) → %s\n", written, tokenizer.GetName(), *blockSize, *output)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ============= 屋顶线（Roofline）prefill计算模型 =============
+//
+// prefill的计算量由模型结构决定：线性层约为 2 × 参数量 × 新token数 FLOPs，
+// 注意力约为 4 × 层数 × 隐藏维度 × (新token数 × 已缓存前缀长度 + 新token数²/2) FLOPs，
+// 因此命中深前缀时节省的是全部线性层计算，但新token仍要对整个前缀做注意力。
+// 访存量为一次权重读取加上前缀KV的读取与新KV的写入。
+// 一次前向的耗时取算力上限与带宽上限中较慢者（屋顶线），再加固定开销。
+
+// BatchStep 一次前向中单个请求的计算量
+type BatchStep struct {
+	NewTokens    int // 本次计算的token数
+	PrefixTokens int // 其前方已有KV的token数（缓存命中或此前迭代已算完）
+}
+
+// ComputeModel 模型结构与GPU规格决定的prefill计算模型，同时实现BatchLatencyModel
+type ComputeModel struct {
+	Name string
+
+	// 模型结构
+	Params        float64 // 参数量
+	Layers        int
+	HiddenSize    int
+	KVDim         int     // 每层每token的K（或V）维度，GQA下为 KV头数 × 头维度
+	BytesPerParam float64 // 权重与KV的字节数（bf16为2）
+
+	// 节点硬件（节点内张量并行的GPU共同完成一次前向）
+	GPUs            int
+	PeakTFLOPs      float64 // 单卡峰值算力（TFLOPs）
+	MemBandwidthGBs float64 // 单卡显存带宽（GB/s）
+	MFU             float64 // 可达到的算力利用率
+	OverheadMs      float64 // 每次前向的固定开销（调度、kernel启动）
+}
+
+// DefaultComputeModel Llama-3-8B在4×H100（张量并行）上，MFU 55%
+func DefaultComputeModel() *ComputeModel {
+	return &ComputeModel{
+		Name:            "Llama-3-8B@4×H100",
+		Params:          8.03e9,
+		Layers:          32,
+		HiddenSize:      4096,
+		KVDim:           1024,
+		BytesPerParam:   2,
+		GPUs:            4,
+		PeakTFLOPs:      989,
+		MemBandwidthGBs: 3350,
+		MFU:             0.55,
+	}
+}
+
+// FLOPs 单个请求计算newTokens个token（前方已有prefixTokens个token的KV）的浮点运算量
+func (m *ComputeModel) FLOPs(newTokens, prefixTokens int) float64 {
+	n, c := float64(newTokens), float64(prefixTokens)
+	linear := 2 * m.Params * n
+	attention := 4 * float64(m.Layers) * float64(m.HiddenSize) * (n*c + n*n/2)
+	return linear + attention
+}
+
+// kvBytes tokens个token的KV占用的字节数
+func (m *ComputeModel) kvBytes(tokens int) float64 {
+	return 2 * float64(m.Layers) * float64(m.KVDim) * m.BytesPerParam * float64(tokens)
+}
+
+// IterationMs 实现BatchLatencyModel：一次前向同时计算steps中各请求的延迟，权重只读取一次
+func (m *ComputeModel) IterationMs(steps []BatchStep) float64 {
+	flops, bytes, tokens := 0.0, m.Params*m.BytesPerParam, 0
+	for _, step := range steps {
+		flops += m.FLOPs(step.NewTokens, step.PrefixTokens)
+		bytes += m.kvBytes(step.NewTokens + step.PrefixTokens)
+		tokens += step.NewTokens
+	}
+	if tokens == 0 {
+		return m.OverheadMs
+	}
+	gpus := float64(max(m.GPUs, 1))
+	computeMs := flops / (gpus * m.PeakTFLOPs * 1e12 * m.MFU) * 1000
+	memoryMs := bytes / (gpus * m.MemBandwidthGBs * 1e9) * 1000
+	return m.OverheadMs + math.Max(computeMs, memoryMs)
+}
+
+// PrefillMs 单独处理一个请求的prefill时间：newTokens个未缓存token，前方prefixTokens个token已缓存；
+// 没有需要计算的token时为0
+func (m *ComputeModel) PrefillMs(newTokens, prefixTokens int) float64 {
+	if newTokens <= 0 {
+		return 0
+	}
+	return m.IterationMs([]BatchStep{{NewTokens: newTokens, PrefixTokens: prefixTokens}})
+}
+
+// MsPerToken 长度为tokens的请求无缓存时的平均每token时间
+func (m *ComputeModel) MsPerToken(tokens int) float64 {
+	return m.PrefillMs(tokens, 0) / float64(max(tokens, 1))
+}
+
+func (m *ComputeModel) GetName() string {
+	if m.OverheadMs > 0 {
+		return fmt.Sprintf("Roofline(%s,MFU=%.0f%%,+%.0fms)", m.Name, m.MFU*100, m.OverheadMs)
+	}
+	return fmt.Sprintf("Roofline(%s,MFU=%.0f%%)", m.Name, m.MFU*100)
+}
+
+// SetComputeModel 设置prefill计算模型
+func (p *BasicPrefillProcessor) SetComputeModel(model *ComputeModel) {
+	p.compute = model
+}
+
+// SetComputeModel 为模拟器的处理器设置prefill计算模型
+func (s *Simulator) SetComputeModel(model *ComputeModel) {
+	if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+		processor.SetComputeModel(model)
+	}
+}
+
+// recordCompute 请求完成时累计其计算时间及缓存命中节省的计算时间（崩溃丢失的请求不计入）
+func (p *BasicPrefillProcessor) recordCompute(request *Request, computeMs float64) {
+	p.stats.ComputeMs += computeMs
+	p.stats.SavedComputeMs += p.compute.PrefillMs(request.InputLength, 0) - computeMs
+}
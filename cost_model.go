@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ============= 成本模型：每百万请求的美元成本 =============
+//
+// 一次模拟消耗三类资源：GPU卡时（屋顶线模型给出的prefill计算时间 × 节点GPU数）、
+// 缓存层占用（各层缓存block数对时间积分，按计算模型的KV大小折算为GB时）、
+// 网络传输（跨节点拉取与前送的KV）。按配置的单价折算为美元后归一到每百万请求。
+// 模拟器的缓存目前只有节点内存（DRAM）一层，SSD占用恒为0，价格保留供多层缓存使用。
+
+// CostPrices 资源单价（美元）
+type CostPrices struct {
+	GPUHour    float64 `json:"gpu_hour"`     // 每卡时
+	DRAMGBHour float64 `json:"dram_gb_hour"` // 每GB内存每小时
+	SSDGBHour  float64 `json:"ssd_gb_hour"`  // 每GB SSD每小时
+	NetworkGB  float64 `json:"network_gb"`   // 每传输1GB
+}
+
+// DefaultCostPrices H100按需$3/卡时，内存$0.005/GB时，SSD $0.0002/GB时，
+// 集群内RDMA网络按设备摊销$0.0001/GB（跨可用区流量约贵100倍，可在配置中调整）
+func DefaultCostPrices() *CostPrices {
+	return &CostPrices{
+		GPUHour:    3.0,
+		DRAMGBHour: 0.005,
+		SSDGBHour:  0.0002,
+		NetworkGB:  0.0001,
+	}
+}
+
+// LoadCostPrices 从JSON配置读取单价，未出现的字段取默认值
+func LoadCostPrices(filename string) (*CostPrices, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	prices := DefaultCostPrices()
+	if err := json.Unmarshal(data, prices); err != nil {
+		return nil, fmt.Errorf("解析成本配置 %s: %w", filename, err)
+	}
+	return prices, nil
+}
+
+func (p *CostPrices) String() string {
+	return fmt.Sprintf("GPU $%.2f/卡时, DRAM $%.4f/GB时, SSD $%.4f/GB时, 网络 $%.4f/GB",
+		p.GPUHour, p.DRAMGBHour, p.SSDGBHour, p.NetworkGB)
+}
+
+// CostUsage 一次模拟消耗的资源
+type CostUsage struct {
+	Requests    int
+	GPUHours    float64
+	DRAMGBHours float64
+	SSDGBHours  float64
+	NetworkGB   float64
+}
+
+// CostBreakdown 各类资源的美元成本
+type CostBreakdown struct {
+	GPU     float64
+	DRAM    float64
+	SSD     float64
+	Network float64
+}
+
+func (b CostBreakdown) Total() float64 {
+	return b.GPU + b.DRAM + b.SSD + b.Network
+}
+
+// PerMillion 归一到每百万请求
+func (b CostBreakdown) PerMillion(requests int) CostBreakdown {
+	if requests == 0 {
+		return CostBreakdown{}
+	}
+	scale := 1e6 / float64(requests)
+	return CostBreakdown{b.GPU * scale, b.DRAM * scale, b.SSD * scale, b.Network * scale}
+}
+
+// CostModel 计算模型与单价共同决定的成本模型
+type CostModel struct {
+	Compute *ComputeModel // 应与模拟器使用的计算模型一致（决定GPU数与每block的KV大小）
+	Prices  *CostPrices
+}
+
+func NewCostModel(compute *ComputeModel, prices *CostPrices) *CostModel {
+	return &CostModel{Compute: compute, Prices: prices}
+}
+
+// DefaultCostModel 默认计算模型与默认单价
+func DefaultCostModel() *CostModel {
+	return NewCostModel(DefaultComputeModel(), DefaultCostPrices())
+}
+
+// Usage 汇总模拟器的资源消耗（应在Drain之后调用）
+func (m *CostModel) Usage(sim *Simulator) CostUsage {
+	stats := sim.processor.GetStatistics()
+	blockGB := m.Compute.kvBytes(blockTokens) / 1e9
+	return CostUsage{
+		Requests:    stats.CompletedRequests, // 因故障丢失的请求不计入分母
+		GPUHours:    stats.ComputeMs / 3.6e6 * float64(max(m.Compute.GPUs, 1)),
+		DRAMGBHours: sim.BlockSeconds() / 3600 * blockGB,
+		NetworkGB:   float64(stats.TransferredBlocks+sim.movedBlocks()) * blockGB,
+	}
+}
+
+// Cost 按单价折算资源消耗
+func (m *CostModel) Cost(usage CostUsage) CostBreakdown {
+	return CostBreakdown{
+		GPU:     usage.GPUHours * m.Prices.GPUHour,
+		DRAM:    usage.DRAMGBHours * m.Prices.DRAMGBHour,
+		SSD:     usage.SSDGBHours * m.Prices.SSDGBHour,
+		Network: usage.NetworkGB * m.Prices.NetworkGB,
+	}
+}
+
+// PerMillionRequests 每百万请求的成本
+func (m *CostModel) PerMillionRequests(usage CostUsage) CostBreakdown {
+	return m.Cost(usage).PerMillion(usage.Requests)
+}
+
+func (m *CostModel) GetName() string {
+	return fmt.Sprintf("%s, %s", m.Compute.Name, m.Prices)
+}
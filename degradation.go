@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ============= 降级管理器（ARCH.md KimiDegradationManager） =============
+//
+// 包装分池路由器，按滑动时间窗口内的QPS、负载集中度与错误率逐级降级：
+//   L1 序列池改用Random（禁用前缀匹配）
+//   L2 热点池也改用Random
+//   L3 紧急模式：忽略分池，全部节点Random兜底
+// 升级立即生效；降级恢复需要指标回落到阈值×RecoverRatio以下并在当前级别停留至少MinDwellMs（滞回）。
+
+// DegradationLevel 降级级别
+type DegradationLevel int
+
+const (
+	DegradationNone DegradationLevel = iota
+	DegradationL1
+	DegradationL2
+	DegradationL3
+	degradationLevelCount
+)
+
+func (l DegradationLevel) String() string {
+	if l == DegradationNone {
+		return "L0"
+	}
+	return fmt.Sprintf("L%d", int(l))
+}
+
+// DegradationThresholds 降级阈值
+type DegradationThresholds struct {
+	WindowMs        int     // 指标滑动窗口（毫秒）
+	L1QPS           float64 // QPS超过该值进入L1
+	L2QPS           float64 // QPS超过该值进入L2
+	L2Concentration float64 // 窗口内负载集中度超过该值进入L2
+	L3ErrorRate     float64 // 窗口内错误率超过该值进入L3
+	ErrorTTFTMs     float64 // TTFT超过该值视为错误（超时）
+	RecoverRatio    float64 // 恢复时阈值乘以该系数（<1）
+	MinDwellMs      int     // 降级后至少停留的时间（毫秒）
+	MinSamples      int     // 窗口内样本少于该值时不计算集中度与错误率
+}
+
+// DefaultDegradationThresholds 按本模拟器的规模（个位数QPS、4节点）缩放后的ARCH.md阈值
+func DefaultDegradationThresholds() DegradationThresholds {
+	return DegradationThresholds{
+		WindowMs:        10000,
+		L1QPS:           10,
+		L2QPS:           15,
+		L2Concentration: 0.7,
+		L3ErrorRate:     0.01,
+		ErrorTTFTMs:     1000,
+		RecoverRatio:    0.8,
+		MinDwellMs:      30000,
+		MinSamples:      20,
+	}
+}
+
+// DegradationTransition 一次级别变化
+type DegradationTransition struct {
+	TimestampMs   int
+	From, To      DegradationLevel
+	QPS           float64
+	Concentration float64
+	ErrorRate     float64
+	Reason        string
+}
+
+// DegradationLevelMetrics 各级别下的运行指标（按请求路由时所处级别归类）
+type DegradationLevelMetrics struct {
+	DurationMs int
+	Requests   int
+	Completed  int
+	Hits       int
+	Misses     int
+	Errors     int
+	totalTTFT  float64
+}
+
+func (m *DegradationLevelMetrics) HitRate() float64 {
+	if m.Hits+m.Misses == 0 {
+		return 0
+	}
+	return float64(m.Hits) / float64(m.Hits+m.Misses)
+}
+
+func (m *DegradationLevelMetrics) AvgTTFT() float64 {
+	if m.Completed == 0 {
+		return 0
+	}
+	return m.totalTTFT / float64(m.Completed)
+}
+
+// windowEvent 窗口内的一个事件：到达（node非空表示成功分配）或完成
+type windowEvent struct {
+	timestampMs int
+	node        *PrefillNode
+	isError     bool
+}
+
+// DegradationManager 运行时降级控制器，实现PrefillNodeSelector
+type DegradationManager struct {
+	Router     *PooledRouter
+	Thresholds DegradationThresholds
+	Level      DegradationLevel
+
+	Transitions []DegradationTransition
+	Levels      [degradationLevelCount]DegradationLevelMetrics
+
+	original    [requestTypeCount]PrefillNodeSelector // 降级前各池的选择器
+	fallback    *RandomNodeSelector
+	arrivals    []windowEvent // 窗口内的到达
+	outcomes    []windowEvent // 窗口内的完成/失败
+	lastChange  int
+	lastSeen    int
+	started     bool
+	inflight    map[*Request]DegradationLevel
+	emergencyIn map[*Request]bool // L3下绕过分池路由的请求
+}
+
+func NewDegradationManager(router *PooledRouter, thresholds DegradationThresholds) *DegradationManager {
+	m := &DegradationManager{
+		Router:      router,
+		Thresholds:  thresholds,
+		fallback:    &RandomNodeSelector{},
+		inflight:    make(map[*Request]DegradationLevel),
+		emergencyIn: make(map[*Request]bool),
+	}
+	for t, pool := range router.Pools {
+		m.original[t] = pool.Selector
+	}
+	return m
+}
+
+func (m *DegradationManager) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	now := request.Timestamp
+	if !m.started {
+		m.started, m.lastChange, m.lastSeen = true, now, now
+	}
+	m.Levels[m.Level].DurationMs += now - m.lastSeen
+	m.lastSeen = now
+
+	m.evaluate(now)
+
+	var node *PrefillNode
+	if m.Level == DegradationL3 {
+		node = m.fallback.SelectNode(request, nodes)
+		if node != nil {
+			m.emergencyIn[request] = true
+		}
+	} else {
+		node = m.Router.SelectNode(request, nodes)
+	}
+
+	m.arrivals = append(m.arrivals, windowEvent{timestampMs: now, node: node})
+	m.Levels[m.Level].Requests++
+	if node == nil {
+		// 未能分配视为错误
+		m.outcomes = insertEvent(m.outcomes, windowEvent{timestampMs: now, isError: true})
+		m.Levels[m.Level].Errors++
+		return nil
+	}
+	m.inflight[request] = m.Level
+	return node
+}
+
+// evaluate 计算窗口指标并按滞回规则调整级别
+func (m *DegradationManager) evaluate(now int) {
+	cutoff := now - m.Thresholds.WindowMs
+	m.arrivals = trimWindow(m.arrivals, cutoff)
+	m.outcomes = trimWindow(m.outcomes, cutoff)
+	qps, concentration, errorRate := m.windowMetrics()
+
+	escalate, reason := m.levelFor(qps, concentration, errorRate, 1)
+	recover, _ := m.levelFor(qps, concentration, errorRate, m.Thresholds.RecoverRatio)
+
+	target := m.Level
+	switch {
+	case escalate > m.Level:
+		target = escalate
+	case recover < m.Level && now-m.lastChange >= m.Thresholds.MinDwellMs:
+		target, reason = recover, "指标回落"
+	}
+	if target == m.Level {
+		return
+	}
+
+	m.Transitions = append(m.Transitions, DegradationTransition{
+		TimestampMs:   now,
+		From:          m.Level,
+		To:            target,
+		QPS:           qps,
+		Concentration: concentration,
+		ErrorRate:     errorRate,
+		Reason:        reason,
+	})
+	m.Level = target
+	m.lastChange = now
+	m.apply()
+}
+
+// levelFor 按阈值×scale计算应处的级别与触发原因
+func (m *DegradationManager) levelFor(qps, concentration, errorRate, scale float64) (DegradationLevel, string) {
+	th := m.Thresholds
+	switch {
+	case errorRate > th.L3ErrorRate*scale:
+		return DegradationL3, fmt.Sprintf("错误率%.1f%%", errorRate*100)
+	case concentration > th.L2Concentration*scale:
+		return DegradationL2, fmt.Sprintf("集中度%.0f%%", concentration*100)
+	case qps > th.L2QPS*scale:
+		return DegradationL2, fmt.Sprintf("QPS %.1f", qps)
+	case qps > th.L1QPS*scale:
+		return DegradationL1, fmt.Sprintf("QPS %.1f", qps)
+	}
+	return DegradationNone, ""
+}
+
+// windowMetrics 窗口内的QPS、负载集中度与错误率
+func (m *DegradationManager) windowMetrics() (qps, concentration, errorRate float64) {
+	qps = float64(len(m.arrivals)) / (float64(m.Thresholds.WindowMs) / 1000)
+
+	if len(m.arrivals) >= m.Thresholds.MinSamples {
+		loads := make(map[*PrefillNode]int)
+		assigned, maxLoad := 0, 0
+		for _, event := range m.arrivals {
+			if event.node == nil {
+				continue
+			}
+			loads[event.node]++
+			assigned++
+			maxLoad = max(maxLoad, loads[event.node])
+		}
+		if assigned > 0 {
+			concentration = float64(maxLoad) / float64(assigned)
+		}
+	}
+
+	if len(m.outcomes) >= m.Thresholds.MinSamples {
+		errors := 0
+		for _, event := range m.outcomes {
+			if event.isError {
+				errors++
+			}
+		}
+		errorRate = float64(errors) / float64(len(m.outcomes))
+	}
+	return qps, concentration, errorRate
+}
+
+// insertEvent 按时间顺序插入事件：完成事件记在到达时间+TTFT，可能早于已记录的分配失败事件
+func insertEvent(events []windowEvent, event windowEvent) []windowEvent {
+	i := sort.Search(len(events), func(i int) bool { return events[i].timestampMs > event.timestampMs })
+	events = append(events, windowEvent{})
+	copy(events[i+1:], events[i:])
+	events[i] = event
+	return events
+}
+
+// trimWindow 丢弃早于cutoff的事件（事件按时间有序）
+func trimWindow(events []windowEvent, cutoff int) []windowEvent {
+	i := 0
+	for i < len(events) && events[i].timestampMs <= cutoff {
+		i++
+	}
+	return events[i:]
+}
+
+// apply 按当前级别设置各池的选择器
+func (m *DegradationManager) apply() {
+	for t := range m.Router.Pools {
+		m.Router.SetPoolSelector(RequestType(t), m.original[t])
+	}
+	if m.Level >= DegradationL1 {
+		m.Router.SetPoolSelector(RequestSequence, m.fallback)
+	}
+	if m.Level >= DegradationL2 {
+		m.Router.SetPoolSelector(RequestHotspot, m.fallback)
+	}
+}
+
+// OnRequestCompleted 实现SelectionObserver：记录完成结果（超时计为错误）并转发给路由器
+func (m *DegradationManager) OnRequestCompleted(request *Request, result *PrefillResult) {
+	level, exists := m.inflight[request]
+	if !exists {
+		return
+	}
+	delete(m.inflight, request)
+
+	isError := result.TTFT > m.Thresholds.ErrorTTFTMs
+	m.outcomes = insertEvent(m.outcomes, windowEvent{timestampMs: request.Timestamp + int(result.TTFT), isError: isError})
+
+	metrics := &m.Levels[level]
+	metrics.Completed++
+	metrics.Hits += result.CacheHits
+	metrics.Misses += result.CacheMisses
+	metrics.totalTTFT += result.TTFT
+	if isError {
+		metrics.Errors++
+	}
+
+	if m.emergencyIn[request] {
+		delete(m.emergencyIn, request)
+		return
+	}
+	m.Router.OnRequestCompleted(request, result)
+}
+
+// OnRequestFailed 实现FailureObserver：丢失的请求在失败时刻计为错误，并转发给路由器
+func (m *DegradationManager) OnRequestFailed(request *Request, at float64) {
+	level, exists := m.inflight[request]
+	if !exists {
+		return
+	}
+	delete(m.inflight, request)
+
+	m.outcomes = insertEvent(m.outcomes, windowEvent{timestampMs: int(at), isError: true})
+	m.Levels[level].Errors++
+
+	if m.emergencyIn[request] {
+		delete(m.emergencyIn, request)
+		return
+	}
+	m.Router.OnRequestFailed(request, at)
+}
+
+// BestEffort 实现BestEffortHinter
+func (m *DegradationManager) BestEffort(request *Request) bool {
+	if m.emergencyIn[request] {
+		return false
+	}
+	return m.Router.BestEffort(request)
+}
+
+// TransitionLog 级别变化的可读日志
+func (m *DegradationManager) TransitionLog() string {
+	lines := make([]string, 0, len(m.Transitions))
+	for _, t := range m.Transitions {
+		lines = append(lines, fmt.Sprintf("%7.1fs %s→%s 触发: %s (窗口QPS %.1f, 集中度 %.0f%%, 错误率 %.1f%%)",
+			float64(t.TimestampMs)/1000, t.From, t.To, t.Reason, t.QPS, t.Concentration*100, t.ErrorRate*100))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *DegradationManager) GetName() string {
+	return fmt.Sprintf("Degradation(%s)", m.Router.GetName())
+}
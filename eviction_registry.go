@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ============= 淘汰算法注册表 =============
+
+// EvictionFactory 淘汰算法工厂，每个节点持有独立实例
+type EvictionFactory func() EvictionAlgorithm
+
+var evictionRegistry = map[string]EvictionFactory{
+	"FIFO": func() EvictionAlgorithm { return NewFIFOEviction() },
+	"LRU":  func() EvictionAlgorithm { return NewLRUEviction() },
+	"LFU":  func() EvictionAlgorithm { return NewLFUEviction() },
+}
+
+// RegisterEvictionAlgorithm 注册淘汰算法，同名注册会覆盖已有工厂
+func RegisterEvictionAlgorithm(name string, factory EvictionFactory) {
+	evictionRegistry[name] = factory
+}
+
+// LookupEvictionAlgorithm 按名称查找淘汰算法工厂
+func LookupEvictionAlgorithm(name string) (EvictionFactory, error) {
+	factory, exists := evictionRegistry[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown eviction algorithm %q (available: %v)", name, EvictionAlgorithmNames())
+	}
+	return factory, nil
+}
+
+// EvictionAlgorithmNames 返回已注册的淘汰算法名称（按字母序）
+func EvictionAlgorithmNames() []string {
+	names := make([]string, 0, len(evictionRegistry))
+	for name := range evictionRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============= 故障注入：崩溃、恢复、网络隔离、慢节点 =============
+//
+// 故障事件按模拟时间生效：Simulator.ProcessRequest在处理每个请求前应用所有已到期的事件。
+// 不可调度的节点（崩溃或隔离）不会出现在选择器看到的节点列表中。
+
+// FaultType 故障类型
+type FaultType int
+
+const (
+	FaultCrash     FaultType = iota // 崩溃：缓存清空，在途请求丢失
+	FaultRecover                    // 恢复：以空缓存重新上线
+	FaultPartition                  // 网络隔离：保留缓存但不可调度
+	FaultHeal                       // 隔离解除
+	FaultSlow                       // 慢节点：计算时间乘以SlowFactor（1表示恢复正常）
+)
+
+var faultTypeNames = []string{"crash", "recover", "partition", "heal", "slow"}
+
+func (t FaultType) String() string {
+	return faultTypeNames[t]
+}
+
+// FaultEvent 一个故障事件
+type FaultEvent struct {
+	AtMs       int
+	NodeID     string
+	Type       FaultType
+	SlowFactor float64 // 仅FaultSlow使用
+}
+
+func (e FaultEvent) String() string {
+	if e.Type == FaultSlow {
+		return fmt.Sprintf("%s@%ds:%s×%g", e.Type, e.AtMs/1000, e.NodeID, e.SlowFactor)
+	}
+	return fmt.Sprintf("%s@%ds:%s", e.Type, e.AtMs/1000, e.NodeID)
+}
+
+// ParseFaultEvent 解析"crash@120s:node-1"、"slow@60s:node-2:4"形式的描述
+func ParseFaultEvent(spec string) (FaultEvent, error) {
+	var event FaultEvent
+	kind, rest, found := strings.Cut(spec, "@")
+	if !found {
+		return event, fmt.Errorf("invalid fault %q (expected type@time:node)", spec)
+	}
+	at, target, found := strings.Cut(rest, ":")
+	if !found {
+		return event, fmt.Errorf("invalid fault %q (missing node)", spec)
+	}
+
+	typeIndex := -1
+	for i, name := range faultTypeNames {
+		if name == kind {
+			typeIndex = i
+		}
+	}
+	if typeIndex < 0 {
+		return event, fmt.Errorf("unknown fault type %q", kind)
+	}
+	event.Type = FaultType(typeIndex)
+
+	d, err := time.ParseDuration(at)
+	if err != nil {
+		return event, fmt.Errorf("fault time: %w", err)
+	}
+	if d < 0 {
+		return event, fmt.Errorf("fault time must not be negative: %s", at)
+	}
+	event.AtMs = int(d.Milliseconds())
+
+	event.NodeID = target
+	if event.Type == FaultSlow {
+		nodeID, factor, found := strings.Cut(target, ":")
+		if !found {
+			return event, fmt.Errorf("slow fault %q needs a factor (slow@time:node:factor)", spec)
+		}
+		event.NodeID = nodeID
+		if event.SlowFactor, err = strconv.ParseFloat(factor, 64); err != nil {
+			return event, fmt.Errorf("slow factor: %w", err)
+		}
+		if !(event.SlowFactor >= 1) || math.IsInf(event.SlowFactor, 1) {
+			return event, fmt.Errorf("slow factor must be >= 1, got %v", event.SlowFactor)
+		}
+	}
+	return event, nil
+}
+
+// FaultRecord 已应用的故障及其影响
+type FaultRecord struct {
+	Event        FaultEvent
+	BlocksLost   int // 崩溃时丢失的缓存块数
+	UniqueLost   int // 其中在其他节点上没有副本的块数
+	RequestsLost int // 丢失的在途请求数
+}
+
+// HitRateBucket 固定时间桶内的集群命中统计
+type HitRateBucket struct {
+	StartMs int
+	Hits    int
+	Misses  int
+}
+
+const hitRateBucketMs = 5000
+
+// availableNodes 过滤出可调度的节点（无故障时返回原切片）
+func availableNodes(nodes []*PrefillNode) []*PrefillNode {
+	for i, node := range nodes {
+		if node.Down || node.Partitioned {
+			available := append([]*PrefillNode{}, nodes[:i]...)
+			for _, n := range nodes[i+1:] {
+				if !n.Down && !n.Partitioned {
+					available = append(available, n)
+				}
+			}
+			return available
+		}
+	}
+	return nodes
+}
+
+// SetFaultSchedule 设置故障事件（按时间排序后依次生效），事件的目标必须是现有节点
+func (s *Simulator) SetFaultSchedule(events []FaultEvent) error {
+	for _, event := range events {
+		if s.findNode(event.NodeID) == nil {
+			return fmt.Errorf("fault %s: unknown node %q", event, event.NodeID)
+		}
+	}
+	s.faults = append([]FaultEvent{}, events...)
+	sort.SliceStable(s.faults, func(i, j int) bool { return s.faults[i].AtMs < s.faults[j].AtMs })
+	return nil
+}
+
+func (s *Simulator) findNode(id string) *PrefillNode {
+	for _, node := range s.nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) applyFault(event FaultEvent) {
+	record := FaultRecord{Event: event}
+	node := s.findNode(event.NodeID)
+	if node == nil {
+		return // 目标节点已被缩容移除，事件不再生效
+	}
+	switch event.Type {
+	case FaultCrash:
+		if node.Down {
+			break
+		}
+		if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+			record.RequestsLost = processor.failNode(node, float64(event.AtMs))
+		}
+		record.BlocksLost, record.UniqueLost = s.crashNode(node)
+	case FaultRecover:
+		node.Down = false
+	case FaultPartition:
+		node.Partitioned = true
+	case FaultHeal:
+		node.Partitioned = false
+	case FaultSlow:
+		node.SlowFactor = event.SlowFactor
+	}
+	s.faultLog = append(s.faultLog, record)
+}
+
+// crashNode 清空节点缓存，返回丢失的块数与其中没有其他副本的块数
+func (s *Simulator) crashNode(node *PrefillNode) (lost int, unique int) {
+	node.Down = true
+	for hashID := range node.CacheBlocks {
+		replicated := false
+		for _, other := range s.nodes {
+			if other == node || other.Down {
+				continue
+			}
+			if _, exists := other.CacheBlocks[hashID]; exists {
+				replicated = true
+				break
+			}
+		}
+		if !replicated {
+			unique++
+		}
+		node.RemoveBlock(hashID)
+		lost++
+	}
+	node.RequestQueue = nil
+	return lost, unique
+}
+
+// FaultLog 已应用的故障记录
+func (s *Simulator) FaultLog() []FaultRecord {
+	return s.faultLog
+}
+
+// HitRateTimeline 按5秒分桶的集群命中统计
+func (s *Simulator) HitRateTimeline() []HitRateBucket {
+	return s.hitTimeline
+}
+
+// HitRateRecovery 故障后的命中率恢复情况
+type HitRateRecovery struct {
+	Baseline   float64 // 故障前windowMs内的命中率
+	Trough     float64 // 故障后滚动命中率的最低值
+	RecoveryMs int     // 滚动命中率首次回到基准×ratio的耗时（毫秒），未恢复为-1
+}
+
+// MeasureHitRateRecovery 以同样长度的滚动窗口衡量[faultMs, untilMs)内的命中率下跌与恢复，
+// 只统计完全位于故障之后的窗口，因此恢复耗时至少为windowMs
+func MeasureHitRateRecovery(timeline []HitRateBucket, faultMs, untilMs, windowMs int, ratio float64) HitRateRecovery {
+	rate := func(from, to int) (float64, bool) {
+		hits, total := 0, 0
+		for _, b := range timeline {
+			if b.StartMs >= from && b.StartMs < to {
+				hits += b.Hits
+				total += b.Hits + b.Misses
+			}
+		}
+		if total == 0 {
+			return 0, false
+		}
+		return float64(hits) / float64(total), true
+	}
+
+	recovery := HitRateRecovery{RecoveryMs: -1}
+	baseline, ok := rate(faultMs-windowMs, faultMs)
+	if !ok {
+		return recovery
+	}
+	recovery.Baseline, recovery.Trough = baseline, baseline
+	for _, b := range timeline {
+		end := b.StartMs + hitRateBucketMs
+		if b.StartMs < faultMs || end-faultMs < windowMs {
+			continue
+		}
+		if end > untilMs {
+			break
+		}
+		current, ok := rate(end-windowMs, end)
+		if !ok {
+			continue
+		}
+		recovery.Trough = math.Min(recovery.Trough, current)
+		if recovery.RecoveryMs < 0 && current >= baseline*ratio {
+			recovery.RecoveryMs = end - faultMs
+		}
+	}
+	return recovery
+}
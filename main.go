@@ -2,11 +2,24 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runSubcommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := parseValidationFlags(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("Mooncake KV Cache 分布式缓存策略测试")
 	fmt.Println(strings.Repeat("=", 60))
 
@@ -19,11 +32,17 @@ func main() {
 func runDirectValidation() {
 	// 加载数据
 	fmt.Println("加载测试数据...")
-	requests, err := LoadRequests("mooncake_trace.jsonl")
+	requests, skipped, err := LoadRequestsWithOptions("mooncake_trace.jsonl", TraceLoadOptions{MaxErrors: 5})
 	if err != nil {
 		fmt.Printf("❌ 数据加载失败: %v\n", err)
 		return
 	}
+	if skipped.Count > 0 {
+		fmt.Printf("⚠️  跳过%d条非法记录\n", skipped.Count)
+		for _, lineErr := range skipped.Errors {
+			fmt.Printf("    %v\n", lineErr)
+		}
+	}
 
 	testRequests := requests
 
@@ -40,12 +59,17 @@ func runDirectValidation() {
 		{"Enhanced-增强策略(β=1.2缓存负载均衡)", NewEnhancedCacheAwareSelector(0.6, 1.2)},
 		{"PrefixAwareHotspot-前缀感知热点迁移(论文方法)", NewPrefixAwareHotspotSelector(0.6, 0.8, 0.4, 0.1)},
 		{"PrefixAwareHotspot-前缀优化版(强化前缀权重)", NewPrefixAwareHotspotSelector(0.5, 0.6, 0.8, 0.15)},
+		{"PowerOfTwo-两选一(缓存亲和打破平局)", NewPowerOfDChoicesSelector(2, 42)},
+		{"ConsistentHash-有界负载一致性哈希(k=4,c=1.25)", NewConsistentHashSelector(4, 1.25, 100)},
+		{"LongestPrefix-最长前缀匹配(SGLang路由,1.5×最小负载)", NewLongestPrefixSelector(1.5, 32, 0.3)},
+		{"SLOAware-TTFT预测(SLO=200ms,超标降级)", NewSLOAwareSelector(NewTTFTCostModel(defaultNetworkBandwidth), 200, SLODeprioritize)},
+		{"Pooled-分池路由(常规/热点/序列 70/20/10)", NewDefaultPooledRouter()},
 	}
 
 	fmt.Println("\n📊 策略性能测试结果:")
-	fmt.Println(strings.Repeat("-", 70))
-	fmt.Printf("%-45s %10s %10s\n", "策略名称", "命中率", "负载集中度")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Println(strings.Repeat("-", 90))
+	fmt.Printf("%-45s %10s %10s %10s %10s\n", "策略名称", "命中率", "负载集中度", "平均TTFT", "P99 TTFT")
+	fmt.Println(strings.Repeat("-", 90))
 
 	results := make([]TestResult, 0)
 
@@ -53,16 +77,737 @@ func runDirectValidation() {
 		result := runQuickTest(strategy.selector, testRequests, strategy.name)
 		results = append(results, result)
 
-		fmt.Printf("%-45s %9.1f%% %9.1f%%\n",
+		fmt.Printf("%-45s %9.1f%% %9.1f%% %8.1fms %8.1fms\n",
 			strategy.name,
 			result.HitRate*100,
-			result.Concentration*100)
+			result.Concentration*100,
+			result.AvgTTFT,
+			result.P99TTFT)
 	}
 
-	fmt.Println(strings.Repeat("-", 65))
+	fmt.Println(strings.Repeat("-", 90))
+
+	// 显示关键数据对比（单价可由-cost-config覆盖）
+	showDataComparison(results, validation.costModel)
+
+	// 缓存准入策略对比
+	runAdmissionComparison(testRequests)
+
+	// TTL与前缀失效
+	runCacheExpiryComparison(testRequests)
+
+	// 老虎机在线策略切换
+	runBanditComparison(testRequests)
+
+	// 分池路由的池内指标
+	runPooledRoutingReport(testRequests)
 
-	// 显示关键数据对比
-	showDataComparison(results)
+	// 降级管理器
+	runDegradationComparison(testRequests)
+
+	// 故障注入
+	runFaultInjectionComparison(testRequests)
+
+	// 弹性伸缩
+	runScalingComparison(testRequests)
+
+	// 过载准入控制
+	runOverloadAdmissionComparison(testRequests)
+
+	// 租户隔离
+	runTenantIsolationComparison(testRequests)
+
+	// 多模型共享集群
+	runMultiModelComparison(testRequests)
+
+	// 会话粘性路由
+	runSessionRoutingComparison()
+
+	// 分块prefill
+	runChunkedPrefillComparison(testRequests)
+
+	// 节点批处理调度
+	runBatchSchedulingComparison(testRequests)
+}
+
+// runBatchSchedulingComparison 对比单服务台与迭代级批处理调度在不同负载下的排队与TTFT
+func runBatchSchedulingComparison(requests []*Request) {
+	model := DefaultComputeModel()
+	model.OverheadMs = batchOverheadMs
+	configs := []struct {
+		name  string
+		batch *BatchConfig
+	}{
+		{"单服务台(无迭代开销)", nil},
+		{"逐请求(批大小1)", &BatchConfig{MaxBatchTokens: 8192, MaxBatchSize: 1, Model: model}},
+		{"批处理(32k token/32请求)", &BatchConfig{MaxBatchTokens: 32768, MaxBatchSize: 32, Model: model}},
+		{"批处理+分块预算8k", &BatchConfig{MaxBatchTokens: 32768, MaxBatchSize: 32, ChunkBudget: 8192, Model: model}},
+	}
+
+	fmt.Printf("\n📦 节点批处理调度对比 (4节点, LongestPrefix, %s):\n", model.GetName())
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-10s %-26s %10s %10s %10s %10s\n", "到达率", "调度", "平均排队", "平均TTFT", "P50 TTFT", "P99 TTFT")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, factor := range []float64{1, 4, 8} {
+		trace := ScaleTimestamps(requests, factor)
+		for i, config := range configs {
+			sim := newValidationSimulator(4, 500, NewLongestPrefixSelector(1.5, 32, 0.3), validation.evictionAlgo)
+			if err := sim.SetBatchScheduler(config.batch); err != nil {
+				fmt.Printf("❌ %s: %v\n", config.name, err)
+				return
+			}
+			for _, request := range trace {
+				sim.ProcessRequest(request)
+			}
+			sim.Drain()
+			stats := sim.processor.GetStatistics()
+
+			load := ""
+			if i == 0 {
+				load = fmt.Sprintf("×%g", factor)
+			}
+			fmt.Printf("%-10s %-26s %8.1fms %8.1fms %8.1fms %8.1fms\n",
+				load, config.name, stats.AvgQueueTime, stats.AvgTTFT, stats.P50TTFT, stats.P99TTFT)
+		}
+	}
+}
+
+// 批处理对比中每次迭代的固定开销（毫秒）
+const batchOverheadMs = 10.0
+
+// runChunkedPrefillComparison 对比整请求单节点prefill与超长请求分块流水线的TTFT（分长/短上下文）
+func runChunkedPrefillComparison(requests []*Request) {
+	const longTokens = 16 * 1024
+	configs := []struct {
+		name   string
+		config *ChunkedPrefillConfig
+	}{
+		{"不分块", nil},
+		{"分块(≤2节点)", &ChunkedPrefillConfig{ThresholdTokens: longTokens, ChunkTokens: 8 * 1024, MaxNodes: 2, Layers: 80}},
+		{"分块(≤4节点)", &ChunkedPrefillConfig{ThresholdTokens: longTokens, ChunkTokens: 4 * 1024, MaxNodes: 4, Layers: 80}},
+		{"分块(≤4节点,阈值8k)", &ChunkedPrefillConfig{ThresholdTokens: 8 * 1024, ChunkTokens: 4 * 1024, MaxNodes: 4, Layers: 80}},
+	}
+
+	for _, factor := range []float64{1, chunkedLoadFactor} {
+		trace := requests
+		if factor != 1 {
+			trace = ScaleTimestamps(requests, factor)
+		}
+		fmt.Printf("\n🧩 分块prefill对比 (4节点, 到达率×%g, LongestPrefix, 长上下文>%dk token):\n", factor, longTokens/1024)
+		fmt.Println(strings.Repeat("-", 110))
+		fmt.Printf("%-22s %8s %8s %12s %12s %12s %12s %10s\n", "配置", "命中率", "分块请求", "长请求TTFT", "长请求P99", "短请求TTFT", "短请求P99", "整体P99")
+		fmt.Println(strings.Repeat("-", 110))
+		for _, config := range configs {
+			sim := newValidationSimulator(4, 500, NewLongestPrefixSelector(1.5, 32, 0.3), validation.evictionAlgo)
+			sim.SetChunkedPrefill(config.config)
+			lengths := &ContextLengthTTFT{ThresholdTokens: longTokens}
+			sim.processor.(*BasicPrefillProcessor).AddObserver(lengths)
+			for _, request := range trace {
+				sim.ProcessRequest(request)
+			}
+			sim.Drain()
+			stats := sim.processor.GetStatistics()
+
+			longAvg, longP99 := summarizeTTFT(lengths.Long)
+			shortAvg, shortP99 := summarizeTTFT(lengths.Short)
+			fmt.Printf("%-22s %7.1f%% %8d %10.1fms %10.1fms %10.1fms %10.1fms %8.1fms\n",
+				config.name, stats.HitRate*100, stats.ChunkedRequests, longAvg, longP99, shortAvg, shortP99, stats.P99TTFT)
+		}
+	}
+}
+
+// 分块prefill对比的加压倍数：分块占用多个节点，高负载下会挤占短请求
+const chunkedLoadFactor = 4.0
+
+// runSessionRoutingComparison 在多轮对话密集的合成负载上，对比各选择器与会话粘性路由的跨轮复用
+func runSessionRoutingComparison() {
+	cfg := DefaultWorkloadConfig()
+	cfg.NumRequests = 3000
+	cfg.Arrival = &PoissonArrival{RatePerSec: sessionArrivalRate}
+	cfg.SessionContinueProb = 0.7
+	cfg.MaxActiveSessions = 200
+	generator, err := NewWorkloadGenerator(cfg)
+	if err != nil {
+		fmt.Printf("❌ 合成负载配置无效: %v\n", err)
+		return
+	}
+	trace := generator.Generate()
+	anonymous := make([]*Request, len(trace))
+	for i, r := range trace {
+		anonymous[i] = cloneRequest(r)
+		anonymous[i].SessionID = ""
+	}
+
+	configs := []struct {
+		name     string
+		selector PrefillNodeSelector
+		infer    bool // 去掉会话ID，由选择器按前缀链推断
+	}{
+		{"Random", &RandomNodeSelector{}, false},
+		{"LongestPrefix", NewLongestPrefixSelector(1.5, 32, 0.3), false},
+		{"Sticky(Random,不打破)", NewStickySessionSelector(&RandomNodeSelector{}, 0), false},
+		{"Sticky(Random,积压>200ms打破)", NewStickySessionSelector(&RandomNodeSelector{}, 200), false},
+		{"Sticky(LongestPrefix,积压>200ms打破)", NewStickySessionSelector(NewLongestPrefixSelector(1.5, 32, 0.3), 200), false},
+		{"Sticky(LongestPrefix,200ms,推断会话)", NewStickySessionSelector(NewLongestPrefixSelector(1.5, 32, 0.3), 200), true},
+	}
+
+	fmt.Printf("\n💬 会话粘性路由对比 (合成多轮负载%d请求, %g请求/秒, 续轮概率%.0f%%, LRU):\n",
+		cfg.NumRequests, sessionArrivalRate, cfg.SessionContinueProb*100)
+	fmt.Println(strings.Repeat("-", 110))
+	fmt.Printf("%-36s %8s %10s %10s %10s %10s %10s %8s\n", "选择器", "命中率", "平均TTFT", "P99 TTFT", "跨轮复用", "同节点", "保持粘性", "打破")
+	fmt.Println(strings.Repeat("-", 110))
+	var summary SessionSummary
+	for _, config := range configs {
+		sim := newValidationSimulator(4, 500, config.selector, evictionRegistry["LRU"])
+		metrics := NewSessionMetrics()
+		sim.processor.(*BasicPrefillProcessor).AddObserver(metrics)
+		input := trace
+		if config.infer {
+			input = anonymous
+		}
+		for _, request := range input {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+		current := metrics.Summary()
+		if !config.infer {
+			summary = current
+		}
+
+		sticky, broken := "-", "-"
+		if selector, ok := config.selector.(*StickySessionSelector); ok {
+			sticky = fmt.Sprintf("%.1f%%", selector.Stats.StickyRate()*100)
+			broken = fmt.Sprintf("%d", selector.Stats.Broken)
+		}
+		fmt.Printf("%-36s %7.1f%% %8.1fms %8.1fms %9.1f%% %9.1f%% %10s %8s\n",
+			config.name, stats.HitRate*100, stats.AvgTTFT, stats.P99TTFT,
+			current.ReuseRate()*100, current.AffinityRate()*100, sticky, broken)
+	}
+	fmt.Printf("生成器会话: %d个（多轮%d个），共%d轮，其中后续轮次%d个\n",
+		summary.Sessions, summary.MultiTurn, summary.Turns, summary.FollowUps)
+}
+
+// 会话粘性对比的到达率：加压后粘性节点才会出现积压
+const sessionArrivalRate = 8.0
+
+// runMultiModelComparison 三个模型按流量占比混合，对比专用节点与共享集群（有无KV内存分区）
+func runMultiModelComparison(requests []*Request) {
+	models := []string{"llama-70b", "qwen-72b", "mixtral-8x7b"}
+	weights := []float64{0.6, 0.3, 0.1}
+	trace := AssignModels(ScaleTimestamps(requests, 2), models, weights)
+
+	shared := func(shares []float64) func(node int) map[string]float64 {
+		return func(int) map[string]float64 {
+			hosted := make(map[string]float64, len(models))
+			for i, model := range models {
+				hosted[model] = shares[i]
+			}
+			return hosted
+		}
+	}
+	configs := []struct {
+		name  string
+		hosts func(node int) map[string]float64
+	}{
+		{"专用节点(3/2/1)", func(node int) map[string]float64 {
+			switch {
+			case node < 3:
+				return map[string]float64{models[0]: 0}
+			case node < 5:
+				return map[string]float64{models[1]: 0}
+			}
+			return map[string]float64{models[2]: 0}
+		}},
+		{"共享(不分区)", shared([]float64{0, 0, 0})},
+		{"共享(按流量分区)", shared(weights)},
+		{"共享(均分分区)", shared([]float64{1.0 / 3, 1.0 / 3, 1.0 / 3})},
+	}
+
+	fmt.Printf("\n🧠 多模型共享集群对比 (6节点, 到达率×2, 按首个block分配模型 %v 权重%v, LongestPrefix):\n", models, weights)
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-18s %-14s %8s %8s %10s %10s %10s\n", "配置", "模型", "请求数", "命中率", "平均TTFT", "P99 TTFT", "分区淘汰")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, config := range configs {
+		sim := newValidationSimulator(6, 500, NewLongestPrefixSelector(1.5, 32, 0.3), validation.evictionAlgo)
+		for i, node := range sim.nodes {
+			node.HostModels(config.hosts(i))
+		}
+		for _, request := range trace {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+
+		fmt.Printf("%-18s %-14s %8d %7.1f%% %8.1fms %8.1fms %10s\n",
+			config.name, "(全部)", stats.TotalRequests, stats.HitRate*100, stats.AvgTTFT, stats.P99TTFT, "-")
+		for _, model := range models {
+			m := stats.ModelStats[model]
+			if m == nil {
+				continue
+			}
+			fmt.Printf("%-18s %-14s %8d %7.1f%% %8.1fms %8.1fms %10d\n",
+				"", model, m.Requests, m.HitRate*100, m.AvgTTFT, m.P99TTFT, m.QuotaEvictions)
+		}
+	}
+}
+
+// runTenantIsolationComparison 大客户系统提示词流量与交互用户混合时，对比优先级队列与缓存配额的隔离效果
+func runTenantIsolationComparison(requests []*Request) {
+	mixed := buildTenantTrace(requests)
+
+	configs := []struct {
+		name     string
+		priority bool
+		quotas   *TenantQuotas
+	}{
+		{name: "无隔离"},
+		{name: "优先级队列", priority: true},
+		{name: "缓存配额", quotas: NewTenantQuotas(1).Set("enterprise", 0.3)},
+		{name: "优先级+配额", priority: true, quotas: NewTenantQuotas(1).Set("enterprise", 0.3)},
+	}
+
+	fmt.Printf("\n🏢 租户隔离对比 (interactive: 原始轨迹×%g 优先级1; enterprise: %d个系统提示词 优先级0; 共%d个请求):\n",
+		tenantInteractiveFactor, len(tenantSystemPrompts), len(mixed))
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-14s %-12s %8s %8s %10s %10s %10s %10s\n", "配置", "租户", "请求数", "命中率", "平均排队", "平均TTFT", "P99 TTFT", "配额淘汰")
+	fmt.Println(strings.Repeat("-", 100))
+	alone := runQuickTest(NewLongestPrefixSelector(1.5, 32, 0.3), ScaleTimestamps(requests, tenantInteractiveFactor), "interactive")
+	fmt.Printf("%-14s %-12s %8d %7.1f%% %10s %8.1fms %8.1fms %10s\n",
+		"单独运行", "interactive", len(requests), alone.HitRate*100, "-", alone.AvgTTFT, alone.P99TTFT, "-")
+	for _, config := range configs {
+		trace := mixed
+		if !config.priority {
+			trace = make([]*Request, len(mixed))
+			for i, r := range mixed {
+				trace[i] = cloneRequest(r)
+				trace[i].Priority = 0
+			}
+		}
+		sim := newValidationSimulator(4, 500, NewLongestPrefixSelector(1.5, 32, 0.3), validation.evictionAlgo)
+		if config.quotas != nil {
+			sim.SetTenantQuotas(config.quotas)
+		}
+		for _, request := range trace {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+
+		for i, tenant := range []string{"interactive", "enterprise"} {
+			t := stats.TenantStats[tenant]
+			if t == nil {
+				continue
+			}
+			name := ""
+			if i == 0 {
+				name = config.name
+			}
+			fmt.Printf("%-14s %-12s %8d %7.1f%% %8.1fms %8.1fms %8.1fms %10d\n",
+				name, tenant, t.Requests, t.HitRate*100, t.AvgQueueTime, t.AvgTTFT, t.P99TTFT, t.QuotaEvictions)
+		}
+	}
+}
+
+// 租户隔离对比的负载：交互用户为原始轨迹加速，大客户为若干共享长系统提示词的持续流量。
+// 大客户合计6请求/秒，与交互流量合起来接近但不超过4个节点的处理能力：
+// 无隔离时交互请求被长请求挤占排队，而系统不至于整体过载（过载时任何隔离手段都无济于事）
+const tenantInteractiveFactor = 3.0
+
+var tenantSystemPrompts = []HotspotBurst{
+	{RatePerSec: 2, PrefixBlocks: 32, SuffixBlocks: 24, OutputLength: 256},
+	{RatePerSec: 2, PrefixBlocks: 24, SuffixBlocks: 24, OutputLength: 256},
+	{RatePerSec: 2, PrefixBlocks: 16, SuffixBlocks: 24, OutputLength: 256},
+}
+
+// buildTenantTrace 交互用户轨迹（优先级1）混入大客户系统提示词流量（优先级0）
+func buildTenantTrace(requests []*Request) []*Request {
+	interactive := WithTenant(ScaleTimestamps(requests, tenantInteractiveFactor), "interactive", 1)
+	if len(interactive) == 0 {
+		return interactive
+	}
+	start, end := interactive[0].Timestamp, interactive[len(interactive)-1].Timestamp
+	bursts := make([]HotspotBurst, len(tenantSystemPrompts))
+	for i, burst := range tenantSystemPrompts {
+		burst.StartMs, burst.DurationMs = start, end-start
+		bursts[i] = burst
+	}
+	mixed := InjectHotspotBursts(interactive, bursts, 42)
+	for _, r := range mixed {
+		if r.TenantID == "" {
+			r.TenantID = "enterprise"
+		}
+	}
+	return mixed
+}
+
+// runOverloadAdmissionComparison 在过载轨迹上对比各请求准入策略的有效吞吐、拒绝率与浪费的prefill计算
+func runOverloadAdmissionComparison(requests []*Request) {
+	const sloMs = 500
+	stressed := ScaleTimestamps(requests, overloadFactor)
+
+	policies := []struct {
+		name   string
+		policy func(model *TTFTCostModel, decode *DecodeLoadTracker) RequestAdmissionPolicy
+	}{
+		{"不控制", func(*TTFTCostModel, *DecodeLoadTracker) RequestAdmissionPolicy { return &NoAdmissionControl{} }},
+		{"队列阈值(拒绝)", func(*TTFTCostModel, *DecodeLoadTracker) RequestAdmissionPolicy {
+			return &QueueThresholdPolicy{MaxQueue: 2}
+		}},
+		{"队列阈值(推迟)", func(*TTFTCostModel, *DecodeLoadTracker) RequestAdmissionPolicy {
+			return &QueueThresholdPolicy{MaxQueue: 2, Defer: true}
+		}},
+		{"预测TTFT(拒绝)", func(model *TTFTCostModel, _ *DecodeLoadTracker) RequestAdmissionPolicy {
+			return &PredictedTTFTPolicy{Model: model, SLOMs: sloMs}
+		}},
+		{"预测TTFT(推迟)", func(model *TTFTCostModel, _ *DecodeLoadTracker) RequestAdmissionPolicy {
+			return &PredictedTTFTPolicy{Model: model, SLOMs: sloMs, Defer: true}
+		}},
+		{"提前拒绝(Mooncake)", func(model *TTFTCostModel, decode *DecodeLoadTracker) RequestAdmissionPolicy {
+			return &EarlyRejectionPolicy{Model: model, Decode: decode, SLOMs: sloMs, Threshold: 0.95}
+		}},
+	}
+
+	fmt.Printf("\n🚦 过载准入控制对比 (到达率×%g, SLOAware, TTFT SLO %dms, decode %d槽位×%gms/token):\n",
+		overloadFactor, sloMs, overloadDecodeSlots, overloadDecodeMsPerToken)
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-20s %10s %8s %8s %8s %10s %12s %10s\n", "准入策略", "有效吞吐", "入口拒绝", "推迟", "拒绝率", "prefill后拒绝", "浪费prefill", "P99 TTFT")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, p := range policies {
+		model := NewTTFTCostModel(defaultNetworkBandwidth)
+		decode := NewDecodeLoadTracker(overloadDecodeSlots, overloadDecodeMsPerToken)
+		sim := newValidationSimulator(4, 500, NewSLOAwareSelector(model, sloMs, SLODeprioritize), validation.evictionAlgo)
+		controller := NewAdmissionController(p.policy(model, decode), decode, sloMs)
+		if err := sim.SetAdmissionController(controller); err != nil {
+			fmt.Printf("❌ %s: %v\n", p.name, err)
+			return
+		}
+		for _, request := range stressed {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+		admission := &controller.Stats
+
+		fmt.Printf("%-20s %8.2f/s %8d %8d %7.1f%% %10d %10.1fs %8.1fms\n",
+			p.name, admission.Goodput(), admission.Rejected, admission.DeferredRequests, admission.RejectionRate()*100,
+			admission.PostPrefillRejected, admission.WastedPrefillMs/1000, stats.P99TTFT)
+	}
+}
+
+// 过载准入对比的负载与decode集群规模
+const (
+	overloadFactor           = 12.0
+	overloadDecodeSlots      = 256
+	overloadDecodeMsPerToken = 20.0
+)
+
+// runScalingComparison 在加压轨迹上对比固定规模、计划伸缩与自动伸缩（有无预热）的资源成本与延迟
+func runScalingComparison(requests []*Request) {
+	stressed := ScaleTimestampsPiecewise(requests, scalingLoadProfile)
+	if len(stressed) == 0 {
+		return
+	}
+	start, span := stressed[0].Timestamp, stressed[len(stressed)-1].Timestamp-stressed[0].Timestamp
+	at := func(fraction float64) int { return start + int(float64(span)*fraction) }
+
+	configs := []struct {
+		name       string
+		nodes      int
+		schedule   []ScalingEvent
+		autoscaler func() Autoscaler
+		warmup     bool
+	}{
+		{name: "固定4节点", nodes: 4},
+		{name: "固定8节点", nodes: 8},
+		{name: "计划伸缩4→8→4", nodes: 4, schedule: []ScalingEvent{{AtMs: at(1.0 / 3), Delta: 4}, {AtMs: at(2.0 / 3), Delta: -4}}},
+		{name: "自动伸缩", nodes: 4, autoscaler: newScalingAutoscaler},
+		{name: "自动伸缩+预热", nodes: 4, autoscaler: newScalingAutoscaler, warmup: true},
+	}
+
+	// 选择器按节点实际积压路由：基于近期分配计数的选择器会把新节点的零计数当作空闲，冷启动时集中涌入
+	fmt.Printf("\n📈 弹性伸缩对比 (到达率分三段×%v, SLOAware, 共%d个请求):\n", scalingLoadProfile, len(stressed))
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-16s %10s %8s %8s %10s %10s %8s %8s %8s\n", "配置", "节点·秒", "平均节点", "命中率", "平均TTFT", "P99 TTFT", "伸缩次数", "预热块", "迁移块")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, config := range configs {
+		sim := newValidationSimulator(config.nodes, 500, NewSLOAwareSelector(NewTTFTCostModel(defaultNetworkBandwidth), 200, SLODeprioritize), validation.evictionAlgo)
+		sim.SetScalingSchedule(config.schedule)
+		if config.autoscaler != nil {
+			sim.SetAutoscaler(config.autoscaler(), config.warmup)
+		}
+		for _, request := range stressed {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+
+		warmed, migrated := 0, 0
+		for _, record := range sim.ScalingLog() {
+			warmed += record.WarmedBlocks
+			migrated += record.MigratedBlocks
+		}
+		avgNodes := 0.0
+		if span > 0 {
+			avgNodes = sim.NodeSeconds() * 1000 / float64(span)
+		}
+		fmt.Printf("%-16s %10.0f %8.2f %7.1f%% %8.1fms %8.1fms %8d %8d %8d\n",
+			config.name, sim.NodeSeconds(), avgNodes, stats.HitRate*100, stats.AvgTTFT, stats.P99TTFT,
+			len(sim.ScalingLog()), warmed, migrated)
+	}
+}
+
+// scalingLoadProfile 弹性伸缩对比的分段到达率倍数（中段高峰）
+var scalingLoadProfile = []float64{2, 10, 2}
+
+func newScalingAutoscaler() Autoscaler {
+	return NewQueueLengthAutoscaler(1.0, 0.3, 2, 8, 10000)
+}
+
+// 故障注入对比的节点数（-fault只能指向node-0..node-3）
+const faultComparisonNodes = 4
+
+// runFaultInjectionComparison 在同一故障时间表下对比各策略的命中率下跌、恢复与副本丢失
+func runFaultInjectionComparison(requests []*Request) {
+	if len(requests) == 0 {
+		return
+	}
+	start, span := requests[0].Timestamp, requests[len(requests)-1].Timestamp-requests[0].Timestamp
+	at := func(fraction float64) int { return start + int(float64(span)*fraction) }
+	schedule := []FaultEvent{
+		{AtMs: at(0.25), NodeID: "node-1", Type: FaultCrash},
+		{AtMs: at(0.40), NodeID: "node-1", Type: FaultRecover},
+		{AtMs: at(0.55), NodeID: "node-2", Type: FaultPartition},
+		{AtMs: at(0.65), NodeID: "node-2", Type: FaultHeal},
+		{AtMs: at(0.75), NodeID: "node-3", Type: FaultSlow, SlowFactor: 4},
+		{AtMs: at(0.90), NodeID: "node-3", Type: FaultSlow, SlowFactor: 1},
+	}
+	if len(validation.faults) > 0 {
+		schedule = make([]FaultEvent, len(validation.faults))
+		for i, event := range validation.faults {
+			event.AtMs += start
+			schedule[i] = event
+		}
+	}
+	// 恢复情况按最早的一次崩溃统计，到该节点恢复（或轨迹结束）为止
+	var crashEvent *FaultEvent
+	for i, event := range schedule {
+		if event.Type == FaultCrash && (crashEvent == nil || event.AtMs < crashEvent.AtMs) {
+			crashEvent = &schedule[i]
+		}
+	}
+	recoverAt := start + span + 1
+	if crashEvent != nil {
+		for _, event := range schedule {
+			if event.Type == FaultRecover && event.NodeID == crashEvent.NodeID && event.AtMs > crashEvent.AtMs {
+				recoverAt = min(recoverAt, event.AtMs)
+			}
+		}
+	}
+	names := make([]string, len(schedule))
+	for i, event := range schedule {
+		names[i] = event.String()
+	}
+
+	strategies := []struct {
+		name     string
+		selector func() PrefillNodeSelector
+	}{
+		{"Random", func() PrefillNodeSelector { return &RandomNodeSelector{} }},
+		{"CacheAware", func() PrefillNodeSelector { return &CacheAwareSelector{} }},
+		{"PrefixAware(论文)", func() PrefillNodeSelector { return NewPrefixAwareHotspotSelector(0.6, 0.8, 0.4, 0.1) }},
+		{"PowerOfTwo", func() PrefillNodeSelector { return NewPowerOfDChoicesSelector(2, 42) }},
+		{"CHBL", func() PrefillNodeSelector { return NewConsistentHashSelector(4, 1.25, 100) }},
+		{"LongestPrefix", func() PrefillNodeSelector { return NewLongestPrefixSelector(1.5, 32, 0.3) }},
+	}
+
+	fmt.Println("\n💥 故障注入对比:")
+	fmt.Printf("  时间表: %s\n", strings.Join(names, ", "))
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-18s %8s %10s %8s %14s %18s %10s\n", "策略", "命中率", "P99 TTFT", "丢失请求", "崩溃丢块(独有)", "崩溃期命中率 基准→最低", "恢复耗时")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, strategy := range strategies {
+		sim := newValidationSimulator(faultComparisonNodes, 500, strategy.selector(), validation.evictionAlgo)
+		if err := sim.SetFaultSchedule(schedule); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		for _, request := range requests {
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+
+		var crash FaultRecord
+		recovery, recoveryText := HitRateRecovery{RecoveryMs: -1}, "无崩溃"
+		if crashEvent != nil {
+			for _, record := range sim.FaultLog() {
+				if record.Event == *crashEvent {
+					crash = record
+					break
+				}
+			}
+			recovery = MeasureHitRateRecovery(sim.HitRateTimeline(), crashEvent.AtMs, recoverAt, 10000, 0.95)
+			recoveryText = "未恢复"
+			if recovery.RecoveryMs >= 0 {
+				recoveryText = fmt.Sprintf("%.0fs", float64(recovery.RecoveryMs)/1000)
+			}
+		}
+		fmt.Printf("%-18s %7.1f%% %8.1fms %8d %8d(%5d) %8.1f%%→%5.1f%% %10s\n",
+			strategy.name, stats.HitRate*100, stats.P99TTFT, stats.FailedRequests,
+			crash.BlocksLost, crash.UniqueLost, recovery.Baseline*100, recovery.Trough*100, recoveryText)
+	}
+}
+
+// runDegradationComparison 在加压轨迹上对比分池路由有无降级管理器的表现
+func runDegradationComparison(requests []*Request) {
+	stressed := ScaleTimestamps(requests, 1.5)
+	if len(stressed) > 0 {
+		midpoint := stressed[len(stressed)/2].Timestamp
+		stressed = InjectHotspotBursts(stressed, []HotspotBurst{{
+			StartMs: midpoint, DurationMs: 20000, RatePerSec: 15, PrefixBlocks: 12, SuffixBlocks: 4, OutputLength: 128,
+		}}, 42)
+	}
+
+	fmt.Printf("\n🛡️ 降级管理器对比 (到达率×1.5并在中点注入20秒热点突发, 共%d个请求):\n", len(stressed))
+	fmt.Println(strings.Repeat("-", 90))
+	baseline := runQuickTest(NewDefaultPooledRouter(), stressed, "Pooled")
+	manager := NewDegradationManager(NewDefaultPooledRouter(), DefaultDegradationThresholds())
+	degraded := runQuickTest(manager, stressed, manager.GetName())
+	for _, r := range []struct {
+		name   string
+		result TestResult
+	}{{"分池路由", baseline}, {"分池路由+降级管理", degraded}} {
+		fmt.Printf("%-22s 命中率 %.1f%%  集中度 %.1f%%  平均TTFT %.1fms  P99 %.1fms\n",
+			r.name, r.result.HitRate*100, r.result.Concentration*100, r.result.AvgTTFT, r.result.P99TTFT)
+	}
+
+	fmt.Printf("\n级别切换 %d 次:\n", len(manager.Transitions))
+	if log := manager.TransitionLog(); log != "" {
+		fmt.Println(log)
+	}
+	fmt.Printf("\n%-6s %10s %8s %10s %10s %8s\n", "级别", "时长", "请求数", "命中率", "平均TTFT", "错误数")
+	for level := range manager.Levels {
+		m := &manager.Levels[level]
+		fmt.Printf("%-6s %9.1fs %8d %9.1f%% %8.1fms %8d\n",
+			DegradationLevel(level), float64(m.DurationMs)/1000, m.Requests, m.HitRate()*100, m.AvgTTFT(), m.Errors)
+	}
+}
+
+// runPooledRoutingReport 按ARCH.md的分池设计路由，报告分类结果与各池指标
+func runPooledRoutingReport(requests []*Request) {
+	router := NewDefaultPooledRouter()
+	result := runQuickTest(router, requests, router.GetName())
+
+	fmt.Println("\n🏊 分池路由 (ARCH.md 智能两层设计):")
+	fmt.Println(strings.Repeat("-", 90))
+	fmt.Printf("整体: 命中率 %.1f%%  集中度 %.1f%%  平均TTFT %.1fms  P99 %.1fms\n",
+		result.HitRate*100, result.Concentration*100, result.AvgTTFT, result.P99TTFT)
+	fmt.Printf("%-10s %-42s %6s %8s %8s %10s %10s %10s\n", "池", "选择器", "节点", "请求数", "流量占比", "命中率", "池内集中度", "平均TTFT")
+	for _, m := range router.PoolMetrics() {
+		share := 0.0
+		if len(requests) > 0 {
+			share = float64(m.Requests) / float64(len(requests))
+		}
+		fmt.Printf("%-10s %-42s %6d %8d %7.1f%% %9.1f%% %9.1f%% %8.1fms\n",
+			m.Name, m.Selector, m.Nodes, m.Requests, share*100, m.HitRate*100, m.Concentration*100, m.AvgTTFT)
+	}
+}
+
+// newBanditArms 老虎机元选择器的候选策略（每次新建，避免不同运行共享选择器状态）
+func newBanditArms() ([]PrefillNodeSelector, []string) {
+	return []PrefillNodeSelector{
+			&RandomNodeSelector{},
+			&CacheAwareSelector{},
+			NewPowerOfDChoicesSelector(2, 42),
+			NewLongestPrefixSelector(1.5, 32, 0.3),
+			NewSLOAwareSelector(NewTTFTCostModel(defaultNetworkBandwidth), 200, SLODeprioritize),
+		}, []string{
+			"Random", "CacheAware", "PowerOfTwo", "LongestPrefix", "SLOAware",
+		}
+}
+
+// runBanditComparison 对比不同奖励函数与算法下老虎机元选择器的表现及选臂过程
+func runBanditComparison(requests []*Request) {
+	rewards := []RewardFunction{
+		&HitRateReward{},
+		&TTFTReward{SLOMs: 200},
+		&GPUCostReward{GPUWeight: 100, StorageWeight: 1},
+	}
+
+	fmt.Printf("\n🎰 老虎机在线策略切换 (每epoch 100个请求, %s淘汰):\n", validation.eviction)
+	for _, reward := range rewards {
+		for _, algorithm := range []BanditAlgorithm{BanditUCB, BanditThompson} {
+			arms, armNames := newBanditArms()
+			bandit := NewBanditSelector(arms, algorithm, reward, 100, 42)
+			result := runQuickTest(bandit, requests, bandit.GetName())
+
+			fmt.Println(strings.Repeat("-", 90))
+			fmt.Printf("%s: 命中率 %.1f%%  集中度 %.1f%%  平均TTFT %.1fms  P99 %.1fms\n",
+				bandit.GetName(), result.HitRate*100, result.Concentration*100, result.AvgTTFT, result.P99TTFT)
+
+			epochs, means := bandit.ArmSummary()
+			summary := make([]string, len(armNames))
+			for i, name := range armNames {
+				summary[i] = fmt.Sprintf("%s %d/%.3f", name, epochs[i], means[i])
+			}
+			fmt.Printf("  臂(epoch数/平均奖励): %s\n", strings.Join(summary, ", "))
+			fmt.Printf("  选臂时间线: %s\n", banditTimeline(bandit.History, armNames))
+		}
+	}
+}
+
+// banditTimeline 将连续选中同一臂的epoch合并为"起始秒:臂×epoch数"
+func banditTimeline(history []BanditEpoch, armNames []string) string {
+	parts := make([]string, 0)
+	for i := 0; i < len(history); {
+		j := i
+		for j < len(history) && history[j].Arm == history[i].Arm {
+			j++
+		}
+		parts = append(parts, fmt.Sprintf("%ds:%s×%d", history[i].StartTimestamp/1000, armNames[history[i].Arm], j-i))
+		i = j
+	}
+	if len(parts) > 12 {
+		parts = append(parts[:6], append([]string{"..."}, parts[len(parts)-5:]...)...)
+	}
+	return strings.Join(parts, " → ")
+}
+
+// runAdmissionComparison 对比不同缓存准入策略对命中率的影响
+func runAdmissionComparison(requests []*Request) {
+	policies := []CacheAdmissionPolicy{
+		&AlwaysAdmitPolicy{},
+		NewTinyLFUAdmission(4096, 40960),
+		NewSecondHitAdmission(100000),
+		&SizeThresholdAdmission{MaxInputTokens: 16384},
+		&PrefixDepthAdmission{MaxDepth: 16},
+	}
+
+	fmt.Printf("\n🚪 缓存准入策略对比 (CacheAware选择器, %s淘汰):\n", validation.eviction)
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-22s %10s %10s %12s %12s\n", "准入策略", "命中率", "命中率变化", "拒绝块数", "拒绝后再访问")
+	fmt.Println(strings.Repeat("-", 70))
+
+	baseline := 0.0
+	for i, policy := range policies {
+		sim := newValidationSimulator(4, 500, &CacheAwareSelector{}, validation.evictionAlgo)
+		sim.SetCacheAdmissionPolicy(policy)
+		for _, request := range requests {
+			sim.processor.ProcessRequest(request, sim.nodes)
+		}
+		stats := sim.processor.GetStatistics()
+		if i == 0 {
+			baseline = stats.HitRate
+		}
+
+		fmt.Printf("%-22s %9.2f%% %+9.2f%% %12d %12d\n",
+			policy.GetName(),
+			stats.HitRate*100,
+			(stats.HitRate-baseline)*100,
+			stats.RejectedBlocks,
+			stats.RejectedReaccessed)
+	}
 }
 
 // TestResult 测试结果
@@ -70,28 +815,99 @@ type TestResult struct {
 	Name          string
 	HitRate       float64
 	Concentration float64
+	AvgTTFT       float64 // 平均首token时间（毫秒）
+	P99TTFT       float64
+
+	ComputeMs      float64 // 屋顶线模型下的prefill计算时间之和（毫秒）
+	SavedComputeMs float64 // 缓存命中节省的计算时间（毫秒）
+	Usage          CostUsage
+}
+
+// runCacheExpiryComparison 对比block TTL（命中续期）与周期性失效最热前缀子树对命中率的影响
+func runCacheExpiryComparison(requests []*Request) {
+	prefix := hottestRootBlock(requests)
+	configs := []struct {
+		name            string
+		ttl             int
+		invalidateEvery int
+	}{
+		{"不过期", 0, 0},
+		{"TTL 120秒", 120000, 0},
+		{"TTL 30秒", 30000, 0},
+		{"每60秒失效最热前缀", 0, 60000},
+	}
+
+	fmt.Println("\n⏳ TTL与前缀失效对比 (LongestPrefix选择器, 命中时续期):")
+	fmt.Println(strings.Repeat("-", 90))
+	fmt.Printf("%-28s %10s %10s %10s %10s %10s\n", "配置", "命中率", "平均TTFT", "P99 TTFT", "到期块数", "失效块数")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, config := range configs {
+		sim := newValidationSimulator(4, 500, NewLongestPrefixSelector(1.5, 32, 0.3), validation.evictionAlgo)
+		sim.SetBlockTTL(config.ttl)
+		invalidated := 0
+		nextInvalidation := 0
+		if len(requests) > 0 {
+			nextInvalidation = requests[0].Timestamp + config.invalidateEvery
+		}
+		for _, request := range requests {
+			for config.invalidateEvery > 0 && prefix != nil && request.Timestamp >= nextInvalidation {
+				invalidated += sim.InvalidatePrefix(prefix)
+				nextInvalidation += config.invalidateEvery
+			}
+			sim.ProcessRequest(request)
+		}
+		sim.Drain()
+		stats := sim.processor.GetStatistics()
+		expired := 0
+		for _, nodeStats := range stats.NodeStats {
+			expired += nodeStats.ExpiredBlocks
+		}
+		fmt.Printf("%-28s %9.1f%% %8.1fms %8.1fms %10d %10d\n",
+			config.name, stats.HitRate*100, stats.AvgTTFT, stats.P99TTFT, expired, invalidated)
+	}
+}
+
+// hottestRootBlock 返回最多请求共享的首个block（前缀树根），轨迹为空时返回nil
+func hottestRootBlock(requests []*Request) []int {
+	counts := make(map[int]int)
+	best, bestCount := 0, 0
+	for _, request := range requests {
+		if len(request.HashIDs) == 0 {
+			continue
+		}
+		root := request.HashIDs[0]
+		counts[root]++
+		if counts[root] > bestCount {
+			best, bestCount = root, counts[root]
+		}
+	}
+	if bestCount == 0 {
+		return nil
+	}
+	return []int{best}
 }
 
 // runQuickTest 快速测试单个策略
 func runQuickTest(selector PrefillNodeSelector, requests []*Request, name string) TestResult {
-	// 创建模拟器 (4节点, 500缓存容量, LFU淘汰)
+	// 创建模拟器 (4节点, 500缓存容量, 按-eviction选择淘汰算法)
 	nodeCount := 4
 	cacheSize := 500
-	sim := NewSimulator(nodeCount, cacheSize, selector, func() EvictionAlgorithm { return NewLFUEviction() })
+	sim := newValidationSimulator(nodeCount, cacheSize, selector, validation.evictionAlgo)
 
 	// 统计节点负载
 	nodeLoads := make(map[string]int)
 
 	// 运行模拟
 	for _, request := range requests {
-		result, err := sim.processor.ProcessRequest(request, sim.nodes)
+		result, err := sim.ProcessRequest(request)
 		if err != nil {
 			continue
 		}
 		nodeLoads[result.SelectedNode.ID]++
 	}
 
-	// 计算指标
+	// 计算指标（先执行完在途作业）
+	sim.Drain()
 	stats := sim.processor.GetStatistics()
 
 	// 计算集中度
@@ -104,27 +920,38 @@ func runQuickTest(selector PrefillNodeSelector, requests []*Request, name string
 		totalLoad += count
 	}
 
-	concentration := float64(maxLoad) / float64(totalLoad)
+	concentration := 0.0
+	if totalLoad > 0 {
+		concentration = float64(maxLoad) / float64(totalLoad)
+	}
 
 	return TestResult{
 		Name:          name,
 		HitRate:       stats.HitRate,
 		Concentration: concentration,
+		AvgTTFT:       stats.AvgTTFT,
+		P99TTFT:       stats.P99TTFT,
+
+		ComputeMs:      stats.ComputeMs,
+		SavedComputeMs: stats.SavedComputeMs,
+		Usage:          validation.costModel.Usage(sim),
 	}
 }
 
 // showDataComparison 显示关键数据对比
-func showDataComparison(results []TestResult) {
+func showDataComparison(results []TestResult, costModel *CostModel) {
+	if len(results) == 0 {
+		return
+	}
+
 	// 找到最佳结果
 	var bestHitRate, bestConcentration TestResult
 	var worstHitRate, worstConcentration TestResult
 
-	if len(results) > 0 {
-		bestHitRate = results[0]
-		worstHitRate = results[0]
-		bestConcentration = results[0]
-		worstConcentration = results[0]
-	}
+	bestHitRate = results[0]
+	worstHitRate = results[0]
+	bestConcentration = results[0]
+	worstConcentration = results[0]
 
 	for _, r := range results {
 		if r.HitRate > bestHitRate.HitRate {
@@ -153,18 +980,21 @@ func showDataComparison(results []TestResult) {
 		(bestHitRate.HitRate - results[0].HitRate)*100)
 
 	// 成本分析
-	fmt.Printf("\n💰 成本效益分析 (基于真实硬件成本):\n")
-	fmt.Printf("  GPU计算成本: ~$3/小时 (A100)\n")
-	fmt.Printf("  存储成本: ~$0.02/GB/小时\n")
-	fmt.Printf("  成本比例: GPU:存储 ≈ 150:1\n")
-	fmt.Printf("\n  关键洞察: 1%%命中率提升可节省1%%GPU时间\n")
-	fmt.Printf("           而100%%数据冗余仅增加<1%%总成本\n")
+	fmt.Printf("\n💰 成本模型 (%s):\n", costModel.Compute.GetName())
+	fmt.Printf("  单价: %s\n", costModel.Prices)
+	fmt.Printf("  GPU卡时 = 屋顶线计算时间 × %d卡；DRAM GB时 = 缓存block占用 × %.0fMB/block；网络GB = 分块前送与扩缩容复制的KV块\n",
+		costModel.Compute.GPUs, costModel.Compute.kvBytes(blockTokens)/1e6)
+	fmt.Printf("\n  关键洞察: 命中深前缀省去全部线性层计算，但新token仍要对前缀做注意力，\n")
+	fmt.Printf("           计算节省按屋顶线模型计算而非按命中率折算\n")
 
 	// 计算综合评分（考虑GPU成本）
 	fmt.Printf("\n📊 策略综合评分:\n")
 	fmt.Printf("  [传统评分: 命中率/集中度]\n")
 	for _, r := range results {
-		score := r.HitRate / r.Concentration
+		score := 0.0
+		if r.Concentration > 0 {
+			score = r.HitRate / r.Concentration
+		}
 		quality := "⚠️ 低效"
 		if score > 1.0 {
 			quality = "✅ 高效"
@@ -175,29 +1005,23 @@ func showDataComparison(results []TestResult) {
 			extractSimpleName(r.Name), score, quality)
 	}
 
-	fmt.Printf("\n  [GPU成本加权评分: 考虑计算成本远高于存储成本]\n")
-	// 更真实的成本权重: GPU成本是存储成本的100倍
-	// 每1%命中率提升 = 节省100单位GPU成本
-	// 每1%存储冗余 = 增加1单位存储成本
+	fmt.Printf("\n  [每百万请求成本（美元）]\n")
+	fmt.Printf("    %-20s %9s %9s %9s %9s %10s %10s %9s\n",
+		"策略", "GPU", "DRAM", "SSD", "网络", "合计", "相对Random", "缓存节省")
+	baseline := costModel.PerMillionRequests(results[0].Usage).Total()
 	for _, r := range results {
-		// 命中率收益（相对于最低命中率）
-		hitRateGain := (r.HitRate - worstHitRate.HitRate) * 100 * 100 // GPU成本权重100x
-		// 存储冗余成本（负载集中度越低，冗余越多）
-		storageCost := (100 - r.Concentration*100) * 1 // 存储成本权重1x
-		// 净收益 = GPU节省 - 存储成本
-		netBenefit := hitRateGain - storageCost
-
-		assessment := "❌ 亏损"
-		if netBenefit > 500 {
-			assessment = "💎 极优"
-		} else if netBenefit > 200 {
-			assessment = "✅ 优秀"
-		} else if netBenefit > 0 {
-			assessment = "⭐ 正收益"
+		cost := costModel.PerMillionRequests(r.Usage)
+		// 基准成本或计算量为0时（如没有完成的请求）比例没有意义，记为0
+		relative, savedShare := 0.0, 0.0
+		if baseline > 0 {
+			relative = cost.Total()/baseline - 1
 		}
-
-		fmt.Printf("    %-20s: %+.1f %s (GPU节省:%.1f - 存储成本:%.1f)\n",
-			extractSimpleName(r.Name), netBenefit, assessment, hitRateGain, storageCost)
+		if total := r.ComputeMs + r.SavedComputeMs; total > 0 {
+			savedShare = r.SavedComputeMs / total
+		}
+		fmt.Printf("    %-20s %9.2f %9.2f %9.2f %9.2f %10.2f %+9.1f%% %8.1f%%\n",
+			extractSimpleName(r.Name), cost.GPU, cost.DRAM, cost.SSD, cost.Network, cost.Total(),
+			relative*100, savedShare*100)
 	}
 }
 
@@ -215,6 +1039,20 @@ func extractSimpleName(fullName string) string {
 		return "PrefixAware(论文)"
 	} else if strings.Contains(fullName, "强化前缀") {
 		return "PrefixAware(优化)"
+	} else if strings.Contains(fullName, "PowerOfTwo") {
+		return "PowerOfTwo"
+	} else if strings.Contains(fullName, "ConsistentHash") {
+		return "CHBL"
+	} else if strings.Contains(fullName, "LongestPrefix") {
+		return "LongestPrefix"
+	} else if strings.Contains(fullName, "SLOAware") {
+		return "SLOAware"
+	} else if strings.Contains(fullName, "Bandit") {
+		return "Bandit"
+	} else if strings.Contains(fullName, "Pooled") {
+		return "Pooled"
+	} else if strings.Contains(fullName, "Degradation") {
+		return "Degradation"
 	}
 	return "Unknown"
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// ============= 多模型服务与模型亲和 =============
+//
+// 节点可以托管一个或多个模型，处理器只把请求交给托管其模型的节点（选择器看不到不兼容的节点）。
+// 不同模型的KV不能互相复用，Simulator.ProcessRequest在处理前把请求的hash ID映射到模型自己的命名空间，
+// 相同token前缀在不同模型下成为不同的block。节点可以为每个模型划分KV内存分区：
+// 模型的block数达到分区上限时，新写入先淘汰该模型自己最久未访问的block。
+
+// ErrNoCompatibleNode 没有可调度的节点托管请求的模型
+var ErrNoCompatibleNode = fmt.Errorf("%w: no node serves the requested model", ErrNoNodeSelected)
+
+func modelOf(request *Request) string {
+	if request.ModelID == "" {
+		return defaultGroup
+	}
+	return request.ModelID
+}
+
+// HostModels 设置节点托管的模型及各自的KV内存分区占比（占比为0表示与其他模型共享剩余空间）
+func (n *PrefillNode) HostModels(shares map[string]float64) {
+	n.Models = n.Models[:0]
+	n.modelShares = make(map[string]float64, len(shares))
+	for model, share := range shares {
+		n.Models = append(n.Models, model)
+		if share > 0 {
+			n.modelShares[model] = share
+		}
+	}
+	sort.Strings(n.Models)
+}
+
+// copyModels 沿用template托管的模型与内存分区（扩容的新节点与现有节点配置一致）
+func (n *PrefillNode) copyModels(template *PrefillNode) {
+	n.Models = append([]string(nil), template.Models...)
+	n.modelShares = make(map[string]float64, len(template.modelShares))
+	for model, share := range template.modelShares {
+		n.modelShares[model] = share
+	}
+}
+
+// Serves 节点是否托管model（未配置模型的节点服务所有模型；默认模型只由未配置模型的节点服务）
+func (n *PrefillNode) Serves(model string) bool {
+	if len(n.Models) == 0 {
+		return true
+	}
+	for _, m := range n.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// compatibleNodes 过滤出托管model的节点（全部兼容时返回原切片）
+func compatibleNodes(nodes []*PrefillNode, model string) []*PrefillNode {
+	for i, node := range nodes {
+		if !node.Serves(model) {
+			compatible := append([]*PrefillNode{}, nodes[:i]...)
+			for _, n := range nodes[i+1:] {
+				if n.Serves(model) {
+					compatible = append(compatible, n)
+				}
+			}
+			return compatible
+		}
+	}
+	return nodes
+}
+
+// namespacedHash 把hash ID映射到模型的命名空间：按模型名加盐后做乘法散列，结果保持非负
+func namespacedHash(salt uint64, hashID int) int {
+	return int(((uint64(hashID) ^ salt) * 0x9E3779B97F4A7C15) >> 2)
+}
+
+// namespaceRequest 返回hash ID已映射到模型命名空间的请求副本，默认模型的请求原样返回
+func namespaceRequest(request *Request) *Request {
+	if request.ModelID == "" {
+		return request
+	}
+	h := fnv.New64a()
+	h.Write([]byte(request.ModelID))
+	salt := h.Sum64()
+
+	namespaced := cloneRequest(request)
+	for i, hashID := range namespaced.HashIDs {
+		namespaced.HashIDs[i] = namespacedHash(salt, hashID)
+	}
+	return namespaced
+}
+
+// enforceModelPartition 写入新block前，模型已占满其分区时淘汰该模型最久未访问的block
+func (p *BasicPrefillProcessor) enforceModelPartition(node *PrefillNode, request *Request) {
+	share, exists := node.modelShares[request.ModelID]
+	if !exists {
+		return
+	}
+	if node.ModelBlocks(request.ModelID) < int(share*float64(node.capacityBlocks())) {
+		return
+	}
+	if node.evictModelBlock(request.ModelID) {
+		groupStatsFor(p.stats.ModelStats, modelOf(request)).QuotaEvictions++
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import "container/list"
+
+// ============= 节点缓存操作 =============
+//
+// 所有block的增删都经过这里，保证CacheBlocks、UsedMemoryMB与淘汰算法的内部结构一致。
+
+const (
+	blockTokens   = 512                                      // 每个block的token数
+	blockMemoryMB = float64(blockTokens) * 2 * 4 / (1 << 20) // 假设每个token占用2*4字节（KV各4字节）
+
+	defaultNetworkBandwidth = 10.0 // 节点网络带宽（GB/s），MB除以GB/s即毫秒
+)
+
+// parentHashAt 返回前缀链中第i个block的父block，链首返回-1
+func parentHashAt(hashIDs []int, i int) int {
+	if i == 0 {
+		return -1
+	}
+	return hashIDs[i-1]
+}
+
+// addBlock 向节点缓存写入一个新block并通知淘汰算法
+func (n *PrefillNode) addBlock(hashID int, parentHash int) *Block {
+	n.seqCounter++ // 递增序号计数器
+	block := &Block{
+		HashID:     hashID,
+		Size:       blockTokens,
+		HitCount:   1,
+		AccessSeq:  n.seqCounter,
+		CreateSeq:  n.seqCounter,
+		ParentHash: parentHash,
+	}
+	if n.BlockTTL > 0 {
+		n.setExpiry(block, n.now+n.BlockTTL)
+	}
+	if n.lineage == nil {
+		n.lineage = make(map[int]int)
+	}
+	n.lineage[hashID] = parentHash
+
+	n.CacheBlocks[hashID] = block
+	if len(n.lineage) > n.pruneAt {
+		n.pruneLineage()
+	}
+	n.UsedMemoryMB += blockMemoryMB
+	n.EvictionAlgo.OnAdd(hashID)
+	return block
+}
+
+// evictOne 由淘汰算法选出一个block并回收，返回被淘汰的block ID，无可淘汰时返回-1
+func (n *PrefillNode) evictOne() int {
+	for {
+		evictID := n.EvictionAlgo.Evict(n.CacheBlocks)
+		if evictID == -1 {
+			return -1
+		}
+		if block, exists := n.CacheBlocks[evictID]; exists {
+			n.untrackOwner(block)
+			delete(n.CacheBlocks, evictID)
+			n.UsedMemoryMB -= blockMemoryMB
+			return evictID
+		}
+		// 淘汰结构中残留的条目已不在缓存中，继续选择下一个
+	}
+}
+
+// touchBlock 命中block：更新访问序号与租户、模型的访问序列，通知淘汰算法并按TTL续期
+func (n *PrefillNode) touchBlock(block *Block) {
+	n.seqCounter++
+	block.AccessSeq = n.seqCounter
+	if block.tenantElem != nil {
+		n.tenantBlocks[block.Tenant].MoveToBack(block.tenantElem)
+	}
+	if block.modelElem != nil {
+		n.modelBlocks[block.Model].MoveToBack(block.modelElem)
+	}
+	n.EvictionAlgo.UpdateOnAccess(block)
+	n.refreshExpiry(block)
+}
+
+// RemoveBlock 在淘汰流程之外移除一个block（失效、故障、去复制等），返回是否确实移除
+func (n *PrefillNode) RemoveBlock(hashID int) bool {
+	block, exists := n.CacheBlocks[hashID]
+	if !exists {
+		return false
+	}
+	n.untrackOwner(block)
+	delete(n.CacheBlocks, hashID)
+	n.UsedMemoryMB -= blockMemoryMB
+	n.EvictionAlgo.OnRemove(hashID)
+	return true
+}
+
+// addRequestBlock 写入一个由request产生的block，记录其租户与模型归属
+func (n *PrefillNode) addRequestBlock(hashID int, parentHash int, request *Request) *Block {
+	return n.addOwnedBlock(hashID, parentHash, request.TenantID, request.ModelID)
+}
+
+// addOwnedBlock 写入一个归属于tenant与model的block（预热、迁移时沿用源block的归属）
+func (n *PrefillNode) addOwnedBlock(hashID int, parentHash int, tenant, model string) *Block {
+	block := n.addBlock(hashID, parentHash)
+	block.Tenant, block.Model = tenant, model
+	if block.Tenant != "" {
+		if n.tenantBlocks == nil {
+			n.tenantBlocks = make(map[string]*list.List)
+		}
+		block.tenantElem = pushOwned(n.tenantBlocks, block.Tenant, block)
+	}
+	if block.Model != "" {
+		if n.modelBlocks == nil {
+			n.modelBlocks = make(map[string]*list.List)
+		}
+		block.modelElem = pushOwned(n.modelBlocks, block.Model, block)
+	}
+	return block
+}
+
+// pushOwned 把block追加到owner访问序列的末尾（最近访问）
+func pushOwned(owners map[string]*list.List, owner string, block *Block) *list.Element {
+	blocks := owners[owner]
+	if blocks == nil {
+		blocks = list.New()
+		owners[owner] = blocks
+	}
+	return blocks.PushBack(block)
+}
+
+// untrackOwner block离开缓存时从租户与模型的访问序列中移除
+func (n *PrefillNode) untrackOwner(block *Block) {
+	if block.tenantElem != nil {
+		n.tenantBlocks[block.Tenant].Remove(block.tenantElem)
+		block.tenantElem = nil
+	}
+	if block.modelElem != nil {
+		n.modelBlocks[block.Model].Remove(block.modelElem)
+		block.modelElem = nil
+	}
+}
+
+// TenantBlocks 节点上归属于tenant的block数
+func (n *PrefillNode) TenantBlocks(tenant string) int {
+	return ownedCount(n.tenantBlocks, tenant)
+}
+
+// ModelBlocks 节点上属于model的block数
+func (n *PrefillNode) ModelBlocks(model string) int {
+	return ownedCount(n.modelBlocks, model)
+}
+
+func ownedCount(owners map[string]*list.List, owner string) int {
+	if blocks := owners[owner]; blocks != nil {
+		return blocks.Len()
+	}
+	return 0
+}
+
+// evictTenantBlock 在淘汰算法之外移除tenant最久未访问的block（租户配额），没有时返回false
+func (n *PrefillNode) evictTenantBlock(tenant string) bool {
+	return n.evictLeastRecent(n.tenantBlocks[tenant])
+}
+
+// evictModelBlock 在淘汰算法之外移除model最久未访问的block（模型分区），没有时返回false
+func (n *PrefillNode) evictModelBlock(model string) bool {
+	return n.evictLeastRecent(n.modelBlocks[model])
+}
+
+func (n *PrefillNode) evictLeastRecent(blocks *list.List) bool {
+	if blocks == nil || blocks.Len() == 0 {
+		return false
+	}
+	return n.RemoveBlock(blocks.Front().Value.(*Block).HashID)
+}
+
+// capacityBlocks 按内存上限换算出的缓存块容量
+func (n *PrefillNode) capacityBlocks() int {
+	return int(float64(n.MaxMemoryMB) / blockMemoryMB)
+}
+
+// ResizeCache 调整节点缓存内存上限，必要时淘汰超出部分，返回淘汰的块数
+func (n *PrefillNode) ResizeCache(maxMemoryMB int) int {
+	n.MaxMemoryMB = maxMemoryMB
+	n.EvictionAlgo.OnCapacityChange(n.capacityBlocks())
+
+	evicted := 0
+	for n.UsedMemoryMB > float64(n.MaxMemoryMB) && len(n.CacheBlocks) > 0 {
+		if n.evictOne() == -1 {
+			break
+		}
+		evicted++
+	}
+	return evicted
+}
+
+// ============= TTL与前缀失效 =============
+
+func (n *PrefillNode) setExpiry(block *Block, expireAt int) {
+	block.ExpireAt = expireAt
+	if expireAt > 0 && (n.nextExpiry == 0 || expireAt < n.nextExpiry) {
+		n.nextExpiry = expireAt
+	}
+}
+
+// refreshExpiry 命中时按BlockTTL续期（滑动过期），热点block不会因写入时间早而被清除
+func (n *PrefillNode) refreshExpiry(block *Block) {
+	if n.BlockTTL > 0 {
+		n.setExpiry(block, n.now+n.BlockTTL)
+	}
+}
+
+// SetBlockExpiry 为单个block设置过期时间（模拟毫秒，0表示永不过期），block不存在时返回false
+func (n *PrefillNode) SetBlockExpiry(hashID int, expireAt int) bool {
+	block, exists := n.CacheBlocks[hashID]
+	if !exists {
+		return false
+	}
+	n.setExpiry(block, expireAt)
+	return true
+}
+
+// ExpireBlocks 将节点时钟推进到now并移除所有已过期的block，返回移除的块数
+func (n *PrefillNode) ExpireBlocks(now int) int {
+	n.now = now
+	if n.nextExpiry == 0 || now < n.nextExpiry {
+		return 0
+	}
+
+	expired := 0
+	n.nextExpiry = 0
+	for hashID, block := range n.CacheBlocks {
+		if block.ExpireAt == 0 {
+			continue
+		}
+		if block.ExpireAt <= now {
+			n.RemoveBlock(hashID)
+			expired++
+		} else if n.nextExpiry == 0 || block.ExpireAt < n.nextExpiry {
+			n.nextExpiry = block.ExpireAt
+		}
+	}
+	return expired
+}
+
+// InvalidatePrefix 移除以prefix为前缀的整棵子树（前缀末尾block及其所有后继），
+// 同时清理热点检测中以该前缀开头的PrefixPatterns，返回移除的块数
+func (n *PrefillNode) InvalidatePrefix(prefix []int) int {
+	if len(prefix) == 0 {
+		return 0
+	}
+
+	root := prefix[len(prefix)-1]
+	inSubtree := map[int]bool{root: true}
+	victims := make([]int, 0)
+	for hashID := range n.CacheBlocks {
+		if n.descendsFrom(hashID, inSubtree) {
+			victims = append(victims, hashID)
+		}
+	}
+	for _, hashID := range victims {
+		n.RemoveBlock(hashID)
+	}
+
+	n.dropPrefixPatterns(prefix)
+	return len(victims)
+}
+
+// descendsFrom 沿lineage向上查找，判断hashID是否位于已知子树内，结果写回memo
+func (n *PrefillNode) descendsFrom(hashID int, memo map[int]bool) bool {
+	path := make([]int, 0)
+	current := hashID
+	result := false
+	for steps := 0; steps <= len(n.lineage); steps++ {
+		if known, exists := memo[current]; exists {
+			result = known
+			break
+		}
+		path = append(path, current)
+		parent, exists := n.lineage[current]
+		if !exists || parent == -1 {
+			break
+		}
+		current = parent
+	}
+	for _, id := range path {
+		memo[id] = result
+	}
+	return result
+}
+
+// pruneLineage 只保留仍在缓存中的block及其祖先链，其余记录与失效判断无关。
+// 下次裁剪阈值取保留条目数的2倍，摊还后每次写入的裁剪开销为常数
+func (n *PrefillNode) pruneLineage() {
+	kept := make(map[int]int, len(n.CacheBlocks))
+	for hashID := range n.CacheBlocks {
+		for current := hashID; current != -1; {
+			if _, done := kept[current]; done {
+				break
+			}
+			parent, exists := n.lineage[current]
+			if !exists {
+				break
+			}
+			kept[current] = parent
+			current = parent
+		}
+	}
+	n.lineage = kept
+	n.pruneAt = max(2*len(kept), 4*n.capacityBlocks())
+}
+
+// dropPrefixPatterns 删除以prefix开头的前缀模式及其复制因子记录
+func (n *PrefillNode) dropPrefixPatterns(prefix []int) {
+	if n.HotspotMetrics == nil {
+		return
+	}
+	for key, pattern := range n.HotspotMetrics.PrefixPatterns {
+		if hasPrefix(pattern.Prefix, prefix) {
+			delete(n.HotspotMetrics.PrefixPatterns, key)
+			delete(n.HotspotMetrics.ReplicationFactor, key)
+		}
+	}
+}
+
+// hasPrefix 判断hashIDs是否以prefix开头
+func hasPrefix(hashIDs []int, prefix []int) bool {
+	if len(hashIDs) < len(prefix) {
+		return false
+	}
+	for i, id := range prefix {
+		if hashIDs[i] != id {
+			return false
+		}
+	}
+	return true
+}
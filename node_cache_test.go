@@ -0,0 +1,169 @@
+package main
+
+import "testing"
+
+func newTestNode() *PrefillNode {
+	return newPrefillNode("node-test", 500, evictionRegistry["LRU"])
+}
+
+// addChain 按前缀链写入hashIDs
+func addChain(node *PrefillNode, hashIDs ...int) {
+	for i, hashID := range hashIDs {
+		node.addBlock(hashID, parentHashAt(hashIDs, i))
+	}
+}
+
+func TestExpireBlocksRemovesOnlyDueBlocks(t *testing.T) {
+	node := newTestNode()
+	addChain(node, 1, 2, 3)
+	node.SetBlockExpiry(1, 100)
+	node.SetBlockExpiry(2, 200)
+	if node.SetBlockExpiry(99, 100) {
+		t.Fatal("SetBlockExpiry on missing block should return false")
+	}
+
+	if expired := node.ExpireBlocks(99); expired != 0 {
+		t.Fatalf("expired %d blocks before any deadline", expired)
+	}
+	if expired := node.ExpireBlocks(150); expired != 1 {
+		t.Fatalf("expired %d blocks at 150, want 1", expired)
+	}
+	if _, exists := node.CacheBlocks[1]; exists {
+		t.Fatal("block 1 should have expired")
+	}
+	if expired := node.ExpireBlocks(1000); expired != 1 {
+		t.Fatalf("expired %d blocks at 1000, want 1", expired)
+	}
+	if _, exists := node.CacheBlocks[3]; !exists {
+		t.Fatal("block 3 has no expiry and must stay cached")
+	}
+	if node.UsedMemoryMB != blockMemoryMB {
+		t.Fatalf("UsedMemoryMB = %v, want one block", node.UsedMemoryMB)
+	}
+}
+
+func TestBlockTTLRefreshedOnHit(t *testing.T) {
+	sim := NewSimulator(1, 500, &RandomNodeSelector{}, evictionRegistry["LRU"])
+	sim.SetBlockTTL(1000)
+	node := sim.nodes[0]
+
+	for _, ts := range []int{0, 800} {
+		request := &Request{Timestamp: ts, InputLength: 2 * blockTokens, OutputLength: 1, HashIDs: []int{1, 2}}
+		if _, err := sim.ProcessRequest(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 写入于0ms，800ms命中后应续期到1800ms
+	if expired := node.ExpireBlocks(1500); expired != 0 {
+		t.Fatalf("expired %d blocks at 1500 despite hit at 800", expired)
+	}
+	if expired := node.ExpireBlocks(1800); expired != 2 {
+		t.Fatalf("expired %d blocks at 1800, want 2", expired)
+	}
+}
+
+func TestInvalidatePrefixRemovesSubtree(t *testing.T) {
+	node := newTestNode()
+	addChain(node, 1, 2, 3, 4)
+	addChain(node, 1, 2, 5)
+	addChain(node, 1, 6)
+	addChain(node, 7, 8)
+
+	// 中间block被淘汰后，其后继仍应被识别为子树成员
+	node.RemoveBlock(3)
+
+	if removed := node.InvalidatePrefix([]int{1, 2}); removed != 3 {
+		t.Fatalf("removed %d blocks, want 3 (2, 4, 5)", removed)
+	}
+	for _, hashID := range []int{2, 4, 5} {
+		if _, exists := node.CacheBlocks[hashID]; exists {
+			t.Fatalf("block %d should be invalidated", hashID)
+		}
+	}
+	for _, hashID := range []int{1, 6, 7, 8} {
+		if _, exists := node.CacheBlocks[hashID]; !exists {
+			t.Fatalf("block %d is outside the subtree and must stay cached", hashID)
+		}
+	}
+	if removed := node.InvalidatePrefix(nil); removed != 0 {
+		t.Fatalf("empty prefix removed %d blocks", removed)
+	}
+}
+
+func TestLineagePrunedToCachedAncestors(t *testing.T) {
+	node := newTestNode()
+	for hashID := 1; hashID <= 10*node.capacityBlocks(); hashID++ {
+		addChain(node, hashID)
+		node.RemoveBlock(hashID)
+	}
+	if limit := 2 * max(4*node.capacityBlocks(), 1); len(node.lineage) > limit {
+		t.Fatalf("lineage holds %d entries for an empty cache, want <= %d", len(node.lineage), limit)
+	}
+
+	// 被淘汰的祖先仍在谱系中，失效时能找到其后继
+	addChain(node, 100001, 100002, 100003)
+	node.RemoveBlock(100002)
+	node.pruneLineage()
+	if removed := node.InvalidatePrefix([]int{100001, 100002}); removed != 1 {
+		t.Fatalf("removed %d blocks after pruning, want 1", removed)
+	}
+}
+
+// processBlocks 以单节点模拟器处理一个由hashIDs组成的请求，返回命中的块数
+func processBlocks(t *testing.T, sim *Simulator, at int, tenant, model string, hashIDs ...int) int {
+	t.Helper()
+	result, err := sim.ProcessRequest(&Request{
+		Timestamp:    at,
+		InputLength:  len(hashIDs) * blockTokens,
+		OutputLength: 1,
+		HashIDs:      hashIDs,
+		TenantID:     tenant,
+		ModelID:      model,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.CacheHits
+}
+
+func TestTenantQuotaEvictsLeastRecentlyUsed(t *testing.T) {
+	sim := NewSimulator(1, 1, NewEnhancedCacheAwareSelector(1, 0), evictionRegistry["LRU"])
+	sim.SetTenantQuotas(NewTenantQuotas(1).Set("a", 2/float64(sim.nodes[0].capacityBlocks()))) // 配额2块
+
+	processBlocks(t, sim, 0, "a", "", 1)
+	processBlocks(t, sim, 1000, "a", "", 2)
+	if hits := processBlocks(t, sim, 2000, "a", "", 1); hits != 1 {
+		t.Fatalf("block 1 hits = %d, want 1", hits)
+	}
+	processBlocks(t, sim, 3000, "a", "", 3) // 达到配额，应淘汰最久未访问的2而不是最早写入的1
+
+	if hits := processBlocks(t, sim, 4000, "a", "", 1); hits != 1 {
+		t.Fatal("repeatedly hit block 1 was evicted by the tenant quota")
+	}
+	if node := sim.nodes[0]; node.TenantBlocks("a") != 2 || node.CacheBlocks[2] != nil {
+		t.Fatalf("tenant a holds %d blocks (block 2 cached: %v), want 2 without block 2",
+			node.TenantBlocks("a"), node.CacheBlocks[2] != nil)
+	}
+}
+
+func TestModelPartitionKeepsRepeatedlyHitBlock(t *testing.T) {
+	sim := NewSimulator(1, 1, NewEnhancedCacheAwareSelector(1, 0), evictionRegistry["LRU"])
+	node := sim.nodes[0]
+	node.HostModels(map[string]float64{"m": 2 / float64(node.capacityBlocks()), "other": 0}) // m的分区为2块
+
+	processBlocks(t, sim, 0, "", "m", 1)
+	at := 1000
+	for _, hashID := range []int{2, 3, 4, 5} {
+		// 每写入一个新block前都命中一次block 1：分区承压时应淘汰上一个新block，而不是最早写入的1
+		processBlocks(t, sim, at, "", "m", hashID)
+		if hits := processBlocks(t, sim, at+1, "", "m", 1); hits != 1 {
+			t.Fatalf("repeatedly hit block 1 was evicted after writing block %d", hashID)
+		}
+		at += 1000
+	}
+	evictions := sim.processor.GetStatistics().ModelStats["m"].QuotaEvictions
+	if node.ModelBlocks("m") != 2 || evictions != 3 {
+		t.Fatalf("model m holds %d blocks after %d partition evictions, want 2 after 3", node.ModelBlocks("m"), evictions)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import "sort"
+
+// ============= 节点prefill作业队列 =============
+//
+// 每个节点是单服务台：作业按优先级排队（同优先级按到达顺序，不抢占执行中的作业），前一个完成后下一个才开始。
+// 作业的排队时间与TTFT在完成时确定，处理器在每个请求到达前把所有节点推进到当前时间。
+// 开启批处理调度后改为按迭代组批执行，见batch_scheduler.go。
+
+// prefillJob 节点上的一个prefill作业
+type prefillJob struct {
+	Request    *Request
+	Node       *PrefillNode
+	Result     *PrefillResult
+	ArrivalMs  float64 // 入队时间
+	ServiceMs  float64 // 服务时间（传输 + 计算）
+	TransferMs float64 // 其中的KV传输时间
+	Tokens     int     // 需要计算的未缓存token数（至少1，批处理调度按它组批）
+	Prefix     int     // 其前方已有KV的token数（注意力需要读取的上下文）
+	StartMs    float64 // 开始执行时间
+	FinishMs   float64 // 完成时间
+	BestEffort bool    // 尽力而为：排在所有普通作业之后
+	Priority   int     // 请求优先级：越大越靠前
+
+	Pipeline *chunkPipeline // 所属的分块流水线（未分块为nil），ArrivalMs为该分块最早可开始的时间
+
+	remaining int // 批处理模式下尚未计算的token数
+	step      int // 批处理模式下本次迭代计算的token数
+}
+
+// precedes 作业a是否应排在b之前：普通作业先于尽力而为作业，其次按优先级
+func (a *prefillJob) precedes(b *prefillJob) bool {
+	if a.BestEffort != b.BestEffort {
+		return !a.BestEffort
+	}
+	return a.Priority > b.Priority
+}
+
+// nodeQueue 节点的作业队列，零值可用
+type nodeQueue struct {
+	running *prefillJob
+	waiting []*prefillJob
+
+	batching *BatchConfig  // 非nil时按迭代批处理执行（见batch_scheduler.go）
+	batch    []*prefillJob // 当前迭代中的作业
+	iterEnd  float64       // 当前（或最近一次）迭代的结束时间
+}
+
+// enqueue 作业入队：插在第一个应排在其后的作业之前，尽力而为作业排在所有普通作业之后
+func (q *nodeQueue) enqueue(job *prefillJob) {
+	i := sort.Search(len(q.waiting), func(i int) bool { return job.precedes(q.waiting[i]) })
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = job
+}
+
+// advanceTo 执行到now为止能完成的作业，按完成顺序返回
+func (q *nodeQueue) advanceTo(now float64) []*prefillJob {
+	if q.batching != nil {
+		return q.advanceBatchesTo(now)
+	}
+	var completed []*prefillJob
+	for {
+		if q.running == nil {
+			if len(q.waiting) == 0 || q.waiting[0].ArrivalMs > now {
+				return completed
+			}
+			q.start(q.waiting[0].ArrivalMs)
+		}
+		if q.running.FinishMs > now {
+			return completed
+		}
+		finished := q.running
+		completed = append(completed, finished)
+		q.running = nil
+		if len(q.waiting) > 0 {
+			q.start(max(finished.FinishMs, q.waiting[0].ArrivalMs))
+		}
+	}
+}
+
+// start 在at时刻开始执行队首作业
+func (q *nodeQueue) start(at float64) {
+	job := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	job.StartMs = at
+	job.FinishMs = at + job.ServiceMs
+	q.running = job
+}
+
+// drop 丢弃所有在途作业（节点崩溃），返回被丢弃的作业
+func (q *nodeQueue) drop() []*prefillJob {
+	dropped := append(q.batch, q.waiting...)
+	if q.running != nil {
+		dropped = append([]*prefillJob{q.running}, dropped...)
+	}
+	q.running, q.waiting, q.batch = nil, nil, nil
+	return dropped
+}
+
+// cancel 在at时刻撤下尚未完成的作业，返回作业是否仍在队列中；执行中的作业被撤下后服务台立即空出
+func (q *nodeQueue) cancel(job *prefillJob, at float64) bool {
+	if q.running == job {
+		q.running = nil
+		if len(q.waiting) > 0 {
+			q.start(max(at, q.waiting[0].ArrivalMs))
+		}
+		return true
+	}
+	for _, jobs := range []*[]*prefillJob{&q.waiting, &q.batch} {
+		for i, queued := range *jobs {
+			if queued == job {
+				*jobs = append((*jobs)[:i], (*jobs)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queuedWork now时刻节点上尚未完成的工作量（毫秒）
+func (q *nodeQueue) queuedWork(now float64) float64 {
+	if q.batching != nil {
+		return q.batchQueuedWork(now)
+	}
+	work := 0.0
+	if q.running != nil {
+		work += max(q.running.FinishMs-now, 0)
+	}
+	for _, job := range q.waiting {
+		work += job.ServiceMs
+	}
+	return work
+}
+
+// QueuedWork 节点在now时刻的积压工作量（毫秒），即新请求的预计排队时间
+func (n *PrefillNode) QueuedWork(now float64) float64 {
+	return n.jobs.queuedWork(now)
+}
+
+// QueueLength 节点上排队与执行中的作业数
+func (n *PrefillNode) QueueLength() int {
+	length := len(n.jobs.waiting) + len(n.jobs.batch)
+	if n.jobs.running != nil {
+		length++
+	}
+	return length
+}
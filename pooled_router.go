@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ============= 请求分类与分池路由（ARCH.md 生产架构：智能两层设计） =============
+//
+// 第一层按请求特征分类：高频模板 → 热点池，长序列 → 序列池，其余 → 常规池；
+// 第二层每个池拥有独立的节点分区与选择器（默认 Random / 热点迁移 / 最长前缀匹配）。
+
+// RequestType 请求类别
+type RequestType int
+
+const (
+	RequestRegular  RequestType = iota // 常规对话
+	RequestHotspot                     // 热门模板
+	RequestSequence                    // 长文档、长上下文
+	requestTypeCount
+)
+
+func (t RequestType) String() string {
+	switch t {
+	case RequestHotspot:
+		return "HOTSPOT"
+	case RequestSequence:
+		return "SEQUENCE"
+	default:
+		return "REGULAR"
+	}
+}
+
+// RequestClassifier 请求分类器。模板以前TemplateBlocks个block标识：hash链中第k个block的hash
+// 已唯一确定整个前缀，因此直接以它为键在Count-Min Sketch中计数
+type RequestClassifier struct {
+	TemplateBlocks int // 模板前缀的block数
+	HotThreshold   int // 近期出现次数达到该值的模板视为热点
+	SequenceTokens int // InputLength超过该值视为长序列
+
+	sketch *countMinSketch
+	counts [requestTypeCount]int
+}
+
+// NewRequestClassifier window为热度统计窗口（请求数），每window个请求计数减半
+func NewRequestClassifier(templateBlocks, hotThreshold, sequenceTokens, window int) *RequestClassifier {
+	return &RequestClassifier{
+		TemplateBlocks: templateBlocks,
+		HotThreshold:   hotThreshold,
+		SequenceTokens: sequenceTokens,
+		sketch:         newCountMinSketch(4096, window),
+	}
+}
+
+// Classify 记录请求的模板并返回其类别（热点检测优先于长序列检测）
+func (c *RequestClassifier) Classify(request *Request) RequestType {
+	requestType := RequestRegular
+	if len(request.HashIDs) >= c.TemplateBlocks && c.TemplateBlocks > 0 {
+		key := request.HashIDs[c.TemplateBlocks-1]
+		c.sketch.Increment(key)
+		if c.sketch.Estimate(key) >= c.HotThreshold {
+			requestType = RequestHotspot
+		}
+	}
+	if requestType == RequestRegular && request.InputLength > c.SequenceTokens {
+		requestType = RequestSequence
+	}
+	c.counts[requestType]++
+	return requestType
+}
+
+// Distribution 各类别的请求数
+func (c *RequestClassifier) Distribution() [requestTypeCount]int {
+	return c.counts
+}
+
+// RoutingPool 一个路由池：节点分区 + 独立选择器
+type RoutingPool struct {
+	Type     RequestType
+	Selector PrefillNodeSelector
+	Share    float64 // 期望的节点占比
+
+	nodes []*PrefillNode
+
+	// 池内指标（请求完成时统计）
+	Requests  int
+	Completed int
+	Hits      int
+	Misses    int
+	totalTTFT float64
+	nodeLoads map[string]int
+}
+
+// PoolMetrics 池的汇总指标
+type PoolMetrics struct {
+	Name          string
+	Selector      string
+	Nodes         int
+	Requests      int
+	HitRate       float64
+	Concentration float64 // 池内负载集中度
+	AvgTTFT       float64
+}
+
+// Metrics 汇总池内指标
+func (p *RoutingPool) Metrics() PoolMetrics {
+	metrics := PoolMetrics{
+		Name:     p.Type.String(),
+		Selector: p.Selector.GetName(),
+		Nodes:    len(p.nodes),
+		Requests: p.Requests,
+	}
+	if p.Hits+p.Misses > 0 {
+		metrics.HitRate = float64(p.Hits) / float64(p.Hits+p.Misses)
+	}
+	if p.Completed > 0 {
+		metrics.AvgTTFT = p.totalTTFT / float64(p.Completed)
+		maxLoad := 0
+		for _, load := range p.nodeLoads {
+			maxLoad = max(maxLoad, load)
+		}
+		metrics.Concentration = float64(maxLoad) / float64(p.Completed)
+	}
+	return metrics
+}
+
+// PooledRouter 分池路由器，实现PrefillNodeSelector
+type PooledRouter struct {
+	Classifier *RequestClassifier
+	Pools      [requestTypeCount]*RoutingPool
+
+	partitioned []*PrefillNode // 上次分区时的节点列表
+	inflight    map[*Request]pooledRoute
+}
+
+// pooledRoute 在途请求的路由记录（池的选择器可能在请求完成前被替换）
+type pooledRoute struct {
+	pool     *RoutingPool
+	selector PrefillNodeSelector
+}
+
+// NewPooledRouter shares为常规/热点/序列池的节点占比
+func NewPooledRouter(classifier *RequestClassifier, selectors [requestTypeCount]PrefillNodeSelector, shares [requestTypeCount]float64) *PooledRouter {
+	router := &PooledRouter{
+		Classifier: classifier,
+		inflight:   make(map[*Request]pooledRoute),
+	}
+	for t := range router.Pools {
+		router.Pools[t] = &RoutingPool{
+			Type:      RequestType(t),
+			Selector:  selectors[t],
+			Share:     shares[t],
+			nodeLoads: make(map[string]int),
+		}
+	}
+	return router
+}
+
+// NewDefaultPooledRouter ARCH.md中的配置：70%常规池Random，20%热点池热点迁移，10%序列池前缀匹配
+func NewDefaultPooledRouter() *PooledRouter {
+	return NewPooledRouter(
+		NewRequestClassifier(8, 20, 16384, 1000),
+		[requestTypeCount]PrefillNodeSelector{
+			&RandomNodeSelector{},
+			NewPrefixAwareHotspotSelector(0.6, 0.8, 0.4, 0.1),
+			NewLongestPrefixSelector(1.5, 32, 0.3),
+		},
+		[requestTypeCount]float64{0.7, 0.2, 0.1},
+	)
+}
+
+// SetPoolSelector 替换某个池的选择器（降级、策略切换）
+func (r *PooledRouter) SetPoolSelector(t RequestType, selector PrefillNodeSelector) {
+	r.Pools[t].Selector = selector
+}
+
+func (r *PooledRouter) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	r.ensurePartition(nodes)
+
+	pool := r.Pools[r.Classifier.Classify(request)]
+	candidates := pool.nodes
+	if len(candidates) == 0 {
+		candidates = nodes // 节点数少于池数时空池退回全部节点
+	}
+	node := pool.Selector.SelectNode(request, candidates)
+	if node != nil {
+		pool.Requests++
+		r.inflight[request] = pooledRoute{pool: pool, selector: pool.Selector}
+	}
+	return node
+}
+
+// ensurePartition 节点集合变化时按占比重新分区：每个池至少一个节点（节点数足够时），
+// 余数按小数部分从大到小分配
+func (r *PooledRouter) ensurePartition(nodes []*PrefillNode) {
+	if len(nodes) == len(r.partitioned) {
+		same := true
+		for i, node := range nodes {
+			if r.partitioned[i] != node {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	r.partitioned = append([]*PrefillNode{}, nodes...)
+
+	counts := partitionCounts(len(nodes), r.Pools)
+	offset := 0
+	for t, pool := range r.Pools {
+		pool.nodes = nodes[offset : offset+counts[t]]
+		offset += counts[t]
+	}
+}
+
+func partitionCounts(n int, pools [requestTypeCount]*RoutingPool) [requestTypeCount]int {
+	var counts [requestTypeCount]int
+	totalShare := 0.0
+	for _, pool := range pools {
+		totalShare += pool.Share
+	}
+
+	assigned := 0
+	order := make([]int, 0, requestTypeCount)
+	for t, pool := range pools {
+		counts[t] = int(math.Floor(pool.Share / totalShare * float64(n)))
+		assigned += counts[t]
+		order = append(order, t)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		fi := pools[order[i]].Share/totalShare*float64(n) - float64(counts[order[i]])
+		fj := pools[order[j]].Share/totalShare*float64(n) - float64(counts[order[j]])
+		return fi > fj
+	})
+	for i := 0; assigned < n; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+
+	// 保证每个池至少一个节点：从节点最多的池中借
+	if n >= int(requestTypeCount) {
+		for t := range counts {
+			for counts[t] == 0 {
+				largest := 0
+				for u := range counts {
+					if counts[u] > counts[largest] {
+						largest = u
+					}
+				}
+				counts[largest]--
+				counts[t]++
+			}
+		}
+	}
+	return counts
+}
+
+// OnRequestCompleted 实现SelectionObserver：统计池内指标并转发给池的选择器
+func (r *PooledRouter) OnRequestCompleted(request *Request, result *PrefillResult) {
+	route, exists := r.inflight[request]
+	if !exists {
+		return
+	}
+	delete(r.inflight, request)
+
+	pool := route.pool
+	pool.Completed++
+	pool.Hits += result.CacheHits
+	pool.Misses += result.CacheMisses
+	pool.totalTTFT += result.TTFT
+	pool.nodeLoads[result.SelectedNode.ID]++
+
+	if observer, ok := route.selector.(SelectionObserver); ok {
+		observer.OnRequestCompleted(request, result)
+	}
+}
+
+// OnRequestFailed 实现FailureObserver：转发给路由该请求的池选择器
+func (r *PooledRouter) OnRequestFailed(request *Request, at float64) {
+	route, exists := r.inflight[request]
+	if !exists {
+		return
+	}
+	delete(r.inflight, request)
+
+	if observer, ok := route.selector.(FailureObserver); ok {
+		observer.OnRequestFailed(request, at)
+	}
+}
+
+// BestEffort 实现BestEffortHinter：转发给路由该请求的池选择器
+func (r *PooledRouter) BestEffort(request *Request) bool {
+	route, exists := r.inflight[request]
+	if !exists {
+		return false
+	}
+	hinter, ok := route.selector.(BestEffortHinter)
+	return ok && hinter.BestEffort(request)
+}
+
+// PoolMetrics 各池的汇总指标
+func (r *PooledRouter) PoolMetrics() []PoolMetrics {
+	metrics := make([]PoolMetrics, len(r.Pools))
+	for t, pool := range r.Pools {
+		metrics[t] = pool.Metrics()
+	}
+	return metrics
+}
+
+func (r *PooledRouter) GetName() string {
+	return fmt.Sprintf("PooledRouter(%s/%s/%s)",
+		r.Pools[RequestRegular].Selector.GetName(),
+		r.Pools[RequestHotspot].Selector.GetName(),
+		r.Pools[RequestSequence].Selector.GetName())
+}
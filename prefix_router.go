@@ -0,0 +1,69 @@
+package main
+
+import "fmt"
+
+// ============= 接口实现：最长前缀匹配路由（SGLang / vLLM production-stack 风格） =============
+
+// LongestPrefixSelector 路由到连续前缀命中最长的节点；该节点负载同时超过
+// BalanceRelThreshold × 集群最小负载 与 最小负载 + BalanceAbsThreshold 时回退到最小负载节点。
+// 与SGLang路由一致，负载取路由器自身记录的最近分配数
+type LongestPrefixSelector struct {
+	BalanceRelThreshold float64 // 相对负载阈值（最长前缀节点负载 / 最小负载）
+	BalanceAbsThreshold int     // 绝对负载阈值（最长前缀节点负载 - 最小负载）
+	CacheThreshold      float64 // 最长匹配占请求block数的比例低于此值时不按前缀路由
+
+	PrefixRouted  int // 按最长前缀路由的请求数
+	LoadFallbacks int // 因负载超阈值回退的请求数
+	MissFallbacks int // 因匹配比例不足回退的请求数
+	window        *assignmentWindow
+}
+
+func NewLongestPrefixSelector(relThreshold float64, absThreshold int, cacheThreshold float64) *LongestPrefixSelector {
+	return &LongestPrefixSelector{
+		BalanceRelThreshold: relThreshold,
+		BalanceAbsThreshold: absThreshold,
+		CacheThreshold:      cacheThreshold,
+		window:              newAssignmentWindow(1000),
+	}
+}
+
+func (l *LongestPrefixSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	// 最长前缀节点（匹配相同时取负载低者）与最小负载节点（负载相同时取缓存占用少者）
+	var bestNode, leastLoaded *PrefillNode
+	bestHits := -1
+	for _, node := range nodes {
+		load := l.window.load(node)
+		hits := contiguousPrefixHits(request, node)
+		if hits > bestHits || (hits == bestHits && load < l.window.load(bestNode)) {
+			bestNode, bestHits = node, hits
+		}
+		if leastLoaded == nil || load < l.window.load(leastLoaded) ||
+			(load == l.window.load(leastLoaded) && len(node.CacheBlocks) < len(leastLoaded.CacheBlocks)) {
+			leastLoaded = node
+		}
+	}
+
+	selected := bestNode
+	bestLoad, minLoad := l.window.load(bestNode), l.window.load(leastLoaded)
+	switch {
+	case float64(bestHits) < l.CacheThreshold*float64(len(request.HashIDs)):
+		selected = leastLoaded
+		l.MissFallbacks++
+	case float64(bestLoad) > l.BalanceRelThreshold*float64(minLoad) && bestLoad-minLoad > l.BalanceAbsThreshold:
+		selected = leastLoaded
+		l.LoadFallbacks++
+	default:
+		l.PrefixRouted++
+	}
+
+	l.window.record(selected)
+	return selected
+}
+
+func (l *LongestPrefixSelector) GetName() string {
+	return fmt.Sprintf("LongestPrefix(rel=%.2f,abs=%d,cache=%.2f)", l.BalanceRelThreshold, l.BalanceAbsThreshold, l.CacheThreshold)
+}
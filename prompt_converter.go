@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ============= Prompt日志 → block哈希链转换 =============
+//
+// 与vLLM/Mooncake的前缀缓存一致：token序列按固定大小切分为block，每个block的hash
+// 由父block的hash与本block的token共同决定，因此相同hash意味着相同的完整前缀。
+
+// Tokenizer 分词器接口
+type Tokenizer interface {
+	// Encode 将文本编码为token ID序列
+	Encode(text string) []int
+	// GetName 获取分词器名称
+	GetName() string
+}
+
+// WhitespaceTokenizer 按空白与标点切分，每个词的FNV哈希作为token ID（近似词级分词）
+type WhitespaceTokenizer struct{}
+
+func (w *WhitespaceTokenizer) Encode(text string) []int {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+	tokens := make([]int, len(words))
+	for i, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		tokens[i] = int(h.Sum32())
+	}
+	return tokens
+}
+
+func (w *WhitespaceTokenizer) GetName() string {
+	return "whitespace"
+}
+
+// ByteTokenizer 每个UTF-8字节一个token（token数的上界估计）
+type ByteTokenizer struct{}
+
+func (b *ByteTokenizer) Encode(text string) []int {
+	tokens := make([]int, len(text))
+	for i := 0; i < len(text); i++ {
+		tokens[i] = int(text[i])
+	}
+	return tokens
+}
+
+func (b *ByteTokenizer) GetName() string {
+	return "byte"
+}
+
+var tokenizerRegistry = map[string]func() Tokenizer{
+	"whitespace": func() Tokenizer { return &WhitespaceTokenizer{} },
+	"byte":       func() Tokenizer { return &ByteTokenizer{} },
+}
+
+// RegisterTokenizer 注册分词器（如接入真实BPE分词器）
+func RegisterTokenizer(name string, factory func() Tokenizer) {
+	tokenizerRegistry[name] = factory
+}
+
+// LookupTokenizer 按名称创建分词器
+func LookupTokenizer(name string) (Tokenizer, error) {
+	factory, exists := tokenizerRegistry[name]
+	if !exists {
+		names := make([]string, 0, len(tokenizerRegistry))
+		for n := range tokenizerRegistry {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown tokenizer %q (available: %v)", name, names)
+	}
+	return factory(), nil
+}
+
+// BlockHasher 计算链式block哈希并映射为紧凑的整数hash ID（与轨迹格式一致）
+type BlockHasher struct {
+	BlockSize           int  // 每个block的token数
+	IncludePartialBlock bool // 末尾不足BlockSize的block是否也参与哈希（Mooncake轨迹包含，vLLM不包含）
+	ids                 map[uint64]int
+	nextID              int
+}
+
+func NewBlockHasher(blockSize int, includePartial bool) (*BlockHasher, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("block size must be positive, got %d", blockSize)
+	}
+	return &BlockHasher{
+		BlockSize:           blockSize,
+		IncludePartialBlock: includePartial,
+		ids:                 make(map[uint64]int),
+	}, nil
+}
+
+// HashChain 返回token序列对应的hash ID链
+func (h *BlockHasher) HashChain(tokens []int) []int {
+	chain := make([]int, 0, ceilDiv(len(tokens), h.BlockSize))
+	parent := uint64(0)
+	buf := make([]byte, 8)
+	for start := 0; start < len(tokens); start += h.BlockSize {
+		end := min(start+h.BlockSize, len(tokens))
+		if end-start < h.BlockSize && !h.IncludePartialBlock {
+			break
+		}
+
+		hasher := fnv.New64a()
+		binary.LittleEndian.PutUint64(buf, parent)
+		hasher.Write(buf)
+		for _, token := range tokens[start:end] {
+			binary.LittleEndian.PutUint64(buf, uint64(token))
+			hasher.Write(buf)
+		}
+		parent = hasher.Sum64()
+
+		id, exists := h.ids[parent]
+		if !exists {
+			id = h.nextID
+			h.nextID++
+			h.ids[parent] = id
+		}
+		chain = append(chain, id)
+	}
+	return chain
+}
+
+// PromptRecord prompt日志记录：token_ids优先于prompt文本，output_length缺失时由output文本推算
+type PromptRecord struct {
+	Timestamp    *int   `json:"timestamp"`
+	Prompt       string `json:"prompt"`
+	TokenIDs     []int  `json:"token_ids"`
+	Output       string `json:"output"`
+	OutputLength *int   `json:"output_length"`
+}
+
+// PromptConverter 将prompt日志转换为轨迹请求
+type PromptConverter struct {
+	Tokenizer Tokenizer
+	Hasher    *BlockHasher
+	lastTs    int
+}
+
+func NewPromptConverter(tokenizer Tokenizer, hasher *BlockHasher) *PromptConverter {
+	return &PromptConverter{Tokenizer: tokenizer, Hasher: hasher}
+}
+
+// Convert 转换一条记录；缺少时间戳时沿用上一条的时间戳
+func (c *PromptConverter) Convert(record *PromptRecord) (*Request, error) {
+	tokens := record.TokenIDs
+	if len(tokens) == 0 {
+		tokens = c.Tokenizer.Encode(record.Prompt)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty prompt")
+	}
+
+	hashIDs := c.Hasher.HashChain(tokens)
+	if len(hashIDs) == 0 {
+		return nil, fmt.Errorf("prompt shorter than one block (%d tokens)", len(tokens))
+	}
+
+	timestamp := c.lastTs
+	if record.Timestamp != nil {
+		timestamp = *record.Timestamp
+	}
+	c.lastTs = timestamp
+
+	outputLength := len(c.Tokenizer.Encode(record.Output))
+	if record.OutputLength != nil {
+		outputLength = *record.OutputLength
+	}
+
+	return &Request{
+		Timestamp:    timestamp,
+		InputLength:  len(tokens),
+		OutputLength: outputLength,
+		HashIDs:      hashIDs,
+	}, nil
+}
+
+// ConvertPromptLog 逐行读取JSONL格式的prompt日志并写出轨迹，返回写出的请求数与被跳过的记录
+func ConvertPromptLog(r io.Reader, writer TraceWriter, converter *PromptConverter, opts TraceLoadOptions) (int, TraceSkipReport, error) {
+	lines := newLineReader(r, opts.MaxLineBytes)
+	errLog := &traceErrorLog{opts: opts}
+
+	line, written := 0, 0
+	for {
+		data, err := lines.Next()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil && !errors.Is(err, bufio.ErrTooLong) {
+			return written, errLog.SkipReport(), &TraceLineError{Line: line, Err: err}
+		}
+		if err == nil && isBlank(data) {
+			continue
+		}
+
+		var request *Request
+		if err == nil {
+			var record PromptRecord
+			if err = json.Unmarshal(data, &record); err == nil {
+				request, err = converter.Convert(&record)
+			}
+		}
+		if err != nil {
+			if lineErr := errLog.record(line, err); lineErr != nil {
+				return written, errLog.SkipReport(), lineErr
+			}
+			continue
+		}
+
+		if err := writer.Write(request); err != nil {
+			return written, errLog.SkipReport(), err
+		}
+		written++
+	}
+	return written, errLog.SkipReport(), nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ============= 过载准入控制与提前拒绝 =============
+//
+// 准入控制在选择节点之前决定请求的去留：接受、拒绝或推迟重试。推迟的请求按重试时间排队，
+// 在后续请求到达前重新判定，等待超过MaxDeferMs后拒绝。
+// decode阶段以固定槽位的简化模型表示：prefill完成时若decode槽位已满，请求在prefill之后被拒绝，
+// 已完成的prefill计算即为浪费。Mooncake的提前拒绝按预测的prefill完成时刻的decode负载在入口处拒绝，
+// 避免这部分浪费。
+
+var (
+	// ErrRequestRejected 请求被准入控制拒绝
+	ErrRequestRejected = errors.New("request rejected by admission control")
+	// ErrRequestDeferred 请求被推迟，稍后重新判定
+	ErrRequestDeferred = errors.New("request deferred by admission control")
+)
+
+// AdmissionDecision 准入判定结果
+type AdmissionDecision int
+
+const (
+	AdmitRequest  AdmissionDecision = iota // 接受
+	RejectRequest                          // 拒绝
+	DeferRequest                           // 推迟重试
+)
+
+// RequestAdmissionPolicy 请求准入策略（区别于决定block能否写入缓存的CacheAdmissionPolicy）
+type RequestAdmissionPolicy interface {
+	// Decide 判定now时刻到达的请求，nodes为可调度节点
+	Decide(request *Request, nodes []*PrefillNode, now float64) AdmissionDecision
+	GetName() string
+}
+
+// NoAdmissionControl 接受所有请求（基线）
+type NoAdmissionControl struct{}
+
+func (p *NoAdmissionControl) Decide(request *Request, nodes []*PrefillNode, now float64) AdmissionDecision {
+	return AdmitRequest
+}
+
+func (p *NoAdmissionControl) GetName() string {
+	return "None"
+}
+
+// overloadDecision 过载时按配置拒绝或推迟
+func overloadDecision(deferOnOverload bool) AdmissionDecision {
+	if deferOnOverload {
+		return DeferRequest
+	}
+	return RejectRequest
+}
+
+// QueueThresholdPolicy 所有节点的队列长度都达到MaxQueue时判定过载
+type QueueThresholdPolicy struct {
+	MaxQueue int
+	Defer    bool // 过载时推迟而不是拒绝
+}
+
+func (p *QueueThresholdPolicy) Decide(request *Request, nodes []*PrefillNode, now float64) AdmissionDecision {
+	for _, node := range nodes {
+		if node.QueueLength() < p.MaxQueue {
+			return AdmitRequest
+		}
+	}
+	return overloadDecision(p.Defer)
+}
+
+func (p *QueueThresholdPolicy) GetName() string {
+	action := "reject"
+	if p.Defer {
+		action = "defer"
+	}
+	return fmt.Sprintf("Queue(≥%d,%s)", p.MaxQueue, action)
+}
+
+// PredictedTTFTPolicy 所有节点上的预测TTFT都超过SLO时判定过载
+type PredictedTTFTPolicy struct {
+	Model *TTFTCostModel
+	SLOMs float64
+	Defer bool
+}
+
+func (p *PredictedTTFTPolicy) Decide(request *Request, nodes []*PrefillNode, now float64) AdmissionDecision {
+	if _, ttft := bestPredictedTTFT(p.Model, request, nodes, now); ttft <= p.SLOMs {
+		return AdmitRequest
+	}
+	return overloadDecision(p.Defer)
+}
+
+func (p *PredictedTTFTPolicy) GetName() string {
+	action := "reject"
+	if p.Defer {
+		action = "defer"
+	}
+	return fmt.Sprintf("PredictedTTFT(%.0fms,%s)", p.SLOMs, action)
+}
+
+// bestPredictedTTFT 预测TTFT最小的节点及其预测值，无节点时返回+∞
+func bestPredictedTTFT(model *TTFTCostModel, request *Request, nodes []*PrefillNode, now float64) (*PrefillNode, float64) {
+	var best *PrefillNode
+	bestTTFT := 0.0
+	for _, node := range nodes {
+		ttft := model.Predict(request, node, now)
+		if best == nil || ttft < bestTTFT {
+			best, bestTTFT = node, ttft
+		}
+	}
+	if best == nil {
+		return nil, float64(1 << 62)
+	}
+	return best, bestTTFT
+}
+
+// EarlyRejectionPolicy Mooncake的基于预测的提前拒绝：预测TTFT超过SLO，或预测请求prefill完成时刻的
+// decode负载超过Threshold×槽位数时在入口处拒绝；接受的请求在decode模型中预留预测的decode区间
+type EarlyRejectionPolicy struct {
+	Model     *TTFTCostModel
+	Decode    *DecodeLoadTracker
+	SLOMs     float64
+	Threshold float64 // decode负载上限（占槽位的比例）
+}
+
+func (p *EarlyRejectionPolicy) Decide(request *Request, nodes []*PrefillNode, now float64) AdmissionDecision {
+	_, ttft := bestPredictedTTFT(p.Model, request, nodes, now)
+	finish := now + ttft
+	if ttft > p.SLOMs || float64(p.Decode.LoadAt(finish)) >= p.Threshold*float64(p.Decode.Slots) {
+		return RejectRequest
+	}
+	p.Decode.reserve(request, finish)
+	return AdmitRequest
+}
+
+func (p *EarlyRejectionPolicy) GetName() string {
+	return fmt.Sprintf("EarlyRejection(%.0fms,decode≥%.0f%%)", p.SLOMs, p.Threshold*100)
+}
+
+// DecodeLoadTracker 简化的decode集群：Slots个并发槽位，每个请求占用OutputLength×MsPerToken
+type DecodeLoadTracker struct {
+	Slots      int
+	MsPerToken float64
+
+	active   []float64 // 进行中decode的结束时间
+	reserved map[*Request][2]float64
+}
+
+func NewDecodeLoadTracker(slots int, msPerToken float64) *DecodeLoadTracker {
+	return &DecodeLoadTracker{
+		Slots:      slots,
+		MsPerToken: msPerToken,
+		reserved:   make(map[*Request][2]float64),
+	}
+}
+
+func (d *DecodeLoadTracker) duration(request *Request) float64 {
+	return float64(request.OutputLength) * d.MsPerToken
+}
+
+// LoadAt 预测at时刻占用的decode槽位：进行中的decode加上已接受请求预留的区间
+func (d *DecodeLoadTracker) LoadAt(at float64) int {
+	load := 0
+	for _, end := range d.active {
+		if end > at {
+			load++
+		}
+	}
+	for _, interval := range d.reserved {
+		if interval[0] <= at && at < interval[1] {
+			load++
+		}
+	}
+	return load
+}
+
+func (d *DecodeLoadTracker) reserve(request *Request, start float64) {
+	d.reserved[request] = [2]float64{start, start + d.duration(request)}
+}
+
+// release 取消请求的预留区间（请求未能完成prefill）
+func (d *DecodeLoadTracker) release(request *Request) {
+	delete(d.reserved, request)
+}
+
+// admit prefill在finishMs完成的请求进入decode，槽位已满时返回false
+func (d *DecodeLoadTracker) admit(request *Request, finishMs float64) bool {
+	d.release(request)
+	running := d.active[:0]
+	for _, end := range d.active {
+		if end > finishMs {
+			running = append(running, end)
+		}
+	}
+	d.active = running
+	if len(d.active) >= d.Slots {
+		return false
+	}
+	d.active = append(d.active, finishMs+d.duration(request))
+	return true
+}
+
+// AdmissionStats 准入控制的统计
+type AdmissionStats struct {
+	Arrived             int     // 到达的请求数（不含重试）
+	Admitted            int     // 接受的请求数（含推迟后接受）
+	Rejected            int     // 入口处拒绝的请求数（含推迟超时）
+	DeferredRequests    int     // 至少被推迟过一次的请求数
+	Expired             int     // 推迟超时后拒绝的请求数
+	Completed           int     // 完成prefill并进入decode的请求数
+	PostPrefillRejected int     // prefill完成后因decode槽位已满被拒绝的请求数
+	WithinSLO           int     // 完成且TTFT（含推迟等待）不超过SLO的请求数
+	Failed              int     // 已接受但未能完成prefill的请求数（无可分配节点或节点崩溃丢失）
+	WastedPrefillMs     float64 // 被浪费的prefill计算时间（prefill后被拒绝）
+	FirstMs, LastMs     int     // 到达时间范围
+}
+
+// RejectionRate 入口拒绝与prefill后拒绝占到达请求的比例
+func (s *AdmissionStats) RejectionRate() float64 {
+	if s.Arrived == 0 {
+		return 0
+	}
+	return float64(s.Rejected+s.PostPrefillRejected) / float64(s.Arrived)
+}
+
+// Goodput 每秒满足SLO并进入decode的请求数
+func (s *AdmissionStats) Goodput() float64 {
+	if s.LastMs <= s.FirstMs {
+		return 0
+	}
+	return float64(s.WithinSLO) / (float64(s.LastMs-s.FirstMs) / 1000)
+}
+
+// deferredRequest 推迟队列中的请求
+type deferredRequest struct {
+	request *Request // 原始请求
+	retryAt int
+}
+
+// AdmissionController 请求准入控制器，实现SelectionObserver以统计完成结果
+type AdmissionController struct {
+	Policy     RequestAdmissionPolicy
+	Decode     *DecodeLoadTracker // 为nil时不模拟decode阶段
+	SLOMs      float64
+	RetryMs    int // 推迟后的重试间隔
+	MaxDeferMs int // 推迟等待的上限
+
+	Stats AdmissionStats
+
+	deferred []deferredRequest     // 按retryAt排序
+	arrivals map[*Request]int      // 已接受请求 -> 原始到达时间
+	retried  map[*Request]bool     // 被推迟过的原始请求
+	origins  map[*Request]*Request // 重试副本 -> 原始请求
+}
+
+func NewAdmissionController(policy RequestAdmissionPolicy, decode *DecodeLoadTracker, sloMs float64) *AdmissionController {
+	return &AdmissionController{
+		Policy:     policy,
+		Decode:     decode,
+		SLOMs:      sloMs,
+		RetryMs:    200,
+		MaxDeferMs: 2000,
+		arrivals:   make(map[*Request]int),
+		retried:    make(map[*Request]bool),
+		origins:    make(map[*Request]*Request),
+	}
+}
+
+// admit 判定请求；推迟的请求进入重试队列，超时的推迟转为拒绝
+func (c *AdmissionController) admit(request *Request, nodes []*PrefillNode) AdmissionDecision {
+	original := request
+	if o, exists := c.origins[request]; exists {
+		original = o
+		delete(c.origins, request)
+	} else {
+		c.Stats.Arrived++
+		if c.Stats.Arrived == 1 {
+			c.Stats.FirstMs = request.Timestamp
+		}
+		c.Stats.LastMs = max(c.Stats.LastMs, request.Timestamp)
+	}
+
+	decision := c.Policy.Decide(request, nodes, float64(request.Timestamp))
+	if decision == DeferRequest && request.Timestamp+c.RetryMs-original.Timestamp > c.MaxDeferMs {
+		decision = RejectRequest
+		c.Stats.Expired++
+	}
+	switch decision {
+	case AdmitRequest:
+		c.Stats.Admitted++
+		c.arrivals[request] = original.Timestamp
+	case RejectRequest:
+		c.Stats.Rejected++
+	case DeferRequest:
+		if !c.retried[original] {
+			c.retried[original] = true
+			c.Stats.DeferredRequests++
+		}
+		retry := deferredRequest{request: original, retryAt: request.Timestamp + c.RetryMs}
+		i := sort.Search(len(c.deferred), func(i int) bool { return c.deferred[i].retryAt > retry.retryAt })
+		c.deferred = append(c.deferred, deferredRequest{})
+		copy(c.deferred[i+1:], c.deferred[i:])
+		c.deferred[i] = retry
+	}
+	return decision
+}
+
+// dueRetries 取出retryAt不晚于now的推迟请求，返回以重试时间为到达时间的副本
+func (c *AdmissionController) dueRetries(now int) []*Request {
+	due := 0
+	for due < len(c.deferred) && c.deferred[due].retryAt <= now {
+		due++
+	}
+	retries := make([]*Request, due)
+	for i, d := range c.deferred[:due] {
+		retries[i] = cloneRequest(d.request)
+		retries[i].Timestamp = d.retryAt
+		c.origins[retries[i]] = d.request
+	}
+	c.deferred = c.deferred[due:]
+	return retries
+}
+
+// OnRequestCompleted 实现SelectionObserver：prefill完成后尝试进入decode并统计SLO达成
+func (c *AdmissionController) OnRequestCompleted(request *Request, result *PrefillResult) {
+	arrival, exists := c.arrivals[request]
+	if !exists {
+		return
+	}
+	delete(c.arrivals, request)
+
+	finish := float64(request.Timestamp) + result.TTFT
+	if c.Decode != nil && !c.Decode.admit(request, finish) {
+		c.Stats.PostPrefillRejected++
+		c.Stats.WastedPrefillMs += result.ProcessTime
+		return
+	}
+	c.Stats.Completed++
+	if finish-float64(arrival) <= c.SLOMs {
+		c.Stats.WithinSLO++
+	}
+}
+
+func (c *AdmissionController) GetName() string {
+	return c.Policy.GetName()
+}
+
+// OnRequestFailed 实现FailureObserver：已接受的请求未能完成
+func (c *AdmissionController) OnRequestFailed(request *Request, at float64) {
+	if _, exists := c.arrivals[request]; !exists {
+		return
+	}
+	delete(c.arrivals, request)
+	// 失败的请求不会进入decode，释放其预留，否则过期的预留会抬高后续的负载预测
+	if c.Decode != nil {
+		c.Decode.release(request)
+	}
+	c.Stats.Failed++
+}
+
+// SetAdmissionController 启用请求准入控制；RetryMs必须为正，否则推迟的请求会在同一时刻无限重试
+func (s *Simulator) SetAdmissionController(controller *AdmissionController) error {
+	if controller.RetryMs <= 0 {
+		return fmt.Errorf("admission retry interval must be positive, got %dms", controller.RetryMs)
+	}
+	if controller.MaxDeferMs < 0 {
+		return fmt.Errorf("admission max defer must not be negative, got %dms", controller.MaxDeferMs)
+	}
+	s.admission = controller
+	if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+		processor.AddObserver(controller)
+	}
+	return nil
+}
+
+// processAccepted 处理已被准入的请求，处理器未能分配时从在途记录中移除
+func (s *Simulator) processAccepted(request *Request) (*PrefillResult, error) {
+	result, err := s.processAdmitted(request)
+	if err != nil {
+		s.admission.OnRequestFailed(request, float64(request.Timestamp))
+	}
+	return result, err
+}
+
+// Drain 处理剩余的推迟请求并完成所有在途作业
+func (s *Simulator) Drain() {
+	if s.admission != nil {
+		for len(s.admission.deferred) > 0 {
+			s.processRetries(s.admission.deferred[0].retryAt)
+		}
+	}
+	s.processor.Drain()
+	// 排空期间缓存仍占用DRAM，block占用累计到最后一个作业完成（节点时间仍按到达跨度计）
+	if processor, ok := s.processor.(*BasicPrefillProcessor); ok && s.ticking {
+		if end := int(math.Ceil(processor.lastFinish)); end > s.lastTick {
+			s.blockMs += float64(s.cachedBlocks()) * float64(end-s.lastTick)
+			s.lastTick = end
+		}
+	}
+}
+
+// processRetries 按重试时间顺序重新判定所有到期的推迟请求
+func (s *Simulator) processRetries(now int) {
+	for _, retry := range s.admission.dueRetries(now) {
+		if s.admission.admit(retry, availableNodes(s.nodes)) == AdmitRequest {
+			s.processAccepted(retry)
+		}
+	}
+}
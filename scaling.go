@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ============= 弹性伸缩：节点扩容与缩容 =============
+//
+// 伸缩在模拟时间上生效：Simulator.ProcessRequest在处理每个请求前先应用到期的伸缩计划，
+// 再询问自动伸缩器。新节点以空缓存加入，可选地从现有节点复制热点前缀预热；
+// 缩容的节点立即停止接收新请求，最热的block迁移到其余节点，已在途的作业照常完成。
+
+// ScalingEvent 计划伸缩事件：Delta为正表示扩容，为负表示缩容
+type ScalingEvent struct {
+	AtMs  int
+	Delta int
+}
+
+// Autoscaler 自动伸缩策略
+type Autoscaler interface {
+	// Decide 返回应增加（正）或减少（负）的节点数与原因，0表示不调整
+	Decide(now int, nodes []*PrefillNode) (int, string)
+	GetName() string
+}
+
+// QueueLengthAutoscaler 按节点平均队列长度（指数平滑）伸缩，每次调整一个节点
+type QueueLengthAutoscaler struct {
+	ScaleOutQueue float64 // 平均队列长度超过该值时扩容
+	ScaleInQueue  float64 // 平均队列长度低于该值时缩容
+	MinNodes      int
+	MaxNodes      int
+	CooldownMs    int     // 两次调整之间的最短间隔
+	Smoothing     float64 // 指数平滑系数（每个请求），越小越平稳
+
+	smoothed   float64
+	lastAction int
+	acted      bool
+}
+
+func NewQueueLengthAutoscaler(scaleOut, scaleIn float64, minNodes, maxNodes, cooldownMs int) *QueueLengthAutoscaler {
+	return &QueueLengthAutoscaler{
+		ScaleOutQueue: scaleOut,
+		ScaleInQueue:  scaleIn,
+		MinNodes:      minNodes,
+		MaxNodes:      maxNodes,
+		CooldownMs:    cooldownMs,
+		Smoothing:     0.05,
+	}
+}
+
+func (a *QueueLengthAutoscaler) Decide(now int, nodes []*PrefillNode) (int, string) {
+	if len(nodes) == 0 {
+		return 0, ""
+	}
+	total := 0
+	for _, node := range nodes {
+		total += node.QueueLength()
+	}
+	current := float64(total) / float64(len(nodes))
+	a.smoothed += a.Smoothing * (current - a.smoothed)
+
+	if !a.acted {
+		// 首次观察视为一次调整，平滑值需要一个冷却期才能反映真实负载
+		a.acted, a.lastAction = true, now
+	}
+	if now-a.lastAction < a.CooldownMs {
+		return 0, ""
+	}
+	delta := 0
+	switch {
+	case a.smoothed > a.ScaleOutQueue && len(nodes) < a.MaxNodes:
+		delta = 1
+	case a.smoothed < a.ScaleInQueue && len(nodes) > a.MinNodes:
+		delta = -1
+	default:
+		return 0, ""
+	}
+	a.lastAction = now
+	return delta, fmt.Sprintf("平均队列%.2f", a.smoothed)
+}
+
+func (a *QueueLengthAutoscaler) GetName() string {
+	return fmt.Sprintf("QueueLength(out>%.1f,in<%.1f,%d-%d)", a.ScaleOutQueue, a.ScaleInQueue, a.MinNodes, a.MaxNodes)
+}
+
+// ScalingRecord 一次已执行的伸缩
+type ScalingRecord struct {
+	AtMs           int
+	NodeID         string
+	Added          bool
+	Reason         string
+	NodeCount      int // 调整后的节点数
+	WarmedBlocks   int // 扩容时预热复制的块数
+	MigratedBlocks int // 缩容时迁移的块数
+}
+
+// SetScalingSchedule 设置计划伸缩事件（按时间排序后依次生效）
+func (s *Simulator) SetScalingSchedule(events []ScalingEvent) {
+	s.scaling = append([]ScalingEvent{}, events...)
+	sort.SliceStable(s.scaling, func(i, j int) bool { return s.scaling[i].AtMs < s.scaling[j].AtMs })
+}
+
+// SetAutoscaler 设置自动伸缩器，warmup表示新节点是否预热热点前缀
+func (s *Simulator) SetAutoscaler(autoscaler Autoscaler, warmup bool) {
+	s.autoscaler = autoscaler
+	s.warmup = warmup
+}
+
+// tick 累计[lastTick, now)的节点时间与缓存占用
+func (s *Simulator) tick(now int) {
+	if s.ticking && now > s.lastTick {
+		s.nodeMs += float64(len(s.nodes)) * float64(now-s.lastTick)
+		s.blockMs += float64(s.cachedBlocks()) * float64(now-s.lastTick)
+	}
+	s.ticking, s.lastTick = true, now
+}
+
+// cachedBlocks 当前所有节点缓存的block总数
+func (s *Simulator) cachedBlocks() int {
+	blocks := 0
+	for _, node := range s.nodes {
+		blocks += len(node.CacheBlocks)
+	}
+	return blocks
+}
+
+// applyScaling 应用到期的计划事件与自动伸缩器的决定
+func (s *Simulator) applyScaling(now int) {
+	for len(s.scaling) > 0 && s.scaling[0].AtMs <= now {
+		event := s.scaling[0]
+		s.scaling = s.scaling[1:]
+		s.scaleBy(now, event.Delta, "计划")
+	}
+	if s.autoscaler != nil {
+		if delta, reason := s.autoscaler.Decide(now, availableNodes(s.nodes)); delta != 0 {
+			s.scaleBy(now, delta, reason)
+		}
+	}
+}
+
+func (s *Simulator) scaleBy(now, delta int, reason string) {
+	for ; delta > 0; delta-- {
+		s.AddNode(now, reason)
+	}
+	for ; delta < 0; delta++ {
+		if s.DrainNode(now, reason) == nil {
+			return
+		}
+	}
+}
+
+// AddNode 加入一个空缓存节点（开启预热时从现有节点复制热点前缀），返回新节点
+func (s *Simulator) AddNode(now int, reason string) *PrefillNode {
+	node := newPrefillNode(fmt.Sprintf("node-%d", s.nextNodeIndex), s.cacheSize, s.evictionAlgo)
+	s.nextNodeIndex++
+	if len(s.nodes) > 0 {
+		node.BlockTTL = s.nodes[0].BlockTTL
+		node.ResizeCache(s.nodes[0].MaxMemoryMB)
+		node.copyModels(s.nodes[0])
+	}
+	node.now = now
+	node.SetBatchScheduler(s.batching)
+
+	record := ScalingRecord{AtMs: now, NodeID: node.ID, Added: true, Reason: reason}
+	if s.warmup {
+		record.WarmedBlocks = s.warmNode(node)
+	}
+	s.nodes = append(s.nodes, node)
+	record.NodeCount = len(s.nodes)
+	s.scalingLog = append(s.scalingLog, record)
+	return node
+}
+
+// hotBlock 按命中次数排序的候选block
+type hotBlock struct {
+	hashID     int
+	parentHash int
+	hits       int
+	tenant     string // 复制时沿用的租户与模型归属
+	model      string
+}
+
+// hottestBlocks 按命中次数从高到低排列节点上命中过的block（只被写入过的block不算热点）
+func hottestBlocks(nodes []*PrefillNode) []hotBlock {
+	merged := make(map[int]*hotBlock)
+	for _, node := range nodes {
+		for hashID, block := range node.CacheBlocks {
+			if block.HitCount <= 1 {
+				continue
+			}
+			if candidate, exists := merged[hashID]; exists {
+				candidate.hits += block.HitCount
+				continue
+			}
+			merged[hashID] = &hotBlock{hashID: hashID, parentHash: block.ParentHash, hits: block.HitCount, tenant: block.Tenant, model: block.Model}
+		}
+	}
+	blocks := make([]hotBlock, 0, len(merged))
+	for _, candidate := range merged {
+		blocks = append(blocks, *candidate)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].hits != blocks[j].hits {
+			return blocks[i].hits > blocks[j].hits
+		}
+		return blocks[i].hashID < blocks[j].hashID
+	})
+	return blocks
+}
+
+// warmNode 把集群中最热的block复制到新节点，最多占用一半容量；
+// 只复制新节点托管的模型、且父block已在新节点上的block，保证前缀链连续可命中
+func (s *Simulator) warmNode(node *PrefillNode) int {
+	limit := node.capacityBlocks() / 2
+	warmed := 0
+	for _, candidate := range hottestBlocks(availableNodes(s.nodes)) {
+		if warmed >= limit {
+			break
+		}
+		if !node.Serves(candidate.model) {
+			continue
+		}
+		if _, exists := node.CacheBlocks[candidate.parentHash]; candidate.parentHash != -1 && !exists {
+			continue
+		}
+		node.addOwnedBlock(candidate.hashID, candidate.parentHash, candidate.tenant, candidate.model)
+		warmed++
+	}
+	return warmed
+}
+
+// DrainNode 缩容一个节点：选择积压最少的可调度节点（同等时选最后加入的），
+// 把它最热的block迁移到其余节点后移出集群，返回被移除的节点；至少保留一个可调度节点
+func (s *Simulator) DrainNode(now int, reason string) *PrefillNode {
+	available := availableNodes(s.nodes)
+	if len(available) <= 1 {
+		return nil
+	}
+	var victim *PrefillNode
+	for i := len(available) - 1; i >= 0; i-- {
+		if victim == nil || available[i].QueuedWork(float64(now)) < victim.QueuedWork(float64(now)) {
+			victim = available[i]
+		}
+	}
+
+	remaining := make([]*PrefillNode, 0, len(s.nodes)-1)
+	for _, node := range s.nodes {
+		if node != victim {
+			remaining = append(remaining, node)
+		}
+	}
+	s.nodes = remaining
+
+	record := ScalingRecord{
+		AtMs:           now,
+		NodeID:         victim.ID,
+		Reason:         reason,
+		NodeCount:      len(s.nodes),
+		MigratedBlocks: migrateBlocks(victim, availableNodes(s.nodes)),
+	}
+	s.scalingLog = append(s.scalingLog, record)
+	return victim
+}
+
+// migrateBlocks 把source上最热的block（最多一半容量）迁移到托管其模型且尚未持有它的目标节点：
+// 优先持有其父block的节点，其次空闲容量最多的节点；目标已满时按淘汰算法腾出空间
+func migrateBlocks(source *PrefillNode, targets []*PrefillNode) int {
+	if len(targets) == 0 {
+		return 0
+	}
+	limit := source.capacityBlocks() / 2
+	migrated := 0
+	for _, candidate := range hottestBlocks([]*PrefillNode{source}) {
+		if migrated >= limit {
+			break
+		}
+		var target *PrefillNode
+		bestScore := 0
+		for _, node := range targets {
+			if !node.Serves(candidate.model) {
+				continue
+			}
+			if _, exists := node.CacheBlocks[candidate.hashID]; exists {
+				target = nil
+				break
+			}
+			score := node.capacityBlocks() - len(node.CacheBlocks)
+			if _, exists := node.CacheBlocks[candidate.parentHash]; exists {
+				score += node.capacityBlocks()
+			}
+			if target == nil || score > bestScore {
+				target, bestScore = node, score
+			}
+		}
+		if target == nil {
+			continue // 已有副本
+		}
+		if len(target.CacheBlocks) >= target.capacityBlocks() && target.evictOne() == -1 {
+			continue
+		}
+		target.addOwnedBlock(candidate.hashID, candidate.parentHash, candidate.tenant, candidate.model)
+		migrated++
+	}
+	return migrated
+}
+
+// ScalingLog 已执行的伸缩记录
+func (s *Simulator) ScalingLog() []ScalingRecord {
+	return s.scalingLog
+}
+
+// movedBlocks 扩缩容时预热复制与迁移的块数（经网络传输）
+func (s *Simulator) movedBlocks() int {
+	moved := 0
+	for _, record := range s.scalingLog {
+		moved += record.WarmedBlocks + record.MigratedBlocks
+	}
+	return moved
+}
+
+// NodeSeconds 累计节点时间（节点数 × 秒），用于衡量资源成本
+func (s *Simulator) NodeSeconds() float64 {
+	return s.nodeMs / 1000
+}
+
+// BlockSeconds 累计缓存占用（缓存block数 × 秒），用于折算缓存存储成本
+func (s *Simulator) BlockSeconds() float64 {
+	return s.blockMs / 1000
+}
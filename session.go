@@ -0,0 +1,127 @@
+package main
+
+import "fmt"
+
+// ============= 会话推断 =============
+//
+// 轨迹中没有会话字段时，通过前缀链延续推断多轮对话：下一轮的上下文包含上一轮的
+// 全部内容，因此其HashIDs以上一轮的完整block链开头（末尾不完整block因追加内容会得到新hash）。
+
+// SessionTracker 按前缀链延续为请求分配会话ID
+type SessionTracker struct {
+	continuation map[int]int   // 上一轮末尾block的hash -> 会话ID（每个键只能被延续一次）
+	sessionKeys  map[int][]int // 会话ID -> 其登记的延续键
+	lastSeen     map[int]int   // 会话ID -> 最近一轮的到达时间
+	nextID       int
+}
+
+func NewSessionTracker() *SessionTracker {
+	return &SessionTracker{
+		continuation: make(map[int]int),
+		sessionKeys:  make(map[int][]int),
+		lastSeen:     make(map[int]int),
+	}
+}
+
+// Assign 返回请求所属的会话ID及其是否为已有会话的延续
+func (t *SessionTracker) Assign(request *Request) (int, bool) {
+	hashIDs := request.HashIDs
+	if len(hashIDs) == 0 {
+		// 没有block的请求既不能延续已有会话，也不会被后续请求延续：视为单轮的新会话
+		t.nextID++
+		return t.nextID - 1, false
+	}
+	sessionID, continued := -1, false
+
+	// 从最长前缀向下查找，必须严格长于上一轮才算延续
+	for i := len(hashIDs) - 2; i >= 0; i-- {
+		if id, exists := t.continuation[hashIDs[i]]; exists {
+			sessionID, continued = id, true
+			break
+		}
+	}
+	if !continued {
+		sessionID = t.nextID
+		t.nextID++
+	} else {
+		t.forget(sessionID)
+	}
+
+	t.lastSeen[sessionID] = request.Timestamp
+
+	// 登记本轮的延续键：最后一个block，以及可能不完整的末尾之前的block
+	n := len(hashIDs)
+	t.register(hashIDs[n-1], sessionID)
+	if n >= 2 {
+		if _, taken := t.continuation[hashIDs[n-2]]; !taken {
+			t.register(hashIDs[n-2], sessionID)
+		}
+	}
+	return sessionID, continued
+}
+
+func (t *SessionTracker) register(key int, sessionID int) {
+	t.continuation[key] = sessionID
+	t.sessionKeys[sessionID] = append(t.sessionKeys[sessionID], key)
+}
+
+// forget 移除会话上一轮登记的延续键，避免其他请求再次延续同一轮
+func (t *SessionTracker) forget(sessionID int) {
+	for _, key := range t.sessionKeys[sessionID] {
+		if t.continuation[key] == sessionID {
+			delete(t.continuation, key)
+		}
+	}
+	delete(t.sessionKeys, sessionID)
+}
+
+// ExpireBefore 结束最近一轮早于cutoff的会话：移除其延续键，之后的同前缀请求视为新会话
+func (t *SessionTracker) ExpireBefore(cutoff int) {
+	for sessionID, last := range t.lastSeen {
+		if last < cutoff {
+			t.forget(sessionID)
+			delete(t.lastSeen, sessionID)
+		}
+	}
+}
+
+// Key 返回请求的会话键：显式SessionID优先，缺失时按前缀链延续推断
+func (t *SessionTracker) Key(request *Request) string {
+	if request.SessionID != "" {
+		return request.SessionID
+	}
+	sessionID, _ := t.Assign(request)
+	return fmt.Sprintf("inferred-%d", sessionID)
+}
+
+// 会话最近一轮之后空闲超过该时长视为结束，释放路由绑定与指标中的逐会话状态
+const defaultSessionIdleMs = 10 * 60 * 1000
+
+// idleSessions 记录各会话最近一轮的时间，每隔idleMs扫描一次空闲会话（会话至多多保留一个周期）
+type idleSessions struct {
+	lastSeen  map[string]int
+	nextSweep int
+}
+
+func newIdleSessions() *idleSessions {
+	return &idleSessions{lastSeen: make(map[string]int)}
+}
+
+func (s *idleSessions) touch(key string, now int) {
+	s.lastSeen[key] = now
+}
+
+// sweep 距上次扫描满idleMs时返回最近一轮早于now-idleMs的会话并停止跟踪，swept表示本次进行了扫描
+func (s *idleSessions) sweep(now, idleMs int) (expired []string, swept bool) {
+	if idleMs <= 0 || now < s.nextSweep {
+		return nil, false
+	}
+	s.nextSweep = now + idleMs
+	for key, last := range s.lastSeen {
+		if last < now-idleMs {
+			expired = append(expired, key)
+			delete(s.lastSeen, key)
+		}
+	}
+	return expired, true
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ============= 会话粘性路由与跨轮复用指标 =============
+//
+// 多轮对话的每一轮都以上一轮的完整上下文开头，上一轮所在节点缓存着这段前缀。
+// 粘性路由把同一会话的后续轮次送回上一轮的节点，不必让选择器每轮重新发现亲和性；
+// 该节点积压明显高于最空闲节点时打破粘性，交给后备选择器重新选择并改绑到新节点。
+// 请求缺少SessionID时按前缀链延续在线推断会话（见session.go）。
+
+// StickyStats 粘性路由的决策统计
+type StickyStats struct {
+	NewSessions int // 会话首轮（交给后备选择器）
+	Sticky      int // 后续轮次回到上一轮节点
+	Broken      int // 上一轮节点过载而打破粘性
+	Lost        int // 上一轮节点已不可调度（故障、缩容或不托管该模型）
+}
+
+// StickyRate 后续轮次中保持粘性的比例
+func (s StickyStats) StickyRate() float64 {
+	followUps := s.Sticky + s.Broken + s.Lost
+	if followUps == 0 {
+		return 0
+	}
+	return float64(s.Sticky) / float64(followUps)
+}
+
+// StickySessionSelector 会话粘性选择器，首轮与打破粘性时使用后备选择器
+type StickySessionSelector struct {
+	Fallback     PrefillNodeSelector
+	BreakQueueMs float64 // 绑定节点积压超过最空闲节点该值（毫秒）时打破粘性，≤0表示从不打破
+	IdleMs       int     // 会话空闲超过该值（毫秒）后解除绑定，≤0表示永不过期
+	Stats        StickyStats
+
+	tracker *SessionTracker
+	pinned  map[string]*PrefillNode // 会话 -> 上一轮节点
+	idle    *idleSessions
+}
+
+func NewStickySessionSelector(fallback PrefillNodeSelector, breakQueueMs float64) *StickySessionSelector {
+	return &StickySessionSelector{
+		Fallback:     fallback,
+		BreakQueueMs: breakQueueMs,
+		IdleMs:       defaultSessionIdleMs,
+		tracker:      NewSessionTracker(),
+		pinned:       make(map[string]*PrefillNode),
+		idle:         newIdleSessions(),
+	}
+}
+
+func (s *StickySessionSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	s.expireIdle(request.Timestamp)
+	session := s.tracker.Key(request)
+	s.idle.touch(session, request.Timestamp)
+
+	if pinned, exists := s.pinned[session]; !exists {
+		s.Stats.NewSessions++
+	} else if !containsNode(nodes, pinned) {
+		s.Stats.Lost++
+	} else if s.overloaded(pinned, nodes, float64(request.Timestamp)) {
+		s.Stats.Broken++
+	} else {
+		s.Stats.Sticky++
+		return pinned
+	}
+
+	node := s.Fallback.SelectNode(request, nodes)
+	if node != nil {
+		s.pinned[session] = node
+	}
+	return node
+}
+
+// expireIdle 解除空闲会话的绑定
+func (s *StickySessionSelector) expireIdle(now int) {
+	expired, swept := s.idle.sweep(now, s.IdleMs)
+	if !swept {
+		return
+	}
+	for _, session := range expired {
+		delete(s.pinned, session)
+	}
+	s.tracker.ExpireBefore(now - s.IdleMs)
+}
+
+// overloaded 绑定节点的积压是否超过最空闲节点BreakQueueMs以上
+func (s *StickySessionSelector) overloaded(pinned *PrefillNode, nodes []*PrefillNode, now float64) bool {
+	if s.BreakQueueMs <= 0 {
+		return false
+	}
+	idlest := pinned.QueuedWork(now)
+	for _, node := range nodes {
+		idlest = math.Min(idlest, node.QueuedWork(now))
+	}
+	return pinned.QueuedWork(now)-idlest > s.BreakQueueMs
+}
+
+func containsNode(nodes []*PrefillNode, target *PrefillNode) bool {
+	for _, node := range nodes {
+		if node == target {
+			return true
+		}
+	}
+	return false
+}
+
+// OnRequestCompleted 实现SelectionObserver：转发给后备选择器
+func (s *StickySessionSelector) OnRequestCompleted(request *Request, result *PrefillResult) {
+	if observer, ok := s.Fallback.(SelectionObserver); ok {
+		observer.OnRequestCompleted(request, result)
+	}
+}
+
+// OnRequestFailed 实现FailureObserver：转发给后备选择器
+func (s *StickySessionSelector) OnRequestFailed(request *Request, at float64) {
+	if observer, ok := s.Fallback.(FailureObserver); ok {
+		observer.OnRequestFailed(request, at)
+	}
+}
+
+// BestEffort 实现BestEffortHinter：转发给后备选择器
+func (s *StickySessionSelector) BestEffort(request *Request) bool {
+	if hinter, ok := s.Fallback.(BestEffortHinter); ok {
+		return hinter.BestEffort(request)
+	}
+	return false
+}
+
+func (s *StickySessionSelector) GetName() string {
+	if s.BreakQueueMs <= 0 {
+		return fmt.Sprintf("StickySession(%s)", s.Fallback.GetName())
+	}
+	return fmt.Sprintf("StickySession(%s,break>%.0fms)", s.Fallback.GetName(), s.BreakQueueMs)
+}
+
+// ============= 会话级复用指标 =============
+
+// SessionRecord 单个会话的跨轮复用情况
+type SessionRecord struct {
+	ID            string
+	Turns         int
+	CarriedBlocks int // 后续轮次中与上一轮共享的前缀block数（理论上可复用）
+	ReusedBlocks  int // 其中处理时已缓存（连续前缀命中）的block数
+	SameNode      int // 与上一轮路由到同一节点的后续轮次数
+
+	lastHashIDs []int
+	lastNode    *PrefillNode
+}
+
+// ReuseRate 跨轮复用率：上一轮前缀在本轮实际命中的比例
+func (r *SessionRecord) ReuseRate() float64 {
+	if r.CarriedBlocks == 0 {
+		return 0
+	}
+	return float64(r.ReusedBlocks) / float64(r.CarriedBlocks)
+}
+
+// SessionMetrics 按会话统计跨轮前缀复用，实现SelectionObserver（通过AddObserver注册）。
+// 缺少SessionID的请求按完成顺序推断会话，为保证一致建议先用FillSessionIDs补全轨迹。
+// 空闲超过IdleMs的会话计入汇总后释放逐会话记录
+type SessionMetrics struct {
+	IdleMs int // 会话空闲超过该值（毫秒）后结束，≤0表示保留全部会话记录
+
+	tracker  *SessionTracker
+	sessions map[string]*SessionRecord // 活跃会话
+	retired  SessionSummary            // 已结束会话的汇总
+	idle     *idleSessions
+}
+
+func NewSessionMetrics() *SessionMetrics {
+	return &SessionMetrics{
+		IdleMs:   defaultSessionIdleMs,
+		tracker:  NewSessionTracker(),
+		sessions: make(map[string]*SessionRecord),
+		idle:     newIdleSessions(),
+	}
+}
+
+func (m *SessionMetrics) OnRequestCompleted(request *Request, result *PrefillResult) {
+	if expired, swept := m.idle.sweep(request.Timestamp, m.IdleMs); swept {
+		for _, key := range expired {
+			m.retired.add(m.sessions[key])
+			delete(m.sessions, key)
+		}
+		m.tracker.ExpireBefore(request.Timestamp - m.IdleMs)
+	}
+	key := m.tracker.Key(request)
+	m.idle.touch(key, request.Timestamp)
+	record, exists := m.sessions[key]
+	if !exists {
+		record = &SessionRecord{ID: key}
+		m.sessions[key] = record
+	}
+	record.Turns++
+
+	if record.lastHashIDs != nil {
+		carried := commonPrefixLength(record.lastHashIDs, request.HashIDs)
+		record.CarriedBlocks += carried
+		record.ReusedBlocks += min(result.CachedTokens/blockTokens, carried)
+		if result.SelectedNode == record.lastNode {
+			record.SameNode++
+		}
+	}
+	record.lastHashIDs = request.HashIDs
+	record.lastNode = result.SelectedNode
+}
+
+func commonPrefixLength(a, b []int) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// SessionSummary 全部会话的汇总
+type SessionSummary struct {
+	Sessions      int
+	MultiTurn     int // 轮次≥2的会话数
+	Turns         int
+	FollowUps     int // 后续轮次数
+	CarriedBlocks int
+	ReusedBlocks  int
+	SameNode      int
+}
+
+// ReuseRate 跨轮复用率
+func (s SessionSummary) ReuseRate() float64 {
+	if s.CarriedBlocks == 0 {
+		return 0
+	}
+	return float64(s.ReusedBlocks) / float64(s.CarriedBlocks)
+}
+
+// AffinityRate 后续轮次与上一轮同节点的比例
+func (s SessionSummary) AffinityRate() float64 {
+	if s.FollowUps == 0 {
+		return 0
+	}
+	return float64(s.SameNode) / float64(s.FollowUps)
+}
+
+// add 把一个会话计入汇总
+func (s *SessionSummary) add(record *SessionRecord) {
+	s.Sessions++
+	s.Turns += record.Turns
+	s.FollowUps += record.Turns - 1
+	if record.Turns >= 2 {
+		s.MultiTurn++
+	}
+	s.CarriedBlocks += record.CarriedBlocks
+	s.ReusedBlocks += record.ReusedBlocks
+	s.SameNode += record.SameNode
+}
+
+// Summary 已结束与活跃会话的汇总
+func (m *SessionMetrics) Summary() SessionSummary {
+	summary := m.retired
+	for _, record := range m.sessions {
+		summary.add(record)
+	}
+	return summary
+}
+
+// Sessions 返回活跃会话的记录，按轮次从多到少排列
+func (m *SessionMetrics) Sessions() []*SessionRecord {
+	records := make([]*SessionRecord, 0, len(m.sessions))
+	for _, record := range m.sessions {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Turns != records[j].Turns {
+			return records[i].Turns > records[j].Turns
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
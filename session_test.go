@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestSessionTrackerEmptyHashIDs(t *testing.T) {
+	tracker := NewSessionTracker()
+	first, _ := tracker.Assign(&Request{Timestamp: 0, HashIDs: []int{1, 2}})
+
+	empty, continued := tracker.Assign(&Request{Timestamp: 1})
+	if continued || empty == first {
+		t.Fatalf("request without blocks got session %d (continued %v), want a new session", empty, continued)
+	}
+
+	next, continued := tracker.Assign(&Request{Timestamp: 2, HashIDs: []int{1, 2, 3}})
+	if !continued || next != first {
+		t.Fatalf("follow-up turn got session %d (continued %v), want %d continued", next, continued, first)
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"container/list"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
-	"os"
+	"sort"
 )
 
 // Block 表示一个KV Cache块
@@ -17,6 +17,14 @@ type Block struct {
 	AccessSeq int // 访问序号（替代LastAccess时间戳）
 	CreateSeq int // 创建序号（替代CreateTime时间戳）
 	RefCount  int // 引用计数（用于热点检测）
+
+	ParentHash int    // 前缀链中的父block（-1表示链首）
+	ExpireAt   int    // 过期时间（模拟毫秒，0表示永不过期）
+	Tenant     string // 写入该block的租户（用于租户缓存配额）
+	Model      string // block所属的模型（用于模型内存分区）
+
+	tenantElem *list.Element // 在节点该租户访问序列中的位置
+	modelElem  *list.Element // 在节点该模型访问序列中的位置
 }
 
 // PrefixPattern 前缀模式定义
@@ -55,6 +63,11 @@ type Request struct {
 	InputLength  int   `json:"input_length"`  // 输入token数
 	OutputLength int   `json:"output_length"` // 输出token数
 	HashIDs      []int `json:"hash_ids"`      // 块的hash ID列表
+
+	TenantID  string `json:"tenant_id,omitempty"`  // 租户（可选，空表示默认租户）
+	Priority  int    `json:"priority,omitempty"`   // 优先级（可选，越大越优先，默认0）
+	ModelID   string `json:"model_id,omitempty"`   // 目标模型（可选，空表示默认模型）
+	SessionID string `json:"session_id,omitempty"` // 所属会话（可选，缺失时可按前缀链延续推断）
 }
 
 // PrefillNode 表示一个prefill节点
@@ -74,6 +87,28 @@ type PrefillNode struct {
 	// 序号计数器（替代时间戳）
 	seqCounter int // 全局序号计数器
 
+	// TTL与失效相关
+	BlockTTL   int         // 新写入block的存活时间（模拟毫秒，0表示不过期）
+	now        int         // 当前模拟时间（毫秒），由处理器在每个请求前推进
+	nextExpiry int         // 最早的过期时间，用于跳过无效扫描
+	lineage    map[int]int // hashID -> 父hashID，block被淘汰后仍保留以便识别前缀子树
+	pruneAt    int         // lineage条目数超过该值时裁剪与缓存内容无关的记录
+
+	// prefill作业队列
+	jobs nodeQueue
+
+	// 故障注入状态
+	Down        bool    // 已崩溃（缓存清空，不可调度）
+	Partitioned bool    // 与调度器网络隔离（保留缓存，不可调度）
+	SlowFactor  float64 // 计算减速倍数（0或1表示正常）
+
+	tenantBlocks map[string]*list.List // 租户 -> 归属的block（按访问先后排列，最久未访问在前）
+
+	// 多模型：Models为空表示服务所有模型
+	Models      []string
+	modelShares map[string]float64    // 模型 -> KV内存分区占比（未配置的模型不受限）
+	modelBlocks map[string]*list.List // 模型 -> 该模型的block（按访问先后排列，最久未访问在前）
+
 	// 热点检测和迁移相关
 	HotspotMetrics *HotspotMetrics // 热点检测指标
 }
@@ -86,6 +121,27 @@ type PrefillNodeSelector interface {
 	GetName() string
 }
 
+// ErrNoNodeSelected 选择器未返回节点（无可用节点或请求被拒绝）
+var ErrNoNodeSelected = errors.New("no node selected")
+
+// SelectionObserver 选择器可选实现：请求完成时接收实际结果（用于在线校准、反馈学习）
+type SelectionObserver interface {
+	// OnRequestCompleted 请求prefill完成时回调，result中的QueueTime与TTFT已确定
+	OnRequestCompleted(request *Request, result *PrefillResult)
+}
+
+// FailureObserver 选择器与观察者可选实现：已分配的请求未能完成（节点崩溃丢失）时回调，
+// 用于清理在途状态；包装其他选择器的选择器应转发给被包装者
+type FailureObserver interface {
+	// OnRequestFailed 请求在at时刻（毫秒）确定失败，之后不会再有OnRequestCompleted
+	OnRequestFailed(request *Request, at float64)
+}
+
+// BestEffortHinter 选择器可选实现：标记应降级为尽力而为的请求（排在节点上所有普通作业之后）
+type BestEffortHinter interface {
+	BestEffort(request *Request) bool
+}
+
 // EvictionAlgorithm 缓存淘汰算法接口
 type EvictionAlgorithm interface {
 	// Evict 选择要淘汰的block
@@ -94,6 +150,10 @@ type EvictionAlgorithm interface {
 	UpdateOnAccess(block *Block)
 	// OnAdd 添加新block时的回调（可选实现）
 	OnAdd(blockID int)
+	// OnRemove block经由Evict以外的路径离开缓存时的回调（失效、故障、去复制等）
+	OnRemove(blockID int)
+	// OnCapacityChange 节点缓存容量（块数）变化时的回调
+	OnCapacityChange(capacity int)
 	// GetName 获取算法名称
 	GetName() string
 }
@@ -104,6 +164,8 @@ type PrefillProcessor interface {
 	ProcessRequest(request *Request, nodes []*PrefillNode) (*PrefillResult, error)
 	// GetStatistics 获取统计信息
 	GetStatistics() *SimulationStats
+	// Drain 执行完所有在途作业（模拟结束时调用，使TTFT统计完整）
+	Drain()
 }
 
 // PrefillResult prefill处理结果
@@ -112,8 +174,16 @@ type PrefillResult struct {
 	CacheHits       int     // 命中的块数
 	CacheMisses     int     // 未命中的块数
 	ProcessedBlocks []int   // 处理的块ID列表
+	CachedTokens    int     // 处理前已缓存的连续前缀token数（免计算部分）
 	TransferTime    float64 // 传输时间（毫秒）
 	ProcessTime     float64 // 处理时间（毫秒）
+	QueueTime       float64 // 排队时间（毫秒，请求完成时确定）
+	TTFT            float64 // 首token时间 = 排队 + 传输 + 处理（毫秒，请求完成时确定）
+	Completed       bool    // 是否已完成
+
+	ChunkNodes []*PrefillNode // 分块prefill依次经过的节点（未分块时为空）
+
+	computeMs float64 // 不含慢节点放大的计算时间，请求完成时计入计算量统计
 }
 
 // SimulationStats 模拟统计信息
@@ -125,6 +195,32 @@ type SimulationStats struct {
 	AvgTransferTime float64
 	AvgProcessTime  float64
 	NodeStats       map[string]*NodeStatistics
+
+	// 延迟统计（仅统计已完成的请求）
+	FailedRequests    int // 所在节点崩溃而丢失的在途请求数
+	CompletedRequests int
+	AvgQueueTime      float64
+	AvgTTFT           float64
+	P50TTFT           float64
+	P99TTFT           float64
+	TTFTSamples       []float64 // 按完成顺序记录的TTFT（毫秒）
+
+	// 缓存准入统计
+	AdmittedBlocks     int // 通过准入写入缓存的块数
+	RejectedBlocks     int // 被准入策略拒绝的块数
+	RejectedReaccessed int // 被拒绝后在同一节点再次被访问的块数（准入造成的命中损失上界）
+
+	ChunkedRequests int // 分块流水线处理的请求数
+	CancelledChunks int // 同一请求的其他分块所在节点崩溃而取消的分块作业数
+
+	// 计算量统计（屋顶线模型，不含慢节点放大）
+	ComputeMs      float64 // 已完成请求的prefill计算时间之和
+	SavedComputeMs float64 // 缓存命中相对全量重算节省的计算时间
+
+	TransferredBlocks int // 经网络传输的KV块数（分块前送；未命中的块在本地重算，计入计算时间）
+
+	TenantStats map[string]*GroupStatistics // 租户 -> 统计（未标注租户的请求计入"default"）
+	ModelStats  map[string]*GroupStatistics // 模型 -> 统计（未标注模型的请求计入"default"）
 }
 
 // NodeStatistics 节点统计信息
@@ -137,6 +233,67 @@ type NodeStatistics struct {
 	AvgMemoryUsage float64
 	MaxMemoryUsage float64
 	EvictedBlocks  int
+	ExpiredBlocks  int // TTL到期被移除的块数
+}
+
+// GroupStatistics 按租户或模型分组的请求统计
+type GroupStatistics struct {
+	Name           string
+	Requests       int
+	Hits           int
+	Misses         int
+	QuotaEvictions int // 因租户配额或模型分区淘汰组内block的次数
+	Completed      int
+	HitRate        float64
+	AvgQueueTime   float64
+	AvgTTFT        float64
+	P99TTFT        float64
+	TTFTSamples    []float64
+
+	totalQueue float64
+}
+
+// groupStatsFor 获取分组统计，不存在时初始化
+func groupStatsFor(groups map[string]*GroupStatistics, name string) *GroupStatistics {
+	stats, exists := groups[name]
+	if !exists {
+		stats = &GroupStatistics{Name: name}
+		groups[name] = stats
+	}
+	return stats
+}
+
+// recordRequest 记录分组内一个请求的命中情况
+func (g *GroupStatistics) recordRequest(result *PrefillResult) {
+	g.Requests++
+	g.Hits += result.CacheHits
+	g.Misses += result.CacheMisses
+}
+
+// recordCompletion 记录分组内一个请求的完成
+func (g *GroupStatistics) recordCompletion(result *PrefillResult) {
+	g.Completed++
+	g.TTFTSamples = append(g.TTFTSamples, result.TTFT)
+	g.totalQueue += result.QueueTime
+}
+
+// finalize 计算命中率与延迟分位数
+func (g *GroupStatistics) finalize() {
+	if g.Hits+g.Misses > 0 {
+		g.HitRate = float64(g.Hits) / float64(g.Hits+g.Misses)
+	}
+	if g.Completed == 0 {
+		return
+	}
+	sorted := append([]float64{}, g.TTFTSamples...)
+	sort.Float64s(sorted)
+	total := 0.0
+	for _, ttft := range sorted {
+		total += ttft
+	}
+	g.AvgQueueTime = g.totalQueue / float64(g.Completed)
+	g.AvgTTFT = total / float64(g.Completed)
+	g.P99TTFT = percentileFloat(sorted, 0.99)
 }
 
 type RandomNodeSelector struct{}
@@ -485,25 +642,17 @@ func (p *PrefixAwareHotspotSelector) executeHotspotMigrationWithPrediction(prefi
 	migratedCount := 0
 	for _, targetNode := range targetNodes {
 		// 执行前缀相关blocks的迁移到每个目标节点
-		for _, hashID := range pattern.Prefix {
-			if block, exists := sourceNode.CacheBlocks[hashID]; exists {
+		for i, hashID := range pattern.Prefix {
+			if _, exists := sourceNode.CacheBlocks[hashID]; exists {
+				// 目标节点已有该block时跳过，避免重复登记到淘汰结构
+				if _, copied := targetNode.CacheBlocks[hashID]; copied {
+					continue
+				}
 				// 检查目标节点是否有足够空间
 				if len(targetNode.CacheBlocks) < targetNode.MaxCacheSize {
-					// 复制block（而不是移动）
-					targetNode.CacheBlocks[hashID] = &Block{
-						HashID:    block.HashID,
-						Size:      block.Size,
-						HitCount:  1, // 重置命中次数
-						AccessSeq: targetNode.seqCounter + 1,
-						CreateSeq: targetNode.seqCounter + 1,
-					}
-					targetNode.seqCounter++
+					// 复制block（而不是移动），由addBlock统一维护内存与淘汰算法
+					targetNode.addBlock(hashID, parentHashAt(pattern.Prefix, i))
 					migratedCount++
-
-					// 通知目标节点的淘汰算法
-					if targetNode.EvictionAlgo != nil {
-						targetNode.EvictionAlgo.OnAdd(hashID)
-					}
 				}
 			}
 		}
@@ -815,17 +964,38 @@ func (f *FIFOEviction) Evict(blocks map[int]*Block) int {
 	return -1
 }
 
+// PeekVictim 返回下一个将被淘汰的block（不修改状态）
+func (f *FIFOEviction) PeekVictim() int {
+	if front := f.insertOrder.Front(); front != nil {
+		return front.Value.(int)
+	}
+	return -1
+}
+
 func (f *FIFOEviction) UpdateOnAccess(block *Block) {
 	// FIFO不关心访问时间，只关心插入顺序
 	block.HitCount++
 }
 
 func (f *FIFOEviction) OnAdd(blockID int) {
+	// 重复添加时先移除旧位置，保证队列中每个block只出现一次
+	f.OnRemove(blockID)
 	// 添加到队列尾部
 	element := f.insertOrder.PushBack(blockID)
 	f.orderNodes[blockID] = element
 }
 
+func (f *FIFOEviction) OnRemove(blockID int) {
+	if element, exists := f.orderNodes[blockID]; exists {
+		f.insertOrder.Remove(element)
+		delete(f.orderNodes, blockID)
+	}
+}
+
+func (f *FIFOEviction) OnCapacityChange(capacity int) {
+	// 插入顺序与容量无关，超出容量的部分由节点通过Evict回收
+}
+
 func (f *FIFOEviction) GetName() string {
 	return "FIFO"
 }
@@ -861,6 +1031,14 @@ func (l *LRUEviction) Evict(blocks map[int]*Block) int {
 	return -1
 }
 
+// PeekVictim 返回下一个将被淘汰的block（不修改状态）
+func (l *LRUEviction) PeekVictim() int {
+	if back := l.accessOrder.Back(); back != nil {
+		return back.Value.(int)
+	}
+	return -1
+}
+
 func (l *LRUEviction) UpdateOnAccess(block *Block) {
 	block.HitCount++
 	blockID := block.HashID
@@ -872,11 +1050,24 @@ func (l *LRUEviction) UpdateOnAccess(block *Block) {
 }
 
 func (l *LRUEviction) OnAdd(blockID int) {
+	// 重复添加时先移除旧位置，保证链表中每个block只出现一次
+	l.OnRemove(blockID)
 	// 添加到链表头部（最近使用）
 	element := l.accessOrder.PushFront(blockID)
 	l.orderNodes[blockID] = element
 }
 
+func (l *LRUEviction) OnRemove(blockID int) {
+	if element, exists := l.orderNodes[blockID]; exists {
+		l.accessOrder.Remove(element)
+		delete(l.orderNodes, blockID)
+	}
+}
+
+func (l *LRUEviction) OnCapacityChange(capacity int) {
+	// 访问顺序与容量无关，超出容量的部分由节点通过Evict回收
+}
+
 func (l *LRUEviction) GetName() string {
 	return "LRU"
 }
@@ -925,6 +1116,20 @@ func (l *LFUEviction) Evict(blocks map[int]*Block) int {
 	return -1
 }
 
+// PeekVictim 返回下一个将被淘汰的block（仅刷新最小频率缓存，不移除任何block）
+func (l *LFUEviction) PeekVictim() int {
+	if len(l.blockFreq) == 0 {
+		return -1
+	}
+	if l.freqGroups[l.minFreq] == nil || l.freqGroups[l.minFreq].Len() == 0 {
+		l.updateMinFreq()
+	}
+	if minFreqList := l.freqGroups[l.minFreq]; minFreqList != nil && minFreqList.Len() > 0 {
+		return minFreqList.Front().Value.(int)
+	}
+	return -1
+}
+
 func (l *LFUEviction) UpdateOnAccess(block *Block) {
 	blockID := block.HashID
 	block.HitCount++
@@ -954,12 +1159,24 @@ func (l *LFUEviction) UpdateOnAccess(block *Block) {
 }
 
 func (l *LFUEviction) OnAdd(blockID int) {
+	// 重复添加时先移除旧频率组中的条目
+	l.OnRemove(blockID)
 	// 新block初始频率为1
 	l.addToFreqGroup(blockID, 1)
 	l.blockFreq[blockID] = 1
 	l.minFreq = 1
 }
 
+func (l *LFUEviction) OnRemove(blockID int) {
+	if _, exists := l.blockFreq[blockID]; exists {
+		l.removeBlock(blockID)
+	}
+}
+
+func (l *LFUEviction) OnCapacityChange(capacity int) {
+	// 频率统计与容量无关，超出容量的部分由节点通过Evict回收
+}
+
 // 辅助方法
 func (l *LFUEviction) removeBlock(blockID int) {
 	freq := l.blockFreq[blockID]
@@ -1003,112 +1220,329 @@ type BasicPrefillProcessor struct {
 	selector     PrefillNodeSelector
 	stats        *SimulationStats
 	nodeStatsMap map[string]*NodeStatistics
+
+	admission      CacheAdmissionPolicy         // 缓存准入策略
+	rejectedBlocks map[string]*rejectionHistory // nodeID -> 近期被拒绝准入的block
+	quotas         *TenantQuotas                // 租户缓存配额
+	chunking       *ChunkedPrefillConfig        // 分块prefill（nil表示不分块）
+	compute        *ComputeModel                // prefill计算模型
+
+	// 作业执行与完成通知
+	busyNodes     map[*PrefillNode]bool // 有在途作业的节点
+	observers     []SelectionObserver
+	totalQueue    float64
+	totalTransfer float64
+	totalProcess  float64
+	lastFinish    float64 // 最近完成的作业的完成时间（排空后即模拟的结束时间）
 }
 
 func NewBasicPrefillProcessor(selector PrefillNodeSelector) *BasicPrefillProcessor {
-	return &BasicPrefillProcessor{
+	p := &BasicPrefillProcessor{
 		selector: selector,
 		stats: &SimulationStats{
-			NodeStats: make(map[string]*NodeStatistics),
+			NodeStats:   make(map[string]*NodeStatistics),
+			TenantStats: make(map[string]*GroupStatistics),
+			ModelStats:  make(map[string]*GroupStatistics),
 		},
-		nodeStatsMap: make(map[string]*NodeStatistics),
+		nodeStatsMap:   make(map[string]*NodeStatistics),
+		admission:      &AlwaysAdmitPolicy{},
+		rejectedBlocks: make(map[string]*rejectionHistory),
+		busyNodes:      make(map[*PrefillNode]bool),
+		compute:        DefaultComputeModel(),
 	}
+	if observer, ok := selector.(SelectionObserver); ok {
+		p.AddObserver(observer)
+	}
+	return p
+}
+
+// AddObserver 注册请求完成回调（实现了SelectionObserver的选择器会被自动注册）
+func (p *BasicPrefillProcessor) AddObserver(observer SelectionObserver) {
+	p.observers = append(p.observers, observer)
+}
+
+// SetCacheAdmissionPolicy 设置未命中block写入缓存前的准入策略
+func (p *BasicPrefillProcessor) SetCacheAdmissionPolicy(policy CacheAdmissionPolicy) {
+	p.admission = policy
 }
 
 func (p *BasicPrefillProcessor) ProcessRequest(request *Request, nodes []*PrefillNode) (*PrefillResult, error) {
-	// 1. 选择节点
-	selectedNode := p.selector.SelectNode(request, nodes)
-	if selectedNode == nil {
-		return nil, fmt.Errorf("no available node")
+	// 0. 推进模拟时间，清理所有节点上已过期的block（选择器看到的缓存状态必须是有效的）
+	for _, node := range nodes {
+		if expired := node.ExpireBlocks(request.Timestamp); expired > 0 {
+			p.nodeStatsFor(node).ExpiredBlocks += expired
+		}
 	}
 
-	// 添加请求到队列 (修复: RequestQueue之前从未更新)
-	selectedNode.RequestQueue = append(selectedNode.RequestQueue, request)
+	// 完成到达时刻之前的所有作业，选择器看到的队列与校准数据都是当前的
+	p.advanceTo(float64(request.Timestamp))
 
-	// 保持队列长度合理，模拟请求完成后的清理
-	// 只保留最近的100个请求用于负载计算
-	if len(selectedNode.RequestQueue) > 100 {
-		selectedNode.RequestQueue = selectedNode.RequestQueue[len(selectedNode.RequestQueue)-100:]
+	// 1. 选择节点（选择器只能看到可调度且托管该模型的节点）
+	candidates := compatibleNodes(availableNodes(nodes), request.ModelID)
+	if len(candidates) == 0 {
+		return nil, ErrNoCompatibleNode
+	}
+	selectedNode := p.selector.SelectNode(request, candidates)
+	if selectedNode == nil {
+		return nil, ErrNoNodeSelected
 	}
 
-	// 初始化节点统计
-	if _, exists := p.nodeStatsMap[selectedNode.ID]; !exists {
-		p.nodeStatsMap[selectedNode.ID] = &NodeStatistics{
-			NodeID: selectedNode.ID,
-		}
+	// 超长请求分块，流水线式分布到多个节点
+	if chunks := p.chunkCount(request, len(candidates)); chunks > 1 {
+		return p.processChunked(request, selectedNode, candidates, chunks), nil
 	}
-	nodeStats := p.nodeStatsMap[selectedNode.ID]
 
 	result := &PrefillResult{
 		SelectedNode:    selectedNode,
 		ProcessedBlocks: request.HashIDs,
 	}
 
+	// 计算量只取决于处理前已缓存的连续前缀
+	cachedTokens := min(contiguousPrefixHits(request, selectedNode)*blockTokens, request.InputLength)
+	result.CachedTokens = cachedTokens
+
 	// 2. 处理每个block
-	blockSize := 512.0                                 // 每个block的token数
-	blockMemoryMB := blockSize * 2 * 4 / (1024 * 1024) // 假设每个token占用2*4字节（KV各4字节）
+	result.CacheHits, result.CacheMisses = p.processBlocks(selectedNode, request, 0, len(request.HashIDs))
+	p.recordRequest(request, result)
 
-	for _, hashID := range request.HashIDs {
-		if block, exists := selectedNode.CacheBlocks[hashID]; exists {
+	// 计算处理时间：只有未缓存的token需要计算，但仍要对已缓存的前缀做注意力
+	result.ProcessTime = p.compute.PrefillMs(request.InputLength-cachedTokens, cachedTokens)
+	result.computeMs = result.ProcessTime
+	if selectedNode.SlowFactor > 1 {
+		result.ProcessTime *= selectedNode.SlowFactor
+	}
+	result.TransferTime = float64(result.CacheMisses) * blockMemoryMB / selectedNode.NetworkBandwidth
+
+	// 3. 作业入队，排队时间与TTFT在完成时确定
+	job := &prefillJob{
+		Request:    request,
+		Node:       selectedNode,
+		Result:     result,
+		ArrivalMs:  float64(request.Timestamp),
+		ServiceMs:  result.TransferTime + result.ProcessTime,
+		TransferMs: result.TransferTime,
+		Tokens:     max(request.InputLength-cachedTokens, 1),
+		Prefix:     cachedTokens,
+		Priority:   request.Priority,
+	}
+	p.submit(job)
+	p.advanceTo(job.ArrivalMs)
+
+	return result, nil
+}
+
+// processBlocks 在node上处理请求[from, to)位置的block：命中的更新淘汰结构，
+// 未命中的经准入、配额与容量检查后写入缓存，返回命中与未命中的块数
+func (p *BasicPrefillProcessor) processBlocks(node *PrefillNode, request *Request, from, to int) (hits, misses int) {
+	// 添加请求到队列 (修复: RequestQueue之前从未更新)
+	node.RequestQueue = append(node.RequestQueue, request)
+
+	// 保持队列长度合理，模拟请求完成后的清理
+	// 只保留最近的100个请求用于负载计算
+	if len(node.RequestQueue) > 100 {
+		node.RequestQueue = node.RequestQueue[len(node.RequestQueue)-100:]
+	}
+
+	nodeStats := p.nodeStatsFor(node)
+
+	rejected := p.rejectedBlocks[node.ID]
+	if rejected == nil {
+		rejected = newRejectionHistory()
+		p.rejectedBlocks[node.ID] = rejected
+	}
+
+	for position := from; position < to; position++ {
+		hashID := request.HashIDs[position]
+		p.admission.RecordAccess(node, hashID)
+
+		if block, exists := node.CacheBlocks[hashID]; exists {
 			// Cache命中
-			result.CacheHits++
-			selectedNode.TotalHits++
-			selectedNode.EvictionAlgo.UpdateOnAccess(block)
+			hits++
+			node.TotalHits++
+			node.touchBlock(block)
 		} else {
 			// Cache未命中，需要添加
-			result.CacheMisses++
-			selectedNode.TotalMisses++
+			misses++
+			node.TotalMisses++
+
+			if rejected.contains(hashID) {
+				p.stats.RejectedReaccessed++
+			}
+
+			// 准入检查：被拒绝的block不写入缓存，避免冲刷热点前缀
+			if !p.admission.Admit(node, request, position) {
+				rejected.add(hashID)
+				p.stats.RejectedBlocks++
+				continue
+			}
+			rejected.remove(hashID)
+			p.stats.AdmittedBlocks++
+			p.enforceTenantQuota(node, request)
+			p.enforceModelPartition(node, request)
 
 			// 检查内存容量
 			requiredMemory := blockMemoryMB
-			availableMemory := float64(selectedNode.MaxMemoryMB) - selectedNode.UsedMemoryMB
+			availableMemory := float64(node.MaxMemoryMB) - node.UsedMemoryMB
 
 			// 如果内存不足，执行淘汰
-			for availableMemory < requiredMemory && len(selectedNode.CacheBlocks) > 0 {
-				evictID := selectedNode.EvictionAlgo.Evict(selectedNode.CacheBlocks)
-				if evictID == -1 {
+			for availableMemory < requiredMemory && len(node.CacheBlocks) > 0 {
+				if node.evictOne() == -1 {
 					break
 				}
-				delete(selectedNode.CacheBlocks, evictID)
-				selectedNode.UsedMemoryMB -= blockMemoryMB
 				nodeStats.EvictedBlocks++
-				availableMemory = float64(selectedNode.MaxMemoryMB) - selectedNode.UsedMemoryMB
+				availableMemory = float64(node.MaxMemoryMB) - node.UsedMemoryMB
 			}
 
-			// 添加新block
-			selectedNode.seqCounter++ // 递增序号计数器
-			selectedNode.CacheBlocks[hashID] = &Block{
-				HashID:    hashID,
-				Size:      512,
-				HitCount:  1,
-				AccessSeq: selectedNode.seqCounter,
-				CreateSeq: selectedNode.seqCounter,
-			}
-			selectedNode.UsedMemoryMB += blockMemoryMB
-			selectedNode.EvictionAlgo.OnAdd(hashID) // 通知淘汰算法
+			// 添加新block（addBlock内部通知淘汰算法）
+			node.addRequestBlock(hashID, parentHashAt(request.HashIDs, position), request)
 		}
 	}
 
-	// 更新统计
+	nodeStats.TotalRequests++
+	nodeStats.TotalHits += hits
+	nodeStats.TotalMisses += misses
+	return hits, misses
+}
+
+// recordRequest 更新全局与租户/模型的请求统计
+func (p *BasicPrefillProcessor) recordRequest(request *Request, result *PrefillResult) {
 	p.stats.TotalRequests++
 	p.stats.TotalHits += result.CacheHits
 	p.stats.TotalMisses += result.CacheMisses
 
-	nodeStats.TotalRequests++
-	nodeStats.TotalHits += result.CacheHits
-	nodeStats.TotalMisses += result.CacheMisses
+	groupStatsFor(p.stats.TenantStats, tenantOf(request)).recordRequest(result)
+	groupStatsFor(p.stats.ModelStats, modelOf(request)).recordRequest(result)
+}
 
-	// 计算处理时间
-	result.ProcessTime = float64(request.InputLength) * 0.01 // 简化计算
-	result.TransferTime = float64(result.CacheMisses) * blockMemoryMB / selectedNode.NetworkBandwidth
+// submit 作业入队（选择器可把请求标记为尽力而为）
+func (p *BasicPrefillProcessor) submit(job *prefillJob) {
+	if hinter, ok := p.selector.(BestEffortHinter); ok {
+		job.BestEffort = hinter.BestEffort(job.Request)
+	}
+	job.Node.jobs.enqueue(job)
+	p.busyNodes[job.Node] = true
+}
 
-	return result, nil
+// advanceTo 推进所有在途节点到now，按完成时间顺序记录结果并通知观察者
+func (p *BasicPrefillProcessor) advanceTo(now float64) {
+	var completed []*prefillJob
+	for node := range p.busyNodes {
+		completed = append(completed, node.jobs.advanceTo(now)...)
+		if node.QueueLength() == 0 {
+			delete(p.busyNodes, node)
+		}
+	}
+	sort.SliceStable(completed, func(i, j int) bool {
+		if completed[i].FinishMs != completed[j].FinishMs {
+			return completed[i].FinishMs < completed[j].FinishMs
+		}
+		if completed[i].ArrivalMs != completed[j].ArrivalMs {
+			return completed[i].ArrivalMs < completed[j].ArrivalMs
+		}
+		return completed[i].Node.ID < completed[j].Node.ID
+	})
+
+	for _, job := range completed {
+		arrival, start, finish := job.ArrivalMs, job.StartMs, job.FinishMs
+		if job.Pipeline != nil {
+			if !job.Pipeline.complete() {
+				continue // 其余分块尚未完成，或流水线已因节点崩溃失败
+			}
+			arrival, start, finish = job.Pipeline.span()
+		}
+
+		result := job.Result
+		result.QueueTime = start - arrival
+		result.TTFT = finish - arrival
+		result.Completed = true
+
+		p.stats.CompletedRequests++
+		p.stats.TTFTSamples = append(p.stats.TTFTSamples, result.TTFT)
+		p.totalQueue += result.QueueTime
+		p.totalTransfer += result.TransferTime
+		p.totalProcess += result.ProcessTime
+		p.recordCompute(job.Request, result.computeMs)
+		p.lastFinish = math.Max(p.lastFinish, finish)
+
+		groupStatsFor(p.stats.TenantStats, tenantOf(job.Request)).recordCompletion(result)
+		groupStatsFor(p.stats.ModelStats, modelOf(job.Request)).recordCompletion(result)
+
+		for _, observer := range p.observers {
+			observer.OnRequestCompleted(job.Request, result)
+		}
+	}
+}
+
+// Drain 执行完所有在途作业
+func (p *BasicPrefillProcessor) Drain() {
+	p.advanceTo(math.Inf(1))
+}
+
+// failNode 节点在at时刻崩溃：此前能完成的作业正常完成，其余在途作业丢失，返回丢失数
+func (p *BasicPrefillProcessor) failNode(node *PrefillNode, at float64) int {
+	p.advanceTo(at)
+	lost := 0
+	for _, job := range node.jobs.drop() {
+		// 分块请求的任一分块丢失即整个请求失败，只计一次；其他节点上尚未完成的分块随之取消
+		if job.Pipeline != nil {
+			if job.Pipeline.failed {
+				continue
+			}
+			job.Pipeline.failed = true
+			for _, sibling := range job.Pipeline.jobs {
+				if sibling.Node != node && sibling.Node.jobs.cancel(sibling, at) {
+					p.stats.CancelledChunks++
+				}
+			}
+		}
+		lost++
+		p.notifyFailed(job.Request, at)
+	}
+	delete(p.busyNodes, node)
+	p.stats.FailedRequests += lost
+	return lost
+}
+
+// notifyFailed 通知实现了FailureObserver的观察者请求已失败
+func (p *BasicPrefillProcessor) notifyFailed(request *Request, at float64) {
+	for _, observer := range p.observers {
+		if failure, ok := observer.(FailureObserver); ok {
+			failure.OnRequestFailed(request, at)
+		}
+	}
+}
+
+// nodeStatsFor 获取节点统计，不存在时初始化
+func (p *BasicPrefillProcessor) nodeStatsFor(node *PrefillNode) *NodeStatistics {
+	nodeStats, exists := p.nodeStatsMap[node.ID]
+	if !exists {
+		nodeStats = &NodeStatistics{
+			NodeID: node.ID,
+		}
+		p.nodeStatsMap[node.ID] = nodeStats
+	}
+	return nodeStats
 }
 
 func (p *BasicPrefillProcessor) GetStatistics() *SimulationStats {
 	if p.stats.TotalRequests > 0 {
 		p.stats.HitRate = float64(p.stats.TotalHits) / float64(p.stats.TotalHits+p.stats.TotalMisses)
 	}
+	if completed := p.stats.CompletedRequests; completed > 0 {
+		p.stats.AvgQueueTime = p.totalQueue / float64(completed)
+		p.stats.AvgTransferTime = p.totalTransfer / float64(completed)
+		p.stats.AvgProcessTime = p.totalProcess / float64(completed)
+
+		sorted := append([]float64{}, p.stats.TTFTSamples...)
+		sort.Float64s(sorted)
+		total := 0.0
+		for _, ttft := range sorted {
+			total += ttft
+		}
+		p.stats.AvgTTFT = total / float64(completed)
+		p.stats.P50TTFT = percentileFloat(sorted, 0.50)
+		p.stats.P99TTFT = percentileFloat(sorted, 0.99)
+	}
 
 	// 计算每个节点的统计
 	for nodeID, nodeStats := range p.nodeStatsMap {
@@ -1117,77 +1551,148 @@ func (p *BasicPrefillProcessor) GetStatistics() *SimulationStats {
 		}
 		p.stats.NodeStats[nodeID] = nodeStats
 	}
+	for _, groups := range []map[string]*GroupStatistics{p.stats.TenantStats, p.stats.ModelStats} {
+		for _, stats := range groups {
+			stats.finalize()
+		}
+	}
 
 	return p.stats
 }
 
-// ============= 数据加载函数 =============
+// ============= 模拟器主类 =============
 
-func LoadRequests(filename string) ([]*Request, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+type Simulator struct {
+	nodes        []*PrefillNode
+	processor    PrefillProcessor
+	requests     []*Request
+	selectorName string
+
+	faults      []FaultEvent // 尚未生效的故障事件
+	faultLog    []FaultRecord
+	hitTimeline []HitRateBucket
+
+	// 弹性伸缩
+	cacheSize     int
+	evictionAlgo  EvictionFactory
+	nextNodeIndex int
+	scaling       []ScalingEvent // 尚未生效的伸缩计划
+	autoscaler    Autoscaler
+	warmup        bool // 新节点是否预热热点前缀
+	lastAutoscale int
+	scalingLog    []ScalingRecord
+	nodeMs        float64 // 累计节点时间（节点数 × 毫秒）
+	blockMs       float64 // 累计缓存占用（缓存block数 × 毫秒）
+	lastTick      int
+	ticking       bool
+
+	admission *AdmissionController // 请求准入控制（nil表示全部接受）
+	batching  *BatchConfig         // 节点批处理调度（nil表示单服务台）
+}
+
+func NewSimulator(nodeCount int, cacheSize int, selector PrefillNodeSelector, evictionAlgo EvictionFactory) *Simulator {
+	nodes := make([]*PrefillNode, nodeCount)
+	for i := 0; i < nodeCount; i++ {
+		nodes[i] = newPrefillNode(fmt.Sprintf("node-%d", i), cacheSize, evictionAlgo)
 	}
-	defer file.Close()
 
-	var requests []*Request
-	scanner := bufio.NewScanner(file)
+	return &Simulator{
+		nodes:         nodes,
+		processor:     NewBasicPrefillProcessor(selector),
+		selectorName:  selector.GetName(),
+		cacheSize:     cacheSize,
+		evictionAlgo:  evictionAlgo,
+		nextNodeIndex: nodeCount,
+	}
+}
 
-	for scanner.Scan() {
-		var rawData map[string]interface{}
-		if err := json.Unmarshal(scanner.Bytes(), &rawData); err != nil {
-			continue
-		}
+func newPrefillNode(id string, cacheSize int, evictionAlgo EvictionFactory) *PrefillNode {
+	return &PrefillNode{
+		ID:               id,
+		CacheBlocks:      make(map[int]*Block),
+		MaxCacheSize:     cacheSize,
+		MaxMemoryMB:      2, // 减小到2MB以确保淘汰
+		NetworkBandwidth: defaultNetworkBandwidth,
+		EvictionAlgo:     evictionAlgo(),
+		seqCounter:       0,   // 初始化序号计数器
+		HotspotMetrics:   nil, // 由PrefixAwareHotspotSelector按需初始化
+	}
+}
 
-		// 解析数据
-		request := &Request{
-			Timestamp:    int(rawData["timestamp"].(float64)),
-			InputLength:  int(rawData["input_length"].(float64)),
-			OutputLength: int(rawData["output_length"].(float64)),
-		}
+// SetCacheAdmissionPolicy 为模拟器的处理器设置缓存准入策略
+func (s *Simulator) SetCacheAdmissionPolicy(policy CacheAdmissionPolicy) {
+	if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+		processor.SetCacheAdmissionPolicy(policy)
+	}
+}
 
-		// 解析hash_ids
-		hashIDsRaw := rawData["hash_ids"].([]interface{})
-		request.HashIDs = make([]int, len(hashIDsRaw))
-		for i, id := range hashIDsRaw {
-			request.HashIDs[i] = int(id.(float64))
-		}
+// SetCacheMemory 调整所有节点的缓存内存上限（MB），返回因缩容淘汰的总块数
+func (s *Simulator) SetCacheMemory(maxMemoryMB int) int {
+	evicted := 0
+	for _, node := range s.nodes {
+		evicted += node.ResizeCache(maxMemoryMB)
+	}
+	return evicted
+}
 
-		requests = append(requests, request)
+// SetBlockTTL 设置所有节点新写入block的存活时间（模拟毫秒，0表示不过期）
+func (s *Simulator) SetBlockTTL(ttl int) {
+	for _, node := range s.nodes {
+		node.BlockTTL = ttl
 	}
+}
 
-	return requests, scanner.Err()
+// InvalidatePrefix 在所有节点上失效以prefix为前缀的子树，返回移除的总块数
+func (s *Simulator) InvalidatePrefix(prefix []int) int {
+	removed := 0
+	for _, node := range s.nodes {
+		removed += node.InvalidatePrefix(prefix)
+	}
+	return removed
 }
 
-// ============= 模拟器主类 =============
+// ProcessRequest 把请求映射到其模型的hash命名空间，依次应用到期的故障与伸缩事件，经准入控制判定后处理请求
+func (s *Simulator) ProcessRequest(request *Request) (*PrefillResult, error) {
+	request = namespaceRequest(request)
+	s.tick(request.Timestamp)
+	for len(s.faults) > 0 && s.faults[0].AtMs <= request.Timestamp {
+		s.applyFault(s.faults[0])
+		s.faults = s.faults[1:]
+	}
+	s.applyScaling(request.Timestamp)
 
-type Simulator struct {
-	nodes        []*PrefillNode
-	processor    PrefillProcessor
-	requests     []*Request
-	selectorName string
+	if s.admission != nil {
+		s.processRetries(request.Timestamp)
+		if processor, ok := s.processor.(*BasicPrefillProcessor); ok {
+			// 被拒绝的请求不会经过处理器，先把节点队列推进到当前时间，准入策略才能看到真实积压
+			processor.advanceTo(float64(request.Timestamp))
+		}
+		switch s.admission.admit(request, availableNodes(s.nodes)) {
+		case RejectRequest:
+			return nil, ErrRequestRejected
+		case DeferRequest:
+			return nil, ErrRequestDeferred
+		}
+		return s.processAccepted(request)
+	}
+	return s.processAdmitted(request)
 }
 
-func NewSimulator(nodeCount int, cacheSize int, selector PrefillNodeSelector, evictionAlgo func() EvictionAlgorithm) *Simulator {
-	nodes := make([]*PrefillNode, nodeCount)
-	for i := 0; i < nodeCount; i++ {
-		nodes[i] = &PrefillNode{
-			ID:               fmt.Sprintf("node-%d", i),
-			CacheBlocks:      make(map[int]*Block),
-			MaxCacheSize:     cacheSize,
-			MaxMemoryMB:      2,    // 减小到2MB以确保淘汰
-			NetworkBandwidth: 10.0, // 10GB/s
-			EvictionAlgo:     evictionAlgo(),
-			seqCounter:       0,   // 初始化序号计数器
-			HotspotMetrics:   nil, // 由PrefixAwareHotspotSelector按需初始化
-		}
+// processAdmitted 由处理器处理请求并记录命中率时间线
+func (s *Simulator) processAdmitted(request *Request) (*PrefillResult, error) {
+	result, err := s.processor.ProcessRequest(request, s.nodes)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Simulator{
-		nodes:        nodes,
-		processor:    NewBasicPrefillProcessor(selector),
-		selectorName: selector.GetName(),
+	start := request.Timestamp - request.Timestamp%hitRateBucketMs
+	if n := len(s.hitTimeline); n == 0 || s.hitTimeline[n-1].StartMs != start {
+		s.hitTimeline = append(s.hitTimeline, HitRateBucket{StartMs: start})
 	}
+	bucket := &s.hitTimeline[len(s.hitTimeline)-1]
+	bucket.Hits += result.CacheHits
+	bucket.Misses += result.CacheMisses
+	return result, nil
 }
 
 func (s *Simulator) LoadData(filename string) error {
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ============= TTFT代价模型（在线校准） =============
+//
+// TTFT ≈ w0·积压工作量 + w1·未缓存token数 + w2·需传输block数 + w3。
+// 选择请求时记录所选节点的特征，请求完成后用实际TTFT做带遗忘因子的最小二乘更新，
+// 并以岭回归的形式向先验系数收缩，样本不足时预测退化为先验模型。
+
+const ttftFeatureCount = 4
+
+type ttftFeatures [ttftFeatureCount]float64
+
+// TTFTCostModel 在线校准的TTFT线性代价模型
+type TTFTCostModel struct {
+	Forgetting float64 // 遗忘因子λ（0, 1]，越小越偏向近期样本
+	Ridge      float64 // 向先验系数收缩的强度
+
+	prior   ttftFeatures
+	weights ttftFeatures
+	xtx     [ttftFeatureCount][ttftFeatureCount]float64
+	xty     ttftFeatures
+	pending map[*Request]ttftFeatures // 已选择、尚未完成的请求特征
+
+	Samples  int     // 已用于校准的样本数
+	totalAbs float64 // 预测绝对误差之和（按更新前的系数计算）
+}
+
+// NewTTFTCostModel 以处理器的时间模型为先验创建代价模型，networkBandwidth（GB/s）决定每个缺失block的传输时间先验
+func NewTTFTCostModel(networkBandwidth float64) *TTFTCostModel {
+	prior := ttftFeatures{1, DefaultComputeModel().MsPerToken(8 * blockTokens), blockMemoryMB / networkBandwidth, 0}
+	return &TTFTCostModel{
+		Forgetting: 0.995,
+		Ridge:      1.0,
+		prior:      prior,
+		weights:    prior,
+		pending:    make(map[*Request]ttftFeatures),
+	}
+}
+
+// features 请求在节点上的代价特征
+func (m *TTFTCostModel) features(request *Request, node *PrefillNode, now float64) ttftFeatures {
+	hits := contiguousPrefixHits(request, node)
+	uncachedTokens := max(request.InputLength-hits*blockTokens, 0)
+	missingBlocks := 0
+	for _, hashID := range request.HashIDs {
+		if _, exists := node.CacheBlocks[hashID]; !exists {
+			missingBlocks++
+		}
+	}
+	return ttftFeatures{node.QueuedWork(now), float64(uncachedTokens), float64(missingBlocks), 1}
+}
+
+func (m *TTFTCostModel) predict(x ttftFeatures) float64 {
+	ttft := 0.0
+	for i := range x {
+		ttft += m.weights[i] * x[i]
+	}
+	return ttft
+}
+
+// Predict 预测请求在节点上的TTFT（毫秒）
+func (m *TTFTCostModel) Predict(request *Request, node *PrefillNode, now float64) float64 {
+	return m.predict(m.features(request, node, now))
+}
+
+// Observe 记录请求被分配到节点时的特征，完成后用于校准
+func (m *TTFTCostModel) Observe(request *Request, node *PrefillNode, now float64) {
+	m.pending[request] = m.features(request, node, now)
+}
+
+// OnRequestCompleted 用实际TTFT更新系数
+func (m *TTFTCostModel) OnRequestCompleted(request *Request, result *PrefillResult) {
+	x, exists := m.pending[request]
+	if !exists {
+		return
+	}
+	delete(m.pending, request)
+
+	m.Samples++
+	m.totalAbs += math.Abs(m.predict(x) - result.TTFT)
+
+	for i := range x {
+		for j := range x {
+			m.xtx[i][j] = m.Forgetting*m.xtx[i][j] + x[i]*x[j]
+		}
+		m.xty[i] = m.Forgetting*m.xty[i] + x[i]*result.TTFT
+	}
+
+	// (XᵀX + ρI)w = Xᵀy + ρ·prior
+	var a [ttftFeatureCount][ttftFeatureCount + 1]float64
+	for i := range a {
+		copy(a[i][:ttftFeatureCount], m.xtx[i][:])
+		a[i][i] += m.Ridge
+		a[i][ttftFeatureCount] = m.xty[i] + m.Ridge*m.prior[i]
+	}
+	if weights, ok := solveAugmented(a); ok {
+		m.weights = weights
+	}
+}
+
+// OnRequestFailed 丢弃失败请求的特征，不参与校准
+func (m *TTFTCostModel) OnRequestFailed(request *Request, at float64) {
+	delete(m.pending, request)
+}
+
+// MeanAbsError 校准过程中的平均绝对预测误差（毫秒）
+func (m *TTFTCostModel) MeanAbsError() float64 {
+	if m.Samples == 0 {
+		return 0
+	}
+	return m.totalAbs / float64(m.Samples)
+}
+
+// solveAugmented 部分主元高斯消元求解增广矩阵，奇异时返回false
+func solveAugmented(a [ttftFeatureCount][ttftFeatureCount + 1]float64) (ttftFeatures, bool) {
+	const n = ttftFeatureCount
+	var x ttftFeatures
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return x, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, true
+}
+
+// ============= 接口实现：SLO感知的TTFT预测选择器 =============
+
+// SLOMode 最优预测TTFT仍超过SLO时的处理方式
+type SLOMode int
+
+const (
+	SLOReject       SLOMode = iota // 拒绝请求（选择器返回nil）
+	SLODeprioritize                // 仍分配到预测最优节点，但作为尽力而为作业排在普通作业之后
+)
+
+func (m SLOMode) String() string {
+	if m == SLOReject {
+		return "reject"
+	}
+	return "deprioritize"
+}
+
+// SLOAwareSelector 预测每个节点的TTFT（积压 + 未缓存token计算 + 传输）并选择最小者
+type SLOAwareSelector struct {
+	Model *TTFTCostModel
+	SLOMs float64 // TTFT目标（毫秒）
+	Mode  SLOMode
+
+	Rejected      int // 被拒绝的请求数
+	Deprioritized int // 被降级的请求数
+	Completed     int // 已完成的请求数
+	Violations    int // 实际TTFT超过SLO的已完成请求数
+
+	bestEffort map[*Request]bool
+}
+
+func NewSLOAwareSelector(model *TTFTCostModel, sloMs float64, mode SLOMode) *SLOAwareSelector {
+	return &SLOAwareSelector{
+		Model:      model,
+		SLOMs:      sloMs,
+		Mode:       mode,
+		bestEffort: make(map[*Request]bool),
+	}
+}
+
+func (s *SLOAwareSelector) SelectNode(request *Request, nodes []*PrefillNode) *PrefillNode {
+	now := float64(request.Timestamp)
+
+	var bestNode *PrefillNode
+	bestTTFT := math.Inf(1)
+	for _, node := range nodes {
+		ttft := s.Model.Predict(request, node, now)
+		if ttft < bestTTFT || (ttft == bestTTFT && node.QueueLength() < bestNode.QueueLength()) {
+			bestNode, bestTTFT = node, ttft
+		}
+	}
+	if bestNode == nil {
+		return nil
+	}
+
+	if bestTTFT > s.SLOMs {
+		if s.Mode == SLOReject {
+			s.Rejected++
+			return nil
+		}
+		s.Deprioritized++
+		s.bestEffort[request] = true
+	}
+
+	s.Model.Observe(request, bestNode, now)
+	return bestNode
+}
+
+// BestEffort 实现BestEffortHinter：被降级的请求以尽力而为方式入队
+func (s *SLOAwareSelector) BestEffort(request *Request) bool {
+	flagged := s.bestEffort[request]
+	delete(s.bestEffort, request)
+	return flagged
+}
+
+// OnRequestCompleted 实现SelectionObserver：校准代价模型并统计SLO达成情况
+func (s *SLOAwareSelector) OnRequestCompleted(request *Request, result *PrefillResult) {
+	s.Model.OnRequestCompleted(request, result)
+	s.Completed++
+	if result.TTFT > s.SLOMs {
+		s.Violations++
+	}
+}
+
+// OnRequestFailed 实现FailureObserver：清理失败请求的在途状态
+func (s *SLOAwareSelector) OnRequestFailed(request *Request, at float64) {
+	s.Model.OnRequestFailed(request, at)
+	delete(s.bestEffort, request)
+}
+
+// SLOAttainment 已完成请求中满足SLO的比例
+func (s *SLOAwareSelector) SLOAttainment() float64 {
+	if s.Completed == 0 {
+		return 0
+	}
+	return 1 - float64(s.Violations)/float64(s.Completed)
+}
+
+func (s *SLOAwareSelector) GetName() string {
+	return fmt.Sprintf("SLOAware(ttft<=%.0fms,%s)", s.SLOMs, s.Mode)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ============= 轨迹分析 =============
+
+// HistogramBucket 直方图区间 [Lower, Upper]
+type HistogramBucket struct {
+	Lower int `json:"lower"`
+	Upper int `json:"upper"`
+	Count int `json:"count"`
+}
+
+// Histogram 以2的幂为区间边界的直方图及分位数
+type Histogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int               `json:"count"`
+	Mean    float64           `json:"mean"`
+	P50     int               `json:"p50"`
+	P90     int               `json:"p90"`
+	P99     int               `json:"p99"`
+	Max     int               `json:"max"`
+}
+
+// newLog2Histogram 构造直方图：区间为[0,0] [1,1] [2,3] [4,7] ...
+func newLog2Histogram(values []int) Histogram {
+	h := Histogram{Count: len(values)}
+	if len(values) == 0 {
+		return h
+	}
+
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	sum := 0
+	for _, v := range sorted {
+		sum += v
+	}
+	h.Mean = float64(sum) / float64(len(sorted))
+	h.P50 = percentileInt(sorted, 0.50)
+	h.P90 = percentileInt(sorted, 0.90)
+	h.P99 = percentileInt(sorted, 0.99)
+	h.Max = sorted[len(sorted)-1]
+
+	counts := make(map[int]int)
+	maxBucket := 0
+	for _, v := range sorted {
+		b := log2Bucket(v)
+		counts[b]++
+		maxBucket = max(maxBucket, b)
+	}
+	for b := 0; b <= maxBucket; b++ {
+		lower, upper := 0, 0
+		if b > 0 {
+			lower, upper = 1<<(b-1), 1<<b-1
+		}
+		h.Buckets = append(h.Buckets, HistogramBucket{Lower: lower, Upper: upper, Count: counts[b]})
+	}
+	return h
+}
+
+func log2Bucket(v int) int {
+	b := 0
+	for v > 0 {
+		v >>= 1
+		b++
+	}
+	return b
+}
+
+// percentileInt 已排序切片的分位数
+func percentileInt(sorted []int, q float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+// percentileFloat 已排序浮点切片的q分位数
+func percentileFloat(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+// BlockPopularity block热度
+type BlockPopularity struct {
+	HashID   int `json:"hash_id"`
+	Accesses int `json:"accesses"`
+}
+
+// RatePoint 时间窗口内的到达率
+type RatePoint struct {
+	StartMs    int     `json:"start_ms"`
+	Requests   int     `json:"requests"`
+	RatePerSec float64 `json:"rate_per_sec"`
+}
+
+// TraceAnalysis 轨迹分析报告
+type TraceAnalysis struct {
+	Requests     int `json:"requests"`
+	DurationMs   int `json:"duration_ms"`
+	TotalBlocks  int `json:"total_blocks"`
+	UniqueBlocks int `json:"unique_blocks"`
+
+	InfiniteCacheHitRate  float64 `json:"infinite_cache_hit_rate"`  // 无限容量下任意已见block均命中
+	InfinitePrefixHitRate float64 `json:"infinite_prefix_hit_rate"` // 无限容量下仅连续前缀可复用（vLLM/Mooncake语义）
+
+	PrefixSharingDepth Histogram `json:"prefix_sharing_depth"` // 与历史请求的最长公共前缀（block数）
+	ReuseDistance      Histogram `json:"reuse_distance"`       // 两次访问同一block之间访问过的不同block数
+	ColdAccesses       int       `json:"cold_accesses"`        // 首次访问（无复用距离）
+
+	TopBlocks []BlockPopularity `json:"top_blocks"`
+	ZipfAlpha float64           `json:"zipf_alpha"` // 频次-排名对数线性拟合的斜率绝对值
+	ZipfR2    float64           `json:"zipf_r2"`
+
+	ArrivalWindowMs int         `json:"arrival_window_ms"`
+	ArrivalRate     []RatePoint `json:"arrival_rate"`
+	InputLengths    Histogram   `json:"input_lengths"`
+	OutputLengths   Histogram   `json:"output_lengths"`
+}
+
+// AnalyzeTrace 从HashIDs与Timestamp计算轨迹统计；windowMs为到达率统计窗口，topN为输出的热门block数（负数按0处理）
+func AnalyzeTrace(requests []*Request, windowMs int, topN int) *TraceAnalysis {
+	a := &TraceAnalysis{Requests: len(requests), ArrivalWindowMs: windowMs}
+	if len(requests) == 0 {
+		return a
+	}
+
+	totalAccesses := 0
+	for _, r := range requests {
+		totalAccesses += len(r.HashIDs)
+	}
+
+	trie := make(map[[2]int]int) // (父节点, hashID) -> 子节点，节点0为根
+	nextNode := 1
+	lastAccess := make(map[int]int)
+	accessCount := make(map[int]int)
+	reuse := newFenwickTree(totalAccesses)
+
+	prefixDepths := make([]int, 0, len(requests))
+	reuseDistances := make([]int, 0, totalAccesses)
+	inputLengths := make([]int, 0, len(requests))
+	outputLengths := make([]int, 0, len(requests))
+	anyHits, prefixHits := 0, 0
+
+	firstTs, lastTs := requests[0].Timestamp, requests[0].Timestamp
+	t := 0
+	for _, r := range requests {
+		firstTs = min(firstTs, r.Timestamp)
+		lastTs = max(lastTs, r.Timestamp)
+		inputLengths = append(inputLengths, r.InputLength)
+		outputLengths = append(outputLengths, r.OutputLength)
+
+		// 前缀共享深度：沿前缀树匹配，未匹配部分插入
+		node, depth, matching := 0, 0, true
+		for _, hashID := range r.HashIDs {
+			key := [2]int{node, hashID}
+			child, exists := trie[key]
+			if exists && matching {
+				depth++
+			} else {
+				matching = false
+				if !exists {
+					child = nextNode
+					nextNode++
+					trie[key] = child
+				}
+			}
+			node = child
+		}
+		prefixDepths = append(prefixDepths, depth)
+		prefixHits += depth
+
+		// 复用距离：Fenwick树上只保留每个block最近一次访问的标记
+		for _, hashID := range r.HashIDs {
+			if last, seen := lastAccess[hashID]; seen {
+				anyHits++
+				reuseDistances = append(reuseDistances, reuse.rangeSum(last+1, t-1))
+				reuse.add(last, -1)
+			} else {
+				a.ColdAccesses++
+			}
+			reuse.add(t, 1)
+			lastAccess[hashID] = t
+			accessCount[hashID]++
+			t++
+		}
+	}
+
+	a.DurationMs = lastTs - firstTs
+	a.TotalBlocks = totalAccesses
+	a.UniqueBlocks = len(accessCount)
+	if totalAccesses > 0 {
+		a.InfiniteCacheHitRate = float64(anyHits) / float64(totalAccesses)
+		a.InfinitePrefixHitRate = float64(prefixHits) / float64(totalAccesses)
+	}
+	a.PrefixSharingDepth = newLog2Histogram(prefixDepths)
+	a.ReuseDistance = newLog2Histogram(reuseDistances)
+	a.InputLengths = newLog2Histogram(inputLengths)
+	a.OutputLengths = newLog2Histogram(outputLengths)
+
+	a.analyzePopularity(accessCount, topN)
+	a.analyzeArrivals(requests, firstTs, windowMs)
+	return a
+}
+
+// analyzePopularity 统计热门block并拟合Zipf分布：log(频次) = c - α·log(排名)
+func (a *TraceAnalysis) analyzePopularity(accessCount map[int]int, topN int) {
+	ranked := make([]BlockPopularity, 0, len(accessCount))
+	for hashID, count := range accessCount {
+		ranked = append(ranked, BlockPopularity{HashID: hashID, Accesses: count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Accesses != ranked[j].Accesses {
+			return ranked[i].Accesses > ranked[j].Accesses
+		}
+		return ranked[i].HashID < ranked[j].HashID
+	})
+	a.TopBlocks = ranked[:min(max(topN, 0), len(ranked))]
+
+	// 只拟合被复用过的block（频次为1的长尾会把斜率压平），样本不足时退回全部
+	fit := ranked
+	for i, b := range ranked {
+		if b.Accesses < 2 {
+			if i >= 10 {
+				fit = ranked[:i]
+			}
+			break
+		}
+	}
+
+	var sumX, sumY, sumXY, sumX2 float64
+	n := float64(len(fit))
+	for i, b := range fit {
+		x := math.Log(float64(i + 1))
+		y := math.Log(float64(b.Accesses))
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumX2 += x * x
+	}
+	denominator := n*sumX2 - sumX*sumX
+	if len(fit) < 2 || denominator == 0 {
+		return
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	a.ZipfAlpha = -slope
+
+	meanY := sumY / n
+	var ssTot, ssRes float64
+	for i, b := range fit {
+		y := math.Log(float64(b.Accesses))
+		predicted := intercept + slope*math.Log(float64(i+1))
+		ssTot += (y - meanY) * (y - meanY)
+		ssRes += (y - predicted) * (y - predicted)
+	}
+	if ssTot > 0 {
+		a.ZipfR2 = 1 - ssRes/ssTot
+	}
+}
+
+// analyzeArrivals 按固定窗口统计到达率
+func (a *TraceAnalysis) analyzeArrivals(requests []*Request, firstTs int, windowMs int) {
+	if windowMs <= 0 {
+		return
+	}
+	buckets := a.DurationMs/windowMs + 1
+	counts := make([]int, buckets)
+	for _, r := range requests {
+		counts[(r.Timestamp-firstTs)/windowMs]++
+	}
+	for i, count := range counts {
+		a.ArrivalRate = append(a.ArrivalRate, RatePoint{
+			StartMs:    firstTs + i*windowMs,
+			Requests:   count,
+			RatePerSec: float64(count) / (float64(windowMs) / 1000),
+		})
+	}
+}
+
+// Print 输出可读报告
+func (a *TraceAnalysis) Print() {
+	fmt.Println("\n🔎 轨迹分析报告")
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("请求数: %d   时长: %.1f秒   平均到达率: %.2f请求/秒\n",
+		a.Requests, float64(a.DurationMs)/1000, float64(a.Requests)/math.Max(float64(a.DurationMs)/1000, 1e-9))
+	fmt.Printf("block访问: %d   不同block: %d\n", a.TotalBlocks, a.UniqueBlocks)
+	fmt.Printf("理论命中率上限 (无限缓存): 任意复用 %.2f%%   连续前缀复用 %.2f%%\n",
+		a.InfiniteCacheHitRate*100, a.InfinitePrefixHitRate*100)
+
+	printHistogram("前缀共享深度 (block)", a.PrefixSharingDepth)
+	printHistogram(fmt.Sprintf("复用距离 (不同block数, 冷访问%d次)", a.ColdAccesses), a.ReuseDistance)
+	printHistogram("输入长度 (token)", a.InputLengths)
+	printHistogram("输出长度 (token)", a.OutputLengths)
+
+	fmt.Printf("\nblock热度: Zipf α=%.3f (R²=%.3f)\n", a.ZipfAlpha, a.ZipfR2)
+	for i, b := range a.TopBlocks {
+		fmt.Printf("  #%-3d hash=%-10d 访问%d次\n", i+1, b.HashID, b.Accesses)
+	}
+
+	if len(a.ArrivalRate) > 0 {
+		peak := a.ArrivalRate[0]
+		for _, p := range a.ArrivalRate {
+			if p.RatePerSec > peak.RatePerSec {
+				peak = p
+			}
+		}
+		fmt.Printf("\n到达率 (窗口%.0f秒): 峰值 %.2f请求/秒 @ %.0f秒\n",
+			float64(a.ArrivalWindowMs)/1000, peak.RatePerSec, float64(peak.StartMs)/1000)
+		scale := peak.RatePerSec
+		for _, p := range a.ArrivalRate[:min(len(a.ArrivalRate), 60)] {
+			bar := 0
+			if scale > 0 {
+				bar = int(p.RatePerSec / scale * 40)
+			}
+			fmt.Printf("  %8.0fs %7.2f %s\n", float64(p.StartMs)/1000, p.RatePerSec, strings.Repeat("█", bar))
+		}
+		if len(a.ArrivalRate) > 60 {
+			fmt.Printf("  ... 共%d个窗口（完整序列见JSON导出）\n", len(a.ArrivalRate))
+		}
+	}
+}
+
+func printHistogram(title string, h Histogram) {
+	fmt.Printf("\n%s: 均值 %.1f  P50 %d  P90 %d  P99 %d  最大 %d\n", title, h.Mean, h.P50, h.P90, h.P99, h.Max)
+	for _, b := range h.Buckets {
+		if b.Count == 0 {
+			continue
+		}
+		share := float64(b.Count) / float64(h.Count)
+		fmt.Printf("  [%7d, %7d] %6.2f%% %s\n", b.Lower, b.Upper, share*100, strings.Repeat("█", int(share*40)))
+	}
+}
+
+// fenwickTree 树状数组，用于O(log n)统计区间内的最近访问标记数
+type fenwickTree struct {
+	tree []int
+}
+
+func newFenwickTree(n int) *fenwickTree {
+	return &fenwickTree{tree: make([]int, n+1)}
+}
+
+func (f *fenwickTree) add(i int, delta int) {
+	for i++; i < len(f.tree); i += i & -i {
+		f.tree[i] += delta
+	}
+}
+
+// prefixSum 返回[0, i]的和
+func (f *fenwickTree) prefixSum(i int) int {
+	sum := 0
+	for i++; i > 0; i -= i & -i {
+		sum += f.tree[i]
+	}
+	return sum
+}
+
+func (f *fenwickTree) rangeSum(lo, hi int) int {
+	if hi < lo {
+		return 0
+	}
+	return f.prefixSum(hi) - f.prefixSum(lo-1)
+}
@@ -0,0 +1,1060 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ============= 轨迹格式：读取器注册与自动识别 =============
+
+// TraceReader 轨迹读取器：逐条返回请求，读完时返回io.EOF
+type TraceReader interface {
+	Next() (*Request, error)
+}
+
+// skippedReporter 宽松模式下可报告跳过记录的读取器
+type skippedReporter interface {
+	SkipReport() TraceSkipReport
+}
+
+// TraceFormat 轨迹格式描述
+type TraceFormat struct {
+	Name       string
+	Extensions []string // 文件扩展名（含点，如".jsonl"）
+	Magic      []byte   // 文件头魔数（可为空）
+	Open       func(r io.Reader, opts TraceLoadOptions) (TraceReader, error)
+}
+
+// TraceDecompressor 压缩层描述，识别后解压再交给格式读取器
+type TraceDecompressor struct {
+	Name      string
+	Extension string // 压缩扩展名（如".gz"），识别后从文件名中剥离再判断内层格式
+	Magic     []byte
+	Wrap      func(r io.Reader) (io.ReadCloser, error)
+}
+
+var traceFormats = []TraceFormat{
+	{
+		Name:       "jsonl",
+		Extensions: []string{".jsonl", ".json", ".ndjson"},
+		Open: func(r io.Reader, opts TraceLoadOptions) (TraceReader, error) {
+			return NewRequestStream(r, opts), nil
+		},
+	},
+	{
+		Name:       "csv",
+		Extensions: []string{".csv"},
+		Open: func(r io.Reader, opts TraceLoadOptions) (TraceReader, error) {
+			return NewCSVTraceReader(r, opts)
+		},
+	},
+	{
+		Name:       "k3tb",
+		Extensions: []string{".k3tb"},
+		Magic:      binaryTraceMagic,
+		Open: func(r io.Reader, opts TraceLoadOptions) (TraceReader, error) {
+			return NewBinaryTraceReader(r, opts)
+		},
+	},
+}
+
+var traceDecompressors = []TraceDecompressor{
+	{
+		Name:      "gzip",
+		Extension: ".gz",
+		Magic:     []byte{0x1f, 0x8b},
+		Wrap: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		Name:      "zstd",
+		Extension: ".zst",
+		Magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		Wrap:      newZstdReader,
+	},
+}
+
+// RegisterTraceFormat 注册轨迹格式，同名格式会被替换
+func RegisterTraceFormat(format TraceFormat) {
+	for i, existing := range traceFormats {
+		if existing.Name == format.Name {
+			traceFormats[i] = format
+			return
+		}
+	}
+	traceFormats = append(traceFormats, format)
+}
+
+// RegisterTraceDecompressor 注册压缩层，同名压缩层会被替换
+func RegisterTraceDecompressor(decompressor TraceDecompressor) {
+	for i, existing := range traceDecompressors {
+		if existing.Name == decompressor.Name {
+			traceDecompressors[i] = decompressor
+			return
+		}
+	}
+	traceDecompressors = append(traceDecompressors, decompressor)
+}
+
+// TraceFile 打开的轨迹文件，关闭时释放文件与解压层
+type TraceFile struct {
+	TraceReader
+	Format  string // 识别出的格式名
+	closers []io.Closer
+}
+
+// SkipReport 返回宽松模式下跳过的记录
+func (t *TraceFile) SkipReport() TraceSkipReport {
+	if reporter, ok := t.TraceReader.(skippedReporter); ok {
+		return reporter.SkipReport()
+	}
+	return TraceSkipReport{}
+}
+
+func (t *TraceFile) Close() error {
+	return closeAll(nil, t.closers)
+}
+
+// OpenTrace 打开轨迹文件，按魔数与扩展名自动识别压缩层和格式
+func OpenTrace(filename string, opts TraceLoadOptions) (*TraceFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	trace := &TraceFile{closers: []io.Closer{file}}
+
+	name := strings.ToLower(filename)
+	reader := bufio.NewReader(file)
+
+	// 1. 识别压缩层（魔数优先，其次扩展名）
+	if decompressor := detectDecompressor(reader, name); decompressor != nil {
+		inner, err := decompressor.Wrap(reader)
+		if err != nil {
+			trace.Close()
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		trace.closers = append(trace.closers, inner)
+		name = strings.TrimSuffix(name, decompressor.Extension)
+		reader = bufio.NewReader(inner)
+	}
+
+	// 2. 识别内层格式
+	format, err := detectTraceFormat(reader, name)
+	if err != nil {
+		trace.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	traceReader, err := format.Open(reader, opts)
+	if err != nil {
+		trace.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	trace.TraceReader = traceReader
+	trace.Format = format.Name
+	return trace, nil
+}
+
+func detectDecompressor(reader *bufio.Reader, name string) *TraceDecompressor {
+	for i := range traceDecompressors {
+		d := &traceDecompressors[i]
+		if len(d.Magic) > 0 {
+			if head, err := reader.Peek(len(d.Magic)); err == nil && bytes.Equal(head, d.Magic) {
+				return d
+			}
+		}
+	}
+	for i := range traceDecompressors {
+		if d := &traceDecompressors[i]; d.Extension != "" && strings.HasSuffix(name, d.Extension) {
+			return d
+		}
+	}
+	return nil
+}
+
+func detectTraceFormat(reader *bufio.Reader, name string) (*TraceFormat, error) {
+	for i := range traceFormats {
+		f := &traceFormats[i]
+		if len(f.Magic) > 0 {
+			if head, err := reader.Peek(len(f.Magic)); err == nil && bytes.Equal(head, f.Magic) {
+				return f, nil
+			}
+		}
+	}
+
+	ext := filepath.Ext(name)
+	for i := range traceFormats {
+		for _, candidate := range traceFormats[i].Extensions {
+			if ext == candidate {
+				return &traceFormats[i], nil
+			}
+		}
+	}
+
+	// 扩展名未知时按内容嗅探：以'{'开头视为JSONL，首行为含hash_ids的逗号分隔表头视为CSV
+	head, _ := reader.Peek(512)
+	if trimmed := bytes.TrimLeft(head, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return lookupTraceFormat("jsonl")
+	}
+	firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+	if bytes.Contains(firstLine, []byte("hash_ids")) && bytes.Contains(firstLine, []byte(",")) {
+		return lookupTraceFormat("csv")
+	}
+	return nil, fmt.Errorf("unrecognized trace format (extension %q)", ext)
+}
+
+func lookupTraceFormat(name string) (*TraceFormat, error) {
+	for i := range traceFormats {
+		if traceFormats[i].Name == name {
+			return &traceFormats[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown trace format %q", name)
+}
+
+// ============= CSV读取器 =============
+
+// CSVColumnMapping CSV列名到请求字段的映射
+type CSVColumnMapping struct {
+	Timestamp    string
+	InputLength  string
+	OutputLength string
+	HashIDs      string // 单列内的hash ID列表，以空格、分号、竖线或逗号分隔，可带方括号
+
+	// 可选列：表头中不存在时忽略
+	TenantID  string
+	Priority  string
+	ModelID   string
+	SessionID string
+}
+
+// DefaultCSVColumnMapping 与JSON字段同名的默认列映射
+func DefaultCSVColumnMapping() *CSVColumnMapping {
+	return &CSVColumnMapping{
+		Timestamp:    "timestamp",
+		InputLength:  "input_length",
+		OutputLength: "output_length",
+		HashIDs:      "hash_ids",
+		TenantID:     "tenant_id",
+		Priority:     "priority",
+		ModelID:      "model_id",
+		SessionID:    "session_id",
+	}
+}
+
+// CSVTraceReader 带表头的CSV轨迹读取器
+type CSVTraceReader struct {
+	traceErrorLog
+	reader  *csv.Reader
+	columns [8]int // timestamp, input_length, output_length, hash_ids, tenant_id, priority, model_id, session_id 的列下标（可选列缺失为-1）
+}
+
+func NewCSVTraceReader(r io.Reader, opts TraceLoadOptions) (*CSVTraceReader, error) {
+	mapping := opts.CSVColumns
+	if mapping == nil {
+		mapping = DefaultCSVColumnMapping()
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+
+	c := &CSVTraceReader{traceErrorLog: traceErrorLog{opts: opts}, reader: reader}
+	for i, name := range []string{mapping.Timestamp, mapping.InputLength, mapping.OutputLength, mapping.HashIDs} {
+		col, exists := index[name]
+		if !exists {
+			return nil, fmt.Errorf("csv header missing column %q", name)
+		}
+		c.columns[i] = col
+	}
+	for i, name := range []string{mapping.TenantID, mapping.Priority, mapping.ModelID, mapping.SessionID} {
+		col, exists := index[name]
+		if !exists || name == "" {
+			col = -1
+		}
+		c.columns[4+i] = col
+	}
+	return c, nil
+}
+
+func (c *CSVTraceReader) Next() (*Request, error) {
+	for {
+		record, err := c.reader.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				if lineErr := c.record(parseErr.Line, parseErr.Err); lineErr != nil {
+					return nil, lineErr
+				}
+				continue
+			}
+			return nil, err
+		}
+
+		request, err := c.parseRecord(record)
+		if err == nil {
+			return request, nil
+		}
+		line, _ := c.reader.FieldPos(0)
+		if lineErr := c.record(line, err); lineErr != nil {
+			return nil, lineErr
+		}
+	}
+}
+
+func (c *CSVTraceReader) parseRecord(record []string) (*Request, error) {
+	field := func(i int) (string, bool) {
+		if c.columns[i] < 0 || c.columns[i] >= len(record) {
+			return "", false
+		}
+		value := strings.TrimSpace(record[c.columns[i]])
+		return value, value != ""
+	}
+
+	var raw rawRequest
+	targets := []**int{&raw.Timestamp, &raw.InputLength, &raw.OutputLength}
+	for i, target := range targets {
+		value, ok := field(i)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", c.columns[i]+1, err)
+		}
+		*target = &n
+	}
+
+	if value, ok := field(3); ok {
+		hashIDs, err := parseHashIDList(value)
+		if err != nil {
+			return nil, err
+		}
+		raw.HashIDs = &hashIDs
+	}
+	if value, ok := field(4); ok {
+		raw.TenantID = &value
+	}
+	if value, ok := field(5); ok {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", c.columns[5]+1, err)
+		}
+		raw.Priority = &priority
+	}
+	if value, ok := field(6); ok {
+		raw.ModelID = &value
+	}
+	if value, ok := field(7); ok {
+		raw.SessionID = &value
+	}
+	return raw.toRequest()
+}
+
+// parseHashIDList 解析单列hash ID列表，如"[1,2,3]"、"1 2 3"或"1;2;3"
+func parseHashIDList(value string) ([]int, error) {
+	value = strings.Trim(value, "[]")
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ';' || r == '|' || r == '\t'
+	})
+	hashIDs := make([]int, len(fields))
+	for i, f := range fields {
+		id, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("hash_ids[%d]: %w", i, err)
+		}
+		hashIDs[i] = id
+	}
+	return hashIDs, nil
+}
+
+// ============= 紧凑二进制格式 =============
+//
+// 文件头: "K3TB" + 版本号(1字节)
+//
+// 版本5（列式）: 文件由若干行组依次组成，行组之间互不依赖，损坏的行组可整体跳过。
+// 每个行组: 行数(uvarint) 数据字节数(uvarint) 数据；数据为9列依次排列，每列以字节数(uvarint)开头:
+//   timestamp(组内相对上一行的差值，首行相对0，varint) input_length(uvarint) output_length(uvarint)
+//   block数(uvarint) hash ID(各行内相对前一个的差值，varint，所有行依次拼接) priority(uvarint)
+//   租户、模型、会话: 组内字典大小(uvarint) 各名称(长度uvarint+字节) 每行引用(uvarint，0表示未设置，k表示字典第k项)
+// 同一列的值类型与分布相近，差值编码后大多只占1字节，外层再压缩时也比行式更紧凑。
+//
+// 版本1-4（行式，只读兼容）: 每条记录依次为 timestamp差值(varint) input_length(uvarint)
+//           output_length(uvarint) block数(uvarint) 各hash ID相对前一个的差值(varint)
+// 版本2在每条记录末尾追加: 租户引用(uvarint) priority(uvarint)
+// 版本3再追加: 模型引用(uvarint)；版本4再追加: 会话引用(uvarint)
+//           引用0表示未设置，k表示第k个已出现的名称，已出现名称数+1表示新名称，
+//           其后紧跟名称长度(uvarint)与名称字节（租户、模型与会话各自编号）
+
+var binaryTraceMagic = []byte("K3TB")
+
+const (
+	binaryTraceVersion         = 5
+	binaryTraceColumnarVersion = 5
+
+	binaryTraceRowGroupRows  = 4096                    // 写入器每个行组的行数
+	binaryTraceMaxGroupRows  = 1 << 20                 // 读取时接受的行组行数上限
+	binaryTraceMaxGroupBytes = 256 << 20               // 读取时接受的行组字节数上限
+	binaryTraceMaxBlocks     = defaultMaxLineBytes / 2 // 单条记录block数上限（与JSONL单行上限相当）
+	binaryTraceColumns       = 9
+)
+
+// BinaryTraceReader 紧凑二进制轨迹读取器
+type BinaryTraceReader struct {
+	traceErrorLog
+	reader  *bufio.Reader
+	version byte
+	record  int
+	done    bool // 遇到无法重新同步的损坏后停止读取
+
+	// 列式（版本5）
+	group []*rawRequest // 当前行组中尚未返回的记录
+
+	// 行式（版本1-4）
+	lastTimestamp int64
+	tenants       []string // 已出现的租户（版本2）
+	models        []string // 已出现的模型（版本3）
+	sessions      []string // 已出现的会话（版本4）
+}
+
+func NewBinaryTraceReader(r io.Reader, opts TraceLoadOptions) (*BinaryTraceReader, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(binaryTraceMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("read binary trace header: %w", err)
+	}
+	if !bytes.Equal(header[:len(binaryTraceMagic)], binaryTraceMagic) {
+		return nil, errors.New("not a K3TB binary trace")
+	}
+	version := header[len(binaryTraceMagic)]
+	if version < 1 || version > binaryTraceVersion {
+		return nil, fmt.Errorf("unsupported K3TB version %d", version)
+	}
+	return &BinaryTraceReader{traceErrorLog: traceErrorLog{opts: opts}, reader: reader, version: version}, nil
+}
+
+// Next 返回下一条合法请求，读完时返回io.EOF。
+// 损坏的列式行组在宽松模式下整组跳过；行式记录损坏后无法重新同步，宽松模式登记错误后结束读取
+func (b *BinaryTraceReader) Next() (*Request, error) {
+	for !b.done {
+		var raw *rawRequest
+		var err error
+		if b.version >= binaryTraceColumnarVersion {
+			raw, err = b.nextColumnar()
+		} else {
+			raw, err = b.nextRow()
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == nil {
+			b.record++
+			var request *Request
+			if request, err = raw.toRequest(); err == nil {
+				return request, nil
+			}
+			if lineErr := b.traceErrorLog.record(b.record, err); lineErr != nil {
+				return nil, lineErr
+			}
+			continue
+		}
+
+		var groupErr *binaryGroupError
+		if errors.As(err, &groupErr) && !groupErr.fatal {
+			lineErr := b.traceErrorLog.record(b.record+1, err)
+			b.record += groupErr.rows
+			if lineErr != nil {
+				return nil, lineErr
+			}
+			continue
+		}
+		b.done = true
+		if lineErr := b.traceErrorLog.record(b.record+1, err); lineErr != nil {
+			return nil, lineErr
+		}
+	}
+	return nil, io.EOF
+}
+
+// ============= K3TB列式行组 =============
+
+// binaryGroupError 行组损坏；fatal表示行组边界本身不可信，无法跳到下一组
+type binaryGroupError struct {
+	rows  int
+	fatal bool
+	err   error
+}
+
+func (e *binaryGroupError) Error() string {
+	return fmt.Sprintf("row group of %d records: %v", e.rows, e.err)
+}
+
+func (e *binaryGroupError) Unwrap() error {
+	return e.err
+}
+
+func (b *BinaryTraceReader) nextColumnar() (*rawRequest, error) {
+	for len(b.group) == 0 {
+		if _, err := b.reader.Peek(1); err == io.EOF {
+			return nil, io.EOF
+		}
+		group, err := b.readGroup()
+		if err != nil {
+			return nil, err
+		}
+		b.group = group
+	}
+	raw := b.group[0]
+	b.group = b.group[1:]
+	return raw, nil
+}
+
+// readGroup 读取并解码一个行组
+func (b *BinaryTraceReader) readGroup() ([]*rawRequest, error) {
+	rows, err := binary.ReadUvarint(b.reader)
+	if err != nil {
+		return nil, &binaryGroupError{fatal: true, err: unexpectedEOF(err)}
+	}
+	size, err := binary.ReadUvarint(b.reader)
+	if err != nil {
+		return nil, &binaryGroupError{fatal: true, err: unexpectedEOF(err)}
+	}
+	if rows == 0 || rows > binaryTraceMaxGroupRows || size > binaryTraceMaxGroupBytes {
+		return nil, &binaryGroupError{fatal: true, err: fmt.Errorf("invalid row group header (%d rows, %d bytes)", rows, size)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(b.reader, data); err != nil {
+		return nil, &binaryGroupError{rows: int(rows), fatal: true, err: unexpectedEOF(err)}
+	}
+
+	group, err := decodeBinaryGroup(data, int(rows))
+	if err != nil {
+		return nil, &binaryGroupError{rows: int(rows), err: err}
+	}
+	return group, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+var errBinaryColumn = errors.New("malformed column")
+
+// binaryColumn 列数据的顺序读取游标
+type binaryColumn struct {
+	data []byte
+}
+
+func (c *binaryColumn) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(c.data)
+	if n <= 0 {
+		return 0, errBinaryColumn
+	}
+	c.data = c.data[n:]
+	return v, nil
+}
+
+func (c *binaryColumn) varint() (int64, error) {
+	v, n := binary.Varint(c.data)
+	if n <= 0 {
+		return 0, errBinaryColumn
+	}
+	c.data = c.data[n:]
+	return v, nil
+}
+
+func (c *binaryColumn) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(c.data)) {
+		return nil, errBinaryColumn
+	}
+	b := c.data[:n]
+	c.data = c.data[n:]
+	return b, nil
+}
+
+// decodeBinaryGroup 把行组数据按列解码为rows条记录（取值范围由toRequest逐条校验）
+func decodeBinaryGroup(data []byte, rows int) ([]*rawRequest, error) {
+	outer := binaryColumn{data: data}
+	var columns [binaryTraceColumns]binaryColumn
+	for i := range columns {
+		size, err := outer.uvarint()
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", i, err)
+		}
+		if columns[i].data, err = outer.bytes(size); err != nil {
+			return nil, fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	if len(outer.data) != 0 {
+		return nil, errors.New("trailing bytes after last column")
+	}
+
+	group := make([]*rawRequest, rows)
+	timestamp := int64(0)
+	for row := range group {
+		delta, err := columns[0].varint()
+		if err != nil {
+			return nil, fmt.Errorf("timestamp column: %w", err)
+		}
+		timestamp += delta
+		var values [3]uint64
+		for i := range values {
+			if values[i], err = columns[1+i].uvarint(); err != nil {
+				return nil, fmt.Errorf("column %d: %w", 1+i, err)
+			}
+		}
+		// 每个hash ID至少占1字节，block数不能超过hash列剩余的字节数
+		count := values[2]
+		if count > uint64(len(columns[4].data)) {
+			return nil, fmt.Errorf("record %d: block count %d exceeds hash column", row+1, count)
+		}
+		hashIDs := make([]int, count)
+		previous := int64(0)
+		for i := range hashIDs {
+			d, err := columns[4].varint()
+			if err != nil {
+				return nil, fmt.Errorf("hash column: %w", err)
+			}
+			previous += d
+			hashIDs[i] = int(previous)
+		}
+		priority, err := columns[5].uvarint()
+		if err != nil {
+			return nil, fmt.Errorf("priority column: %w", err)
+		}
+
+		ts, input, output, p := int(timestamp), int(values[0]), int(values[1]), int(priority)
+		group[row] = &rawRequest{Timestamp: &ts, InputLength: &input, OutputLength: &output, HashIDs: &hashIDs, Priority: &p}
+	}
+
+	names := []func(raw *rawRequest, name *string){
+		func(raw *rawRequest, name *string) { raw.TenantID = name },
+		func(raw *rawRequest, name *string) { raw.ModelID = name },
+		func(raw *rawRequest, name *string) { raw.SessionID = name },
+	}
+	for i, assign := range names {
+		if err := decodeBinaryNames(&columns[6+i], group, assign); err != nil {
+			return nil, fmt.Errorf("column %d: %w", 6+i, err)
+		}
+	}
+
+	for i := range columns {
+		if len(columns[i].data) != 0 {
+			return nil, fmt.Errorf("column %d: %d trailing bytes", i, len(columns[i].data))
+		}
+	}
+	return group, nil
+}
+
+// decodeBinaryNames 解码名称列（组内字典+每行引用）
+func decodeBinaryNames(column *binaryColumn, group []*rawRequest, assign func(raw *rawRequest, name *string)) error {
+	size, err := column.uvarint()
+	if err != nil {
+		return err
+	}
+	// 每个名称至少占1字节的长度前缀
+	if size > uint64(len(column.data)) {
+		return fmt.Errorf("dictionary size %d exceeds column", size)
+	}
+	dictionary := make([]string, size)
+	for i := range dictionary {
+		length, err := column.uvarint()
+		if err != nil {
+			return err
+		}
+		name, err := column.bytes(length)
+		if err != nil {
+			return err
+		}
+		dictionary[i] = string(name)
+	}
+	for _, raw := range group {
+		ref, err := column.uvarint()
+		if err != nil {
+			return err
+		}
+		if ref > uint64(len(dictionary)) {
+			return fmt.Errorf("invalid name reference %d", ref)
+		}
+		if ref > 0 {
+			assign(raw, &dictionary[ref-1])
+		}
+	}
+	return nil
+}
+
+// ============= K3TB行式记录（版本1-4） =============
+
+func (b *BinaryTraceReader) nextRow() (*rawRequest, error) {
+	if _, err := b.reader.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+	raw, err := b.readRecord()
+	return raw, unexpectedEOF(err)
+}
+
+func (b *BinaryTraceReader) readRecord() (*rawRequest, error) {
+	delta, err := binary.ReadVarint(b.reader)
+	if err != nil {
+		return nil, err
+	}
+	b.lastTimestamp += delta
+	timestamp := int(b.lastTimestamp)
+
+	values := make([]int, 3)
+	for i := range values {
+		v, err := binary.ReadUvarint(b.reader)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = int(v)
+	}
+	inputLength, outputLength, count := values[0], values[1], values[2]
+	if count < 0 || count > binaryTraceMaxBlocks {
+		return nil, fmt.Errorf("block count %d exceeds limit %d", values[2], binaryTraceMaxBlocks)
+	}
+
+	// 按实际读到的数据增长，损坏的计数不会导致一次性大量分配
+	hashIDs := make([]int, 0, min(count, 1024))
+	previous := int64(0)
+	for len(hashIDs) < count {
+		d, err := binary.ReadVarint(b.reader)
+		if err != nil {
+			return nil, err
+		}
+		previous += d
+		hashIDs = append(hashIDs, int(previous))
+	}
+
+	raw := &rawRequest{Timestamp: &timestamp, InputLength: &inputLength, OutputLength: &outputLength, HashIDs: &hashIDs}
+	if b.version >= 2 {
+		if raw.TenantID, err = b.readName(&b.tenants); err != nil {
+			return nil, err
+		}
+		priority, err := binary.ReadUvarint(b.reader)
+		if err != nil {
+			return nil, err
+		}
+		p := int(priority)
+		raw.Priority = &p
+	}
+	if b.version >= 3 {
+		if raw.ModelID, err = b.readName(&b.models); err != nil {
+			return nil, err
+		}
+	}
+	if b.version >= 4 {
+		if raw.SessionID, err = b.readName(&b.sessions); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// readName 读取一个名称引用，新名称追加到names；引用0返回nil
+func (b *BinaryTraceReader) readName(names *[]string) (*string, error) {
+	ref, err := binary.ReadUvarint(b.reader)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ref == 0:
+		return nil, nil
+	case ref <= uint64(len(*names)):
+		return &(*names)[ref-1], nil
+	case ref == uint64(len(*names))+1:
+		length, err := binary.ReadUvarint(b.reader)
+		if err != nil {
+			return nil, err
+		}
+		if length > defaultMaxLineBytes {
+			return nil, fmt.Errorf("name too long (%d bytes)", length)
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(b.reader, name); err != nil {
+			return nil, err
+		}
+		*names = append(*names, string(name))
+		return &(*names)[len(*names)-1], nil
+	}
+	return nil, fmt.Errorf("invalid name reference %d", ref)
+}
+
+// ============= 轨迹写入器 =============
+
+// TraceWriter 轨迹写入器
+type TraceWriter interface {
+	Write(request *Request) error
+	// Close 刷新缓冲并关闭底层资源
+	Close() error
+}
+
+// JSONLTraceWriter 以mooncake_trace.jsonl格式写出
+type JSONLTraceWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	closers []io.Closer
+}
+
+func NewJSONLTraceWriter(w io.Writer) *JSONLTraceWriter {
+	writer := bufio.NewWriter(w)
+	return &JSONLTraceWriter{writer: writer, encoder: json.NewEncoder(writer)}
+}
+
+func (j *JSONLTraceWriter) Write(request *Request) error {
+	return j.encoder.Encode(request)
+}
+
+func (j *JSONLTraceWriter) Close() error {
+	err := j.writer.Flush()
+	return closeAll(err, j.closers)
+}
+
+// CSVTraceWriter 以默认列映射写出CSV，hash ID以空格分隔
+type CSVTraceWriter struct {
+	writer        *csv.Writer
+	closers       []io.Closer
+	headerWritten bool
+}
+
+func NewCSVTraceWriter(w io.Writer) *CSVTraceWriter {
+	return &CSVTraceWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *CSVTraceWriter) Write(request *Request) error {
+	if !c.headerWritten {
+		mapping := DefaultCSVColumnMapping()
+		header := []string{mapping.Timestamp, mapping.InputLength, mapping.OutputLength, mapping.HashIDs,
+			mapping.TenantID, mapping.Priority, mapping.ModelID, mapping.SessionID}
+		if err := c.writer.Write(header); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	ids := make([]string, len(request.HashIDs))
+	for i, id := range request.HashIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return c.writer.Write([]string{
+		strconv.Itoa(request.Timestamp),
+		strconv.Itoa(request.InputLength),
+		strconv.Itoa(request.OutputLength),
+		strings.Join(ids, " "),
+		request.TenantID,
+		strconv.Itoa(request.Priority),
+		request.ModelID,
+		request.SessionID,
+	})
+}
+
+func (c *CSVTraceWriter) Close() error {
+	c.writer.Flush()
+	return closeAll(c.writer.Error(), c.closers)
+}
+
+// BinaryTraceWriter 紧凑二进制轨迹写入器（列式，按行组缓冲后写出）
+type BinaryTraceWriter struct {
+	writer        *bufio.Writer
+	closers       []io.Closer
+	headerWritten bool
+
+	rows          int
+	lastTimestamp int64
+	columns       [6][]byte           // timestamp、input_length、output_length、block数、hash ID、priority
+	names         [3]binaryNameColumn // 租户、模型、会话
+}
+
+// binaryNameColumn 名称列的组内字典与每行引用
+type binaryNameColumn struct {
+	refs       map[string]int // 名称 -> 字典编号（从1开始）
+	dictionary []string
+	column     []byte
+}
+
+func (c *binaryNameColumn) put(name string) {
+	ref := 0
+	if name != "" {
+		if c.refs == nil {
+			c.refs = make(map[string]int)
+		}
+		if ref = c.refs[name]; ref == 0 {
+			c.dictionary = append(c.dictionary, name)
+			ref = len(c.dictionary)
+			c.refs[name] = ref
+		}
+	}
+	c.column = binary.AppendUvarint(c.column, uint64(ref))
+}
+
+// encode 写出字典与引用并清空，供下一个行组使用
+func (c *binaryNameColumn) encode(out []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(c.dictionary)))
+	for _, name := range c.dictionary {
+		out = binary.AppendUvarint(out, uint64(len(name)))
+		out = append(out, name...)
+	}
+	out = append(out, c.column...)
+	*c = binaryNameColumn{dictionary: c.dictionary[:0], column: c.column[:0]}
+	return out
+}
+
+func NewBinaryTraceWriter(w io.Writer) *BinaryTraceWriter {
+	return &BinaryTraceWriter{writer: bufio.NewWriter(w)}
+}
+
+func (b *BinaryTraceWriter) Write(request *Request) error {
+	b.columns[0] = binary.AppendVarint(b.columns[0], int64(request.Timestamp)-b.lastTimestamp)
+	b.lastTimestamp = int64(request.Timestamp)
+	b.columns[1] = binary.AppendUvarint(b.columns[1], uint64(request.InputLength))
+	b.columns[2] = binary.AppendUvarint(b.columns[2], uint64(request.OutputLength))
+	b.columns[3] = binary.AppendUvarint(b.columns[3], uint64(len(request.HashIDs)))
+	previous := int64(0)
+	for _, id := range request.HashIDs {
+		b.columns[4] = binary.AppendVarint(b.columns[4], int64(id)-previous)
+		previous = int64(id)
+	}
+	b.columns[5] = binary.AppendUvarint(b.columns[5], uint64(request.Priority))
+	b.names[0].put(request.TenantID)
+	b.names[1].put(request.ModelID)
+	b.names[2].put(request.SessionID)
+
+	b.rows++
+	if b.rows >= binaryTraceRowGroupRows {
+		return b.flushGroup()
+	}
+	return nil
+}
+
+func (b *BinaryTraceWriter) writeHeader() {
+	if !b.headerWritten {
+		b.writer.Write(binaryTraceMagic)
+		b.writer.WriteByte(binaryTraceVersion)
+		b.headerWritten = true
+	}
+}
+
+// flushGroup 写出缓冲的行组
+func (b *BinaryTraceWriter) flushGroup() error {
+	b.writeHeader()
+	if b.rows == 0 {
+		return nil
+	}
+
+	var data []byte
+	for i := range b.columns {
+		data = binary.AppendUvarint(data, uint64(len(b.columns[i])))
+		data = append(data, b.columns[i]...)
+		b.columns[i] = b.columns[i][:0]
+	}
+	for i := range b.names {
+		column := b.names[i].encode(nil)
+		data = binary.AppendUvarint(data, uint64(len(column)))
+		data = append(data, column...)
+	}
+
+	var header []byte
+	header = binary.AppendUvarint(header, uint64(b.rows))
+	header = binary.AppendUvarint(header, uint64(len(data)))
+	b.writer.Write(header)
+	_, err := b.writer.Write(data)
+
+	b.rows = 0
+	b.lastTimestamp = 0
+	return err
+}
+
+func (b *BinaryTraceWriter) Close() error {
+	err := b.flushGroup()
+	if flushErr := b.writer.Flush(); err == nil {
+		err = flushErr
+	}
+	return closeAll(err, b.closers)
+}
+
+// CreateTrace 按扩展名创建轨迹写入器（.jsonl/.csv/.k3tb，可追加.gz压缩），"-"表示标准输出JSONL
+func CreateTrace(filename string) (TraceWriter, error) {
+	if filename == "-" {
+		return NewJSONLTraceWriter(os.Stdout), nil
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	closers := []io.Closer{file}
+	var w io.Writer = file
+
+	name := strings.ToLower(filename)
+	if strings.HasSuffix(name, ".gz") {
+		gz := gzip.NewWriter(file)
+		closers = append(closers, gz)
+		w = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	switch filepath.Ext(name) {
+	case ".csv":
+		writer := NewCSVTraceWriter(w)
+		writer.closers = closers
+		return writer, nil
+	case ".k3tb":
+		writer := NewBinaryTraceWriter(w)
+		writer.closers = closers
+		return writer, nil
+	default:
+		writer := NewJSONLTraceWriter(w)
+		writer.closers = closers
+		return writer, nil
+	}
+}
+
+// WriteRequests 将请求写入轨迹文件（格式由扩展名决定）
+func WriteRequests(filename string, requests []*Request) error {
+	writer, err := CreateTrace(filename)
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if err := writer.Write(request); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// closeAll 按创建的逆序关闭资源（先关压缩层再关文件），返回第一个错误
+func closeAll(err error, closers []io.Closer) error {
+	for i := len(closers) - 1; i >= 0; i-- {
+		if closeErr := closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleRequests 覆盖可选字段的各种组合（含空值与重复名称）
+func sampleRequests() []*Request {
+	return []*Request{
+		{Timestamp: 0, InputLength: 1024, OutputLength: 16, HashIDs: []int{1, 2}},
+		{Timestamp: 5, InputLength: 1536, OutputLength: 1, HashIDs: []int{1, 2, 3}, TenantID: "acme", Priority: 2},
+		{Timestamp: 5, InputLength: 512, OutputLength: 0, HashIDs: []int{900000, 7}, ModelID: "llama-70b", SessionID: "s-1"},
+		{Timestamp: 1200, InputLength: 2048, OutputLength: 64, HashIDs: []int{1, 2, 3, 4}, TenantID: "acme", ModelID: "llama-70b", SessionID: "s-1"},
+		{Timestamp: 1300, InputLength: 100, OutputLength: 3, HashIDs: []int{42}, TenantID: "other", Priority: 1, SessionID: "s-2"},
+	}
+}
+
+func writeTrace(t *testing.T, name string, requests []*Request) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := WriteRequests(path, requests); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestTraceRoundTrip(t *testing.T) {
+	// 多于一个K3TB行组，覆盖跨行组的时间戳与名称字典
+	many := make([]*Request, 0, binaryTraceRowGroupRows+10)
+	for i := 0; i < binaryTraceRowGroupRows+10; i++ {
+		request := sampleRequests()[i%5]
+		copied := *request
+		copied.Timestamp = i * 7
+		many = append(many, &copied)
+	}
+
+	for _, name := range []string{"trace.jsonl", "trace.csv", "trace.k3tb", "trace.jsonl.gz", "trace.csv.gz", "trace.k3tb.gz"} {
+		for _, requests := range [][]*Request{sampleRequests(), many} {
+			path := writeTrace(t, name, requests)
+			got, skipped, err := LoadRequestsWithOptions(path, TraceLoadOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if skipped.Count != 0 {
+				t.Fatalf("%s: skipped %d records", name, skipped.Count)
+			}
+			if !reflect.DeepEqual(got, requests) {
+				t.Fatalf("%s: round trip mismatch (%d vs %d requests)", name, len(got), len(requests))
+			}
+		}
+	}
+}
+
+func TestTraceDetectsFormatByContent(t *testing.T) {
+	for _, name := range []string{"trace.jsonl", "trace.csv", "trace.k3tb"} {
+		path := writeTrace(t, name, sampleRequests())
+		renamed := strings.TrimSuffix(path, filepath.Ext(path)) + ".dat"
+		if err := os.Rename(path, renamed); err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := LoadRequestsWithOptions(renamed, TraceLoadOptions{Strict: true})
+		if err != nil {
+			t.Fatalf("%s without extension: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, sampleRequests()) {
+			t.Fatalf("%s without extension: mismatch", name)
+		}
+	}
+}
+
+func TestTraceReadsZstd(t *testing.T) {
+	want, _, err := LoadRequestsWithOptions("testdata/synthetic.jsonl", TraceLoadOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"testdata/synthetic.jsonl.zst", "testdata/synthetic_blocks.jsonl.zst"} {
+		got, _, err := LoadRequestsWithOptions(name, TraceLoadOptions{Strict: true})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: decoded %d requests, want %d", name, len(got), len(want))
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadBoth 分别以严格与宽松模式加载，返回宽松模式的结果与严格模式的错误
+func loadBoth(t *testing.T, path string) ([]*Request, TraceSkipReport, error) {
+	t.Helper()
+	_, _, strictErr := LoadRequestsWithOptions(path, TraceLoadOptions{Strict: true})
+	requests, skipped, err := LoadRequestsWithOptions(path, TraceLoadOptions{})
+	if err != nil {
+		t.Fatalf("lenient load of %s: %v", filepath.Base(path), err)
+	}
+	return requests, skipped, strictErr
+}
+
+func TestJSONLCorruptRecords(t *testing.T) {
+	lines := []string{
+		`{"timestamp":0,"input_length":512,"output_length":1,"hash_ids":[1]}`,
+		`{"timestamp":1,"input_length":512`,
+		`{"timestamp":2,"input_length":512,"output_length":1}`,
+		`{"timestamp":3,"input_length":512,"output_length":1,"hash_ids":[` + strings.Repeat("1,", 100) + `1]}`,
+		`{"timestamp":-4,"input_length":512,"output_length":1,"hash_ids":[1]}`,
+		`{"timestamp":5,"input_length":512,"output_length":1,"hash_ids":[5]}`,
+	}
+	path := writeFile(t, "bad.jsonl", []byte(strings.Join(lines, "\n")))
+
+	_, _, strictErr := LoadRequestsWithOptions(path, TraceLoadOptions{Strict: true, MaxLineBytes: 128})
+	var lineErr *TraceLineError
+	if !errors.As(strictErr, &lineErr) || lineErr.Line != 2 {
+		t.Fatalf("strict load error = %v, want line 2", strictErr)
+	}
+
+	requests, skipped, err := LoadRequestsWithOptions(path, TraceLoadOptions{MaxLineBytes: 128, MaxErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[1].Timestamp != 5 {
+		t.Fatalf("lenient load kept %d requests, want records 1 and 6", len(requests))
+	}
+	if skipped.Count != 4 || len(skipped.Errors) != 2 {
+		t.Fatalf("skipped %d (%d detailed), want 4 (2 detailed)", skipped.Count, len(skipped.Errors))
+	}
+}
+
+func TestCSVCorruptRecords(t *testing.T) {
+	data := "timestamp,input_length,output_length,hash_ids\n" +
+		"0,512,1,1 2\n" +
+		"x,512,1,3\n" +
+		"2,512,1,\n" +
+		"3,512,1,4;5\n"
+	requests, skipped, strictErr := loadBoth(t, writeFile(t, "bad.csv", []byte(data)))
+	if strictErr == nil {
+		t.Fatal("strict load accepted a malformed CSV row")
+	}
+	if len(requests) != 2 || skipped.Count != 2 {
+		t.Fatalf("kept %d requests and skipped %d, want 2 and 2", len(requests), skipped.Count)
+	}
+
+	_, _, err := LoadRequestsWithOptions(writeFile(t, "header.csv", []byte("timestamp,input_length\n0,1\n")), TraceLoadOptions{})
+	if err == nil {
+		t.Fatal("CSV without hash_ids column should fail to open")
+	}
+}
+
+func TestBinaryRowFormatCorruptCount(t *testing.T) {
+	// 14字节的版本4行式记录，block数为超大值：不能按计数直接分配
+	data := append([]byte("K3TB\x04"), 0x00, 0x01, 0x01)
+	data = binary.AppendUvarint(data, 1<<40)
+	path := writeFile(t, "bad.k3tb", data)
+
+	requests, skipped, strictErr := loadBoth(t, path)
+	if strictErr == nil || !strings.Contains(strictErr.Error(), "block count") {
+		t.Fatalf("strict load error = %v, want block count error", strictErr)
+	}
+	if len(requests) != 0 || skipped.Count != 1 {
+		t.Fatalf("lenient load kept %d requests and skipped %d", len(requests), skipped.Count)
+	}
+
+	// 计数在上限内但数据不足：读到结尾即停止
+	data = append([]byte("K3TB\x04"), 0x00, 0x01, 0x01)
+	data = binary.AppendUvarint(data, 1000)
+	if _, _, strictErr = loadBoth(t, writeFile(t, "short.k3tb", data)); !errors.Is(strictErr, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated record: strict error = %v", strictErr)
+	}
+}
+
+// binaryGroups 写出若干行组并返回文件内容与各行组的起始偏移
+func binaryGroups(t *testing.T, groups int) ([]byte, []int) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := NewBinaryTraceWriter(&buf)
+	writer.writeHeader()
+	offsets := make([]int, 0, groups)
+	for g := 0; g < groups; g++ {
+		writer.writer.Flush()
+		offsets = append(offsets, buf.Len())
+		for _, request := range sampleRequests() {
+			if err := writer.Write(request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.flushGroup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), offsets
+}
+
+func TestBinaryColumnarCorruptGroupSkipped(t *testing.T) {
+	data, offsets := binaryGroups(t, 3)
+	if len(offsets) != 3 {
+		t.Fatal("expected three row groups")
+	}
+
+	// 第二个行组的timestamp列长度被破坏为超出行组的值：行组边界仍可信，整组跳过
+	corrupt := append([]byte(nil), data...)
+	rowsLen := binary.PutUvarint(make([]byte, binary.MaxVarintLen64), uint64(len(sampleRequests())))
+	_, sizeLen := binary.Uvarint(corrupt[offsets[1]+rowsLen:])
+	corrupt[offsets[1]+rowsLen+sizeLen] = 0x7f
+	requests, skipped, strictErr := loadBoth(t, writeFile(t, "group.k3tb", corrupt))
+	if strictErr == nil {
+		t.Fatal("strict load accepted a corrupt row group")
+	}
+	if len(requests) != 2*len(sampleRequests()) || skipped.Count != 1 {
+		t.Fatalf("kept %d requests and skipped %d groups, want %d and 1", len(requests), skipped.Count, 2*len(sampleRequests()))
+	}
+	if !reflect.DeepEqual(requests[len(sampleRequests()):], sampleRequests()) {
+		t.Fatal("row group after the corrupt one decoded incorrectly")
+	}
+
+	// 截断在第三个行组中间：前两组保留，随后停止
+	requests, skipped, strictErr = loadBoth(t, writeFile(t, "truncated.k3tb", data[:offsets[2]+5]))
+	if strictErr == nil || len(requests) != 2*len(sampleRequests()) || skipped.Count != 1 {
+		t.Fatalf("truncated file: kept %d, skipped %d, strict error %v", len(requests), skipped.Count, strictErr)
+	}
+
+	// 行组头声明超大行数
+	header := binary.AppendUvarint([]byte("K3TB\x05"), binaryTraceMaxGroupRows+1)
+	header = binary.AppendUvarint(header, 1)
+	if _, _, strictErr = loadBoth(t, writeFile(t, "rows.k3tb", append(header, 0))); strictErr == nil {
+		t.Fatal("oversized row group accepted")
+	}
+}
+
+func TestBinaryColumnarRejectsImpossibleBlockCount(t *testing.T) {
+	// 单行行组，block数远超hash列字节数
+	var data []byte
+	columns := [][]byte{{0}, {1}, {1}, binary.AppendUvarint(nil, 1<<40), {2}, {0}, {0, 0}, {0, 0}, {0, 0}}
+	for _, column := range columns {
+		data = binary.AppendUvarint(data, uint64(len(column)))
+		data = append(data, column...)
+	}
+	file := binary.AppendUvarint([]byte("K3TB\x05"), 1)
+	file = binary.AppendUvarint(file, uint64(len(data)))
+	file = append(file, data...)
+
+	requests, skipped, strictErr := loadBoth(t, writeFile(t, "count.k3tb", file))
+	if strictErr == nil || !strings.Contains(strictErr.Error(), "block count") {
+		t.Fatalf("strict load error = %v, want block count error", strictErr)
+	}
+	if len(requests) != 0 || skipped.Count != 1 {
+		t.Fatalf("lenient load kept %d requests and skipped %d", len(requests), skipped.Count)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ============= 数据加载函数 =============
+
+const defaultMaxLineBytes = 16 << 20 // 默认单行上限16MB（超长prompt的hash_ids可能很长）
+
+// TraceLoadOptions 轨迹加载选项
+type TraceLoadOptions struct {
+	MaxLineBytes int  // 单行最大字节数（0使用默认值16MB）
+	Strict       bool // 严格模式：遇到第一条非法记录即返回错误；宽松模式跳过并记录
+	MaxErrors    int  // 宽松模式下保留的错误明细条数上限（0表示不限，计数不受影响）
+
+	CSVColumns *CSVColumnMapping // CSV列映射（nil使用与JSON字段同名的默认列）
+}
+
+// TraceLineError 带行号的轨迹解析/校验错误
+type TraceLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *TraceLineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *TraceLineError) Unwrap() error {
+	return e.Err
+}
+
+// rawRequest 轨迹记录的JSON结构，指针字段用于区分缺失与零值
+type rawRequest struct {
+	Timestamp    *int   `json:"timestamp"`
+	InputLength  *int   `json:"input_length"`
+	OutputLength *int   `json:"output_length"`
+	HashIDs      *[]int `json:"hash_ids"`
+
+	// 可选字段
+	TenantID  *string `json:"tenant_id"`
+	Priority  *int    `json:"priority"`
+	ModelID   *string `json:"model_id"`
+	SessionID *string `json:"session_id"`
+}
+
+// toRequest 校验必填字段与取值范围并转换为Request
+func (r *rawRequest) toRequest() (*Request, error) {
+	switch {
+	case r.Timestamp == nil:
+		return nil, errors.New("missing field timestamp")
+	case r.InputLength == nil:
+		return nil, errors.New("missing field input_length")
+	case r.OutputLength == nil:
+		return nil, errors.New("missing field output_length")
+	case r.HashIDs == nil:
+		return nil, errors.New("missing field hash_ids")
+	}
+
+	if *r.Timestamp < 0 {
+		return nil, fmt.Errorf("negative timestamp %d", *r.Timestamp)
+	}
+	if *r.InputLength < 0 {
+		return nil, fmt.Errorf("negative input_length %d", *r.InputLength)
+	}
+	if *r.OutputLength < 0 {
+		return nil, fmt.Errorf("negative output_length %d", *r.OutputLength)
+	}
+	if len(*r.HashIDs) == 0 {
+		return nil, errors.New("empty hash_ids")
+	}
+	if r.Priority != nil && *r.Priority < 0 {
+		return nil, fmt.Errorf("negative priority %d", *r.Priority)
+	}
+
+	request := &Request{
+		Timestamp:    *r.Timestamp,
+		InputLength:  *r.InputLength,
+		OutputLength: *r.OutputLength,
+		HashIDs:      *r.HashIDs,
+	}
+	if r.TenantID != nil {
+		request.TenantID = *r.TenantID
+	}
+	if r.Priority != nil {
+		request.Priority = *r.Priority
+	}
+	if r.ModelID != nil {
+		request.ModelID = *r.ModelID
+	}
+	if r.SessionID != nil {
+		request.SessionID = *r.SessionID
+	}
+	return request, nil
+}
+
+// traceErrorLog 按严格/宽松模式处理逐条记录错误，供各格式的读取器复用
+type traceErrorLog struct {
+	opts         TraceLoadOptions
+	skipped      []*TraceLineError
+	skippedCount int
+}
+
+// record 登记第line条记录的错误：严格模式返回错误，宽松模式记录后返回nil
+func (l *traceErrorLog) record(line int, err error) error {
+	lineErr := &TraceLineError{Line: line, Err: err}
+	if l.opts.Strict {
+		return lineErr
+	}
+	l.skippedCount++
+	if l.opts.MaxErrors == 0 || len(l.skipped) < l.opts.MaxErrors {
+		l.skipped = append(l.skipped, lineErr)
+	}
+	return nil
+}
+
+// SkipReport 汇总宽松模式下被跳过的记录
+func (l *traceErrorLog) SkipReport() TraceSkipReport {
+	return TraceSkipReport{Errors: l.skipped, Count: l.skippedCount}
+}
+
+// TraceSkipReport 宽松模式下被跳过的记录：明细受MaxErrors限制，Count为总数
+type TraceSkipReport struct {
+	Errors []*TraceLineError
+	Count  int
+}
+
+// lineReader 按行读取文本轨迹。与bufio.Scanner不同，超长行会被整行丢弃并返回
+// bufio.ErrTooLong，调用方可以把它当作单条非法记录跳过后继续读取
+type lineReader struct {
+	reader       *bufio.Reader
+	maxLineBytes int
+	buf          []byte
+}
+
+func newLineReader(r io.Reader, maxLineBytes int) *lineReader {
+	if maxLineBytes <= 0 {
+		maxLineBytes = defaultMaxLineBytes
+	}
+	return &lineReader{reader: bufio.NewReaderSize(r, 64*1024), maxLineBytes: maxLineBytes}
+}
+
+// Next 返回下一行（不含行尾的\n与\r），读完时返回io.EOF，返回的切片在下次调用前有效
+func (r *lineReader) Next() ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLong := false
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		if !tooLong {
+			r.buf = append(r.buf, chunk...)
+			// 留出行尾\r\n的余量，精确长度在去掉行尾后判断
+			if len(r.buf) > r.maxLineBytes+2 {
+				tooLong = true
+				r.buf = r.buf[:0]
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && len(chunk) == 0 && len(r.buf) == 0 && !tooLong {
+			return nil, io.EOF
+		}
+		break
+	}
+	if tooLong {
+		return nil, fmt.Errorf("%w (limit %d bytes)", bufio.ErrTooLong, r.maxLineBytes)
+	}
+	line := bytes.TrimSuffix(r.buf, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) > r.maxLineBytes {
+		return nil, fmt.Errorf("%w (limit %d bytes)", bufio.ErrTooLong, r.maxLineBytes)
+	}
+	return line, nil
+}
+
+// RequestStream 逐行解码JSONL轨迹的流式迭代器，不会把整个文件读入内存
+type RequestStream struct {
+	traceErrorLog
+	lines *lineReader
+	line  int
+}
+
+func NewRequestStream(r io.Reader, opts TraceLoadOptions) *RequestStream {
+	return &RequestStream{
+		traceErrorLog: traceErrorLog{opts: opts},
+		lines:         newLineReader(r, opts.MaxLineBytes),
+	}
+}
+
+// Next 返回下一条合法请求，读完时返回io.EOF。
+// 严格模式下非法记录（含超长行）返回*TraceLineError；宽松模式下跳过并通过SkipReport查询
+func (s *RequestStream) Next() (*Request, error) {
+	for {
+		data, err := s.lines.Next()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		s.line++
+		if err != nil && !errors.Is(err, bufio.ErrTooLong) {
+			return nil, &TraceLineError{Line: s.line, Err: err}
+		}
+		if err == nil {
+			if len(data) == 0 || isBlank(data) {
+				continue
+			}
+			var request *Request
+			if request, err = decodeRequestLine(data); err == nil {
+				return request, nil
+			}
+		}
+
+		if lineErr := s.record(s.line, err); lineErr != nil {
+			return nil, lineErr
+		}
+	}
+}
+
+// Line 返回最近读取的行号
+func (s *RequestStream) Line() int {
+	return s.line
+}
+
+func decodeRequestLine(data []byte) (*Request, error) {
+	var raw rawRequest
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw.toRequest()
+}
+
+func isBlank(data []byte) bool {
+	for _, b := range data {
+		if b != ' ' && b != '\t' && b != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadRequests 以宽松模式加载轨迹（自动识别格式），非法记录被跳过
+func LoadRequests(filename string) ([]*Request, error) {
+	requests, _, err := LoadRequestsWithOptions(filename, TraceLoadOptions{})
+	return requests, err
+}
+
+// LoadRequestsWithOptions 按选项加载轨迹（自动识别格式），返回请求及宽松模式下跳过的记录
+func LoadRequestsWithOptions(filename string, opts TraceLoadOptions) ([]*Request, TraceSkipReport, error) {
+	trace, err := OpenTrace(filename, opts)
+	if err != nil {
+		return nil, TraceSkipReport{}, err
+	}
+	defer trace.Close()
+
+	requests, err := ReadAllRequests(trace)
+	return requests, trace.SkipReport(), err
+}
+
+// ReadAllRequests 读完整个轨迹流
+func ReadAllRequests(reader TraceReader) ([]*Request, error) {
+	var requests []*Request
+	for {
+		request, err := reader.Next()
+		if err == io.EOF {
+			return requests, nil
+		}
+		if err != nil {
+			return requests, err
+		}
+		requests = append(requests, request)
+	}
+}
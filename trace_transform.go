@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============= 轨迹变换：时间缩放、采样、拼接、热点注入 =============
+//
+// 所有变换都返回新的请求切片，不修改输入请求。
+
+func cloneRequest(r *Request) *Request {
+	clone := *r
+	clone.HashIDs = append([]int{}, r.HashIDs...)
+	return &clone
+}
+
+// sortByTimestamp 按时间戳稳定排序
+func sortByTimestamp(requests []*Request) {
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Timestamp < requests[j].Timestamp
+	})
+}
+
+// ScaleTimestamps 以首个请求为原点将到达间隔缩放为1/factor（factor=2即到达率翻倍）
+func ScaleTimestamps(requests []*Request, factor float64) []*Request {
+	scaled := make([]*Request, len(requests))
+	if len(requests) == 0 {
+		return scaled
+	}
+	origin := requests[0].Timestamp
+	for _, r := range requests {
+		origin = min(origin, r.Timestamp)
+	}
+	for i, r := range requests {
+		scaled[i] = cloneRequest(r)
+		scaled[i].Timestamp = origin + int(float64(r.Timestamp-origin)/factor)
+	}
+	return scaled
+}
+
+// ScaleTimestampsPiecewise 把轨迹时间跨度等分为len(factors)段，第i段的到达率乘以factors[i]，
+// 用于构造负载先升后降的轨迹
+func ScaleTimestampsPiecewise(requests []*Request, factors []float64) []*Request {
+	scaled := make([]*Request, len(requests))
+	if len(requests) == 0 || len(factors) == 0 {
+		return scaled
+	}
+	origin, end := requests[0].Timestamp, requests[0].Timestamp
+	for _, r := range requests {
+		origin = min(origin, r.Timestamp)
+		end = max(end, r.Timestamp)
+	}
+	segment := float64(end-origin) / float64(len(factors))
+	for i, r := range requests {
+		offset, elapsed := float64(r.Timestamp-origin), 0.0
+		for j, factor := range factors {
+			if offset <= segment || j == len(factors)-1 {
+				elapsed += offset / factor
+				break
+			}
+			elapsed += segment / factor
+			offset -= segment
+		}
+		scaled[i] = cloneRequest(r)
+		scaled[i].Timestamp = origin + int(elapsed)
+	}
+	return scaled
+}
+
+// WithTenant 为所有请求标注租户与优先级
+func WithTenant(requests []*Request, tenantID string, priority int) []*Request {
+	tagged := make([]*Request, len(requests))
+	for i, r := range requests {
+		tagged[i] = cloneRequest(r)
+		tagged[i].TenantID = tenantID
+		tagged[i].Priority = priority
+	}
+	return tagged
+}
+
+// AssignModels 按首个block为请求分配模型：同一前缀的请求（同一应用）落在同一模型上，
+// weights为各模型的流量占比
+func AssignModels(requests []*Request, models []string, weights []float64) []*Request {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	assigned := make([]*Request, len(requests))
+	for i, r := range requests {
+		assigned[i] = cloneRequest(r)
+		if len(r.HashIDs) == 0 || len(models) == 0 {
+			continue
+		}
+		h := fnv.New64a()
+		fmt.Fprint(h, r.HashIDs[0])
+		point := float64(h.Sum64()%10000) / 10000 * total
+		for j, w := range weights {
+			if point < w || j == len(models)-1 {
+				assigned[i].ModelID = models[j]
+				break
+			}
+			point -= w
+		}
+	}
+	return assigned
+}
+
+// FillSessionIDs 为缺少SessionID的请求按前缀链延续推断会话（按时间排序的轨迹），已有的会话ID保持不变
+func FillSessionIDs(requests []*Request) []*Request {
+	tracker := NewSessionTracker()
+	filled := make([]*Request, len(requests))
+	for i, r := range requests {
+		filled[i] = cloneRequest(r)
+		filled[i].SessionID = tracker.Key(r)
+	}
+	return filled
+}
+
+// SampleRequests 按比例均匀采样请求
+func SampleRequests(requests []*Request, fraction float64, seed int64) []*Request {
+	rng := rand.New(rand.NewSource(seed))
+	sampled := make([]*Request, 0, int(float64(len(requests))*fraction))
+	for _, r := range requests {
+		if rng.Float64() < fraction {
+			sampled = append(sampled, cloneRequest(r))
+		}
+	}
+	return sampled
+}
+
+// SampleSessions 按会话采样：被抽中会话的全部轮次都保留，避免切断多轮对话的前缀复用
+func SampleSessions(requests []*Request, fraction float64, seed int64) []*Request {
+	rng := rand.New(rand.NewSource(seed))
+	tracker := NewSessionTracker()
+	keep := make(map[string]bool)
+	sampled := make([]*Request, 0, int(float64(len(requests))*fraction))
+	for _, r := range requests {
+		sessionID := tracker.Key(r)
+		kept, decided := keep[sessionID]
+		if !decided {
+			kept = rng.Float64() < fraction
+			keep[sessionID] = kept
+		}
+		if kept {
+			sampled = append(sampled, cloneRequest(r))
+		}
+	}
+	return sampled
+}
+
+// maxHashID 返回请求中最大的hash ID（无请求时返回-1）
+func maxHashID(requests []*Request) int {
+	maxID := -1
+	for _, r := range requests {
+		for _, id := range r.HashIDs {
+			maxID = max(maxID, id)
+		}
+	}
+	return maxID
+}
+
+// MergeTraces 合并多个轨迹：第k个轨迹的hash ID整体平移到前面轨迹之后，避免不同来源的前缀误命中；
+// alignStart为true时各轨迹的起始时间对齐到0
+func MergeTraces(traces [][]*Request, alignStart bool) []*Request {
+	merged := make([]*Request, 0)
+	offset := 0
+	for _, trace := range traces {
+		if len(trace) == 0 {
+			continue
+		}
+		origin := 0
+		if alignStart {
+			origin = trace[0].Timestamp
+			for _, r := range trace {
+				origin = min(origin, r.Timestamp)
+			}
+		}
+		for _, r := range trace {
+			clone := cloneRequest(r)
+			clone.Timestamp -= origin
+			for i := range clone.HashIDs {
+				clone.HashIDs[i] += offset
+			}
+			merged = append(merged, clone)
+		}
+		offset += maxHashID(trace) + 1
+	}
+	sortByTimestamp(merged)
+	return merged
+}
+
+// HotspotBurst 热点突发：一段时间内大量请求共享同一个新前缀
+type HotspotBurst struct {
+	StartMs      int     // 突发开始时间
+	DurationMs   int     // 突发持续时间
+	RatePerSec   float64 // 突发期间额外的到达率
+	PrefixBlocks int     // 共享热点前缀的block数
+	SuffixBlocks int     // 每个请求独有的后缀block数
+	OutputLength int     // 输出长度
+}
+
+// ParseHotspotBurst 解析"start=600s,duration=30s,rate=20,prefix=8,suffix=4,output=128"形式的描述
+func ParseHotspotBurst(spec string) (HotspotBurst, error) {
+	burst := HotspotBurst{DurationMs: 10000, RatePerSec: 10, PrefixBlocks: 8, SuffixBlocks: 2, OutputLength: 128}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return burst, fmt.Errorf("invalid burst field %q", part)
+		}
+		var err error
+		switch key {
+		case "start", "duration":
+			var d time.Duration
+			d, err = time.ParseDuration(value)
+			if key == "start" {
+				burst.StartMs = int(d.Milliseconds())
+			} else {
+				burst.DurationMs = int(d.Milliseconds())
+			}
+		case "rate":
+			burst.RatePerSec, err = strconv.ParseFloat(value, 64)
+		case "prefix":
+			burst.PrefixBlocks, err = strconv.Atoi(value)
+		case "suffix":
+			burst.SuffixBlocks, err = strconv.Atoi(value)
+		case "output":
+			burst.OutputLength, err = strconv.Atoi(value)
+		default:
+			return burst, fmt.Errorf("unknown burst field %q", key)
+		}
+		if err != nil {
+			return burst, fmt.Errorf("burst field %s: %w", key, err)
+		}
+	}
+	if !isPositiveFinite(burst.RatePerSec) {
+		return burst, fmt.Errorf("burst rate must be positive, got %v", burst.RatePerSec)
+	}
+	if burst.StartMs < 0 {
+		return burst, fmt.Errorf("burst start must not be negative, got %dms", burst.StartMs)
+	}
+	if burst.DurationMs <= 0 {
+		return burst, fmt.Errorf("burst duration must be positive, got %dms", burst.DurationMs)
+	}
+	if burst.PrefixBlocks < 0 || burst.SuffixBlocks < 0 {
+		return burst, fmt.Errorf("burst prefix and suffix must not be negative, got %d and %d", burst.PrefixBlocks, burst.SuffixBlocks)
+	}
+	if burst.PrefixBlocks+burst.SuffixBlocks == 0 {
+		return burst, fmt.Errorf("burst needs at least one block")
+	}
+	if burst.OutputLength < 0 {
+		return burst, fmt.Errorf("burst output must not be negative, got %d", burst.OutputLength)
+	}
+	return burst, nil
+}
+
+// InjectHotspotBursts 在指定时间注入热点突发请求，热点前缀与后缀使用轨迹中未出现过的hash ID
+func InjectHotspotBursts(requests []*Request, bursts []HotspotBurst, seed int64) []*Request {
+	rng := rand.New(rand.NewSource(seed))
+	result := make([]*Request, 0, len(requests))
+	for _, r := range requests {
+		result = append(result, cloneRequest(r))
+	}
+
+	nextHashID := maxHashID(requests) + 1
+	allocate := func(n int) []int {
+		ids := make([]int, n)
+		for i := range ids {
+			ids[i] = nextHashID
+			nextHashID++
+		}
+		return ids
+	}
+
+	for _, burst := range bursts {
+		if burst.RatePerSec <= 0 {
+			continue
+		}
+		prefix := allocate(burst.PrefixBlocks)
+		arrival := &PoissonArrival{RatePerSec: burst.RatePerSec}
+		for t := float64(burst.StartMs); t < float64(burst.StartMs+burst.DurationMs); t += arrival.NextInterval(rng) {
+			hashIDs := append(append([]int{}, prefix...), allocate(burst.SuffixBlocks)...)
+			result = append(result, &Request{
+				Timestamp:    int(t),
+				InputLength:  len(hashIDs) * blockTokens,
+				OutputLength: burst.OutputLength,
+				HashIDs:      hashIDs,
+			})
+		}
+	}
+
+	sortByTimestamp(result)
+	return result
+}
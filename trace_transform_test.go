@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHotspotBurstRejectsInvalidFields(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"negative prefix", "start=1s,duration=5s,prefix=-1,suffix=2", "prefix"},
+		{"negative suffix", "start=1s,duration=5s,prefix=2,suffix=-1", "suffix"},
+		{"negative output", "start=1s,duration=5s,output=-5", "output"},
+		{"negative start", "start=-1s,duration=5s", "start"},
+		{"zero duration", "start=1s,duration=0s", "duration"},
+		{"negative duration", "start=1s,duration=-5s", "duration"},
+		{"zero rate", "start=1s,rate=0", "rate"},
+		{"no blocks", "start=1s,prefix=0,suffix=0", "block"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseHotspotBurst(c.spec)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("ParseHotspotBurst(%q) error = %v, want one mentioning %q", c.spec, err, c.want)
+			}
+		})
+	}
+
+	burst, err := ParseHotspotBurst("start=1s,duration=5s,rate=2,prefix=3,suffix=0,output=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if burst.StartMs != 1000 || burst.DurationMs != 5000 || burst.PrefixBlocks != 3 || burst.OutputLength != 0 {
+		t.Fatalf("parsed %+v", burst)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// ============= 合成工作负载生成器 =============
+//
+// 生成与mooncake_trace.jsonl同构的请求流：到达过程（Poisson/MMPP）、
+// Zipf热度的共享system prompt树、多轮会话与输入/输出长度分布均可配置。
+
+// ArrivalProcess 到达过程：返回距下一个请求的间隔（毫秒）
+type ArrivalProcess interface {
+	NextInterval(rng *rand.Rand) float64
+	GetName() string
+}
+
+// isPositiveFinite 到达率、停留时间等参数的合法性：为0时间隔为+Inf，为Inf时间隔为0，均会使时钟失控
+func isPositiveFinite(v float64) bool {
+	return v > 0 && !math.IsInf(v, 1)
+}
+
+// PoissonArrival 泊松到达
+type PoissonArrival struct {
+	RatePerSec float64 // 平均到达率（请求/秒）
+}
+
+func (p *PoissonArrival) NextInterval(rng *rand.Rand) float64 {
+	return rng.ExpFloat64() / p.RatePerSec * 1000
+}
+
+func (p *PoissonArrival) validate() error {
+	if !isPositiveFinite(p.RatePerSec) {
+		return fmt.Errorf("Poisson rate must be positive, got %v", p.RatePerSec)
+	}
+	return nil
+}
+
+func (p *PoissonArrival) GetName() string {
+	return fmt.Sprintf("Poisson(%.1f/s)", p.RatePerSec)
+}
+
+// MMPPArrival 马尔可夫调制泊松过程：在若干到达率状态间切换，模拟突发流量
+type MMPPArrival struct {
+	RatesPerSec []float64 // 各状态的到达率（请求/秒）
+	MeanDwellMs []float64 // 各状态的平均停留时间（毫秒）
+	state       int
+	dwellLeft   float64
+	started     bool
+}
+
+// NewMMPPArrival 校验各状态参数：到达率与停留时间必须为正且一一对应，否则NextInterval可能永不返回
+func NewMMPPArrival(ratesPerSec, meanDwellMs []float64) (*MMPPArrival, error) {
+	m := &MMPPArrival{RatesPerSec: ratesPerSec, MeanDwellMs: meanDwellMs}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MMPPArrival) validate() error {
+	if len(m.RatesPerSec) == 0 {
+		return fmt.Errorf("MMPP needs at least one state")
+	}
+	if len(m.RatesPerSec) != len(m.MeanDwellMs) {
+		return fmt.Errorf("MMPP has %d rates but %d dwell times", len(m.RatesPerSec), len(m.MeanDwellMs))
+	}
+	for i, rate := range m.RatesPerSec {
+		if !isPositiveFinite(rate) {
+			return fmt.Errorf("MMPP state %d: rate must be positive, got %v", i, rate)
+		}
+		if !isPositiveFinite(m.MeanDwellMs[i]) {
+			return fmt.Errorf("MMPP state %d: dwell time must be positive, got %v", i, m.MeanDwellMs[i])
+		}
+	}
+	return nil
+}
+
+func (m *MMPPArrival) NextInterval(rng *rand.Rand) float64 {
+	if !m.started {
+		m.dwellLeft = rng.ExpFloat64() * m.MeanDwellMs[m.state]
+		m.started = true
+	}
+
+	// 指数分布无记忆：跨越状态边界时丢弃剩余部分，在新状态重新抽样
+	elapsed := 0.0
+	for {
+		candidate := rng.ExpFloat64() / m.RatesPerSec[m.state] * 1000
+		if candidate <= m.dwellLeft {
+			m.dwellLeft -= candidate
+			return elapsed + candidate
+		}
+		elapsed += m.dwellLeft
+		m.switchState(rng)
+	}
+}
+
+// switchState 均匀跳转到另一个状态
+func (m *MMPPArrival) switchState(rng *rand.Rand) {
+	if len(m.RatesPerSec) > 1 {
+		next := rng.Intn(len(m.RatesPerSec) - 1)
+		if next >= m.state {
+			next++
+		}
+		m.state = next
+	}
+	m.dwellLeft = rng.ExpFloat64() * m.MeanDwellMs[m.state]
+}
+
+func (m *MMPPArrival) GetName() string {
+	return fmt.Sprintf("MMPP(%v/s)", m.RatesPerSec)
+}
+
+// LengthDistribution token长度分布
+type LengthDistribution interface {
+	Sample(rng *rand.Rand) int
+}
+
+// LogNormalLength 对数正态长度分布，截断到[Min, Max]
+type LogNormalLength struct {
+	Median float64 // 中位数（token）
+	Sigma  float64 // 对数标准差
+	Min    int
+	Max    int
+}
+
+func (l *LogNormalLength) Sample(rng *rand.Rand) int {
+	value := int(math.Round(l.Median * math.Exp(rng.NormFloat64()*l.Sigma)))
+	if value < l.Min {
+		value = l.Min
+	}
+	if l.Max > 0 && value > l.Max {
+		value = l.Max
+	}
+	return value
+}
+
+// WorkloadConfig 合成工作负载配置
+type WorkloadConfig struct {
+	NumRequests int
+	Seed        int64
+	Arrival     ArrivalProcess
+
+	// 共享system prompt树：TreeBranching^TreeDepth个叶子模板，按Zipf热度选择
+	TreeDepth           int     // 树深度（层数）
+	TreeBranching       int     // 每个内部节点的子节点数
+	BlocksPerLevel      int     // 每层前缀占用的block数
+	ZipfS               float64 // Zipf指数（>1，越大越集中）
+	TemplateProbability float64 // 新会话使用共享模板的概率
+
+	// 多轮会话
+	SessionContinueProb float64 // 请求作为已有会话下一轮的概率
+	MaxActiveSessions   int     // 同时活跃的会话上限，超过后最老的会话结束
+	MaxTurns            int     // 单个会话最大轮数
+
+	InputLength     LengthDistribution // 新会话首轮的用户输入长度（不含模板）
+	TurnInputLength LengthDistribution // 后续轮次新增的用户输入长度
+	OutputLength    LengthDistribution // 输出长度
+}
+
+// DefaultWorkloadConfig 近似Mooncake轨迹统计的默认配置（平均输入约7.6k token、输出约180 token、约6.5请求/秒）
+func DefaultWorkloadConfig() WorkloadConfig {
+	return WorkloadConfig{
+		NumRequests:         23608,
+		Seed:                1,
+		Arrival:             &PoissonArrival{RatePerSec: 6.5},
+		TreeDepth:           3,
+		TreeBranching:       4,
+		BlocksPerLevel:      2,
+		ZipfS:               1.2,
+		TemplateProbability: 0.6,
+		SessionContinueProb: 0.3,
+		MaxActiveSessions:   500,
+		MaxTurns:            8,
+		InputLength:         &LogNormalLength{Median: 4000, Sigma: 1.0, Min: 16, Max: 120000},
+		TurnInputLength:     &LogNormalLength{Median: 300, Sigma: 0.8, Min: 8, Max: 8000},
+		OutputLength:        &LogNormalLength{Median: 150, Sigma: 0.7, Min: 1, Max: 2000},
+	}
+}
+
+// genSession 生成器内部的会话状态
+type genSession struct {
+	id           int
+	hashIDs      []int
+	inputLength  int
+	outputLength int
+	turns        int
+}
+
+// WorkloadGenerator 合成请求流，实现TraceReader
+type WorkloadGenerator struct {
+	cfg         WorkloadConfig
+	rng         *rand.Rand
+	clock       float64
+	generated   int
+	nextHashID  int
+	templates   [][]int // 叶子模板的完整前缀（自根向下）
+	zipf        *rand.Zipf
+	sessions    []*genSession
+	nextSession int
+}
+
+func NewWorkloadGenerator(cfg WorkloadConfig) (*WorkloadGenerator, error) {
+	if cfg.Arrival == nil {
+		return nil, fmt.Errorf("workload has no arrival process")
+	}
+	if v, ok := cfg.Arrival.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	g := &WorkloadGenerator{cfg: cfg, rng: rng}
+	g.buildTemplateTree()
+	if len(g.templates) > 1 && cfg.ZipfS > 1 {
+		g.zipf = rand.NewZipf(rng, cfg.ZipfS, 1, uint64(len(g.templates)-1))
+	}
+	return g, nil
+}
+
+// buildTemplateTree 构造共享前缀树：每个树节点拥有BlocksPerLevel个block，叶子路径即模板前缀
+func (g *WorkloadGenerator) buildTemplateTree() {
+	if g.cfg.TreeDepth <= 0 || g.cfg.BlocksPerLevel <= 0 {
+		return
+	}
+	branching := max(g.cfg.TreeBranching, 1)
+
+	var expand func(prefix []int, depth int)
+	expand = func(prefix []int, depth int) {
+		if depth == g.cfg.TreeDepth {
+			g.templates = append(g.templates, prefix)
+			return
+		}
+		// 根节点只有一个（全局共享的system prompt），之后逐层分叉
+		children := branching
+		if depth == 0 {
+			children = 1
+		}
+		for c := 0; c < children; c++ {
+			child := append(append([]int{}, prefix...), g.allocateBlocks(g.cfg.BlocksPerLevel)...)
+			expand(child, depth+1)
+		}
+	}
+	expand(nil, 0)
+}
+
+func (g *WorkloadGenerator) allocateBlocks(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = g.nextHashID
+		g.nextHashID++
+	}
+	return ids
+}
+
+// Next 生成下一个请求，达到NumRequests后返回io.EOF
+func (g *WorkloadGenerator) Next() (*Request, error) {
+	if g.generated >= g.cfg.NumRequests {
+		return nil, io.EOF
+	}
+	if g.generated > 0 {
+		g.clock += g.cfg.Arrival.NextInterval(g.rng)
+	}
+	g.generated++
+
+	var session *genSession
+	if len(g.sessions) > 0 && g.rng.Float64() < g.cfg.SessionContinueProb {
+		idx := g.rng.Intn(len(g.sessions))
+		session = g.sessions[idx]
+		g.continueSession(session)
+		if session.turns >= g.cfg.MaxTurns {
+			g.sessions = append(g.sessions[:idx], g.sessions[idx+1:]...)
+		}
+	} else {
+		session = g.startSession()
+	}
+
+	return &Request{
+		Timestamp:    int(g.clock),
+		InputLength:  session.inputLength,
+		OutputLength: session.outputLength,
+		HashIDs:      append([]int{}, session.hashIDs...),
+		SessionID:    fmt.Sprintf("gen-%d", session.id),
+	}, nil
+}
+
+// startSession 新会话：可选的共享模板前缀 + 新的用户输入
+func (g *WorkloadGenerator) startSession() *genSession {
+	var prefix []int
+	if len(g.templates) > 0 && g.rng.Float64() < g.cfg.TemplateProbability {
+		prefix = g.templates[g.pickTemplate()]
+	}
+
+	userTokens := g.cfg.InputLength.Sample(g.rng)
+	session := &genSession{
+		id:           g.nextSession,
+		hashIDs:      append(append([]int{}, prefix...), g.allocateBlocks(ceilDiv(userTokens, blockTokens))...),
+		inputLength:  len(prefix)*blockTokens + userTokens,
+		outputLength: g.cfg.OutputLength.Sample(g.rng),
+		turns:        1,
+	}
+	g.nextSession++
+
+	if g.cfg.MaxTurns > 1 {
+		if g.cfg.MaxActiveSessions > 0 && len(g.sessions) >= g.cfg.MaxActiveSessions {
+			g.sessions = g.sessions[1:]
+		}
+		g.sessions = append(g.sessions, session)
+	}
+	return session
+}
+
+// continueSession 下一轮：上下文 = 上轮输入 + 上轮输出 + 本轮输入。
+// 上轮完整block的hash保持不变，末尾不完整block因内容追加而得到新hash
+func (g *WorkloadGenerator) continueSession(session *genSession) {
+	keep := min(session.inputLength/blockTokens, len(session.hashIDs))
+	inputLength := session.inputLength + session.outputLength + g.cfg.TurnInputLength.Sample(g.rng)
+	fresh := ceilDiv(inputLength, blockTokens) - keep
+
+	session.hashIDs = append(session.hashIDs[:keep:keep], g.allocateBlocks(fresh)...)
+	session.inputLength = inputLength
+	session.outputLength = g.cfg.OutputLength.Sample(g.rng)
+	session.turns++
+}
+
+func (g *WorkloadGenerator) pickTemplate() int {
+	if g.zipf == nil {
+		return g.rng.Intn(len(g.templates))
+	}
+	return int(g.zipf.Uint64())
+}
+
+// Generate 生成全部请求
+func (g *WorkloadGenerator) Generate() []*Request {
+	requests := make([]*Request, 0, g.cfg.NumRequests)
+	for {
+		request, err := g.Next()
+		if err != nil {
+			return requests
+		}
+		requests = append(requests, request)
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// ============= zstd解压（RFC 8878，仅用标准库） =============
+//
+// 支持普通帧与可跳过帧、Raw/RLE/压缩块、Huffman字面量（含4流与复用表）、
+// FSE序列（预定义/RLE/压缩/复用表）、重复偏移与内容校验和；不支持字典。
+// 按块流式解压，只保留窗口大小的历史，内存与文件大小无关。
+
+const (
+	zstdFrameMagic     = 0xFD2FB528
+	zstdSkippableMagic = 0x184D2A50 // 低4位任意
+	zstdMaxWindowSize  = 1 << 27    // 与zstd默认解压上限（windowLog 27）一致
+	zstdMaxBlockSize   = 128 << 10
+)
+
+var errZstdCorrupt = errors.New("zstd: corrupt input")
+
+// zstdReader 流式zstd解压器
+type zstdReader struct {
+	reader *bufio.Reader
+	frame  *zstdFrame // 当前帧，nil表示需要读取下一帧的帧头
+	out    []byte     // 已解压尚未被读取的数据
+	err    error
+}
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	z := &zstdReader{reader: bufio.NewReader(r)}
+	// 立即解析首个帧头，使格式错误在打开时即可发现
+	if err := z.nextFrame(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.fill()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+func (z *zstdReader) Close() error {
+	z.err = errors.New("zstd: reader closed")
+	return nil
+}
+
+// fill 解压下一个块；帧结束时校验并进入下一帧，输入结束返回io.EOF
+func (z *zstdReader) fill() error {
+	if z.frame == nil {
+		if err := z.nextFrame(); err != nil {
+			return err
+		}
+	}
+	out, last, err := z.frame.decodeBlock(z.reader)
+	if err != nil {
+		return err
+	}
+	z.out = out
+	if last {
+		if err := z.frame.finish(z.reader); err != nil {
+			return err
+		}
+		z.frame = nil
+	}
+	return nil
+}
+
+// nextFrame 跳过可跳过帧，解析下一个普通帧的帧头；没有更多帧时返回io.EOF
+func (z *zstdReader) nextFrame() error {
+	for {
+		var magic [4]byte
+		if _, err := io.ReadFull(z.reader, magic[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return errZstdCorrupt
+			}
+			return err
+		}
+		value := binary.LittleEndian.Uint32(magic[:])
+		if value&0xFFFFFFF0 == zstdSkippableMagic {
+			var size [4]byte
+			if _, err := io.ReadFull(z.reader, size[:]); err != nil {
+				return errZstdCorrupt
+			}
+			if _, err := z.reader.Discard(int(binary.LittleEndian.Uint32(size[:]))); err != nil {
+				return errZstdCorrupt
+			}
+			continue
+		}
+		if value != zstdFrameMagic {
+			return fmt.Errorf("zstd: invalid frame magic %#x", value)
+		}
+		frame, err := readZstdFrameHeader(z.reader)
+		if err != nil {
+			return err
+		}
+		z.frame = frame
+		return nil
+	}
+}
+
+// ============= 帧 =============
+
+type zstdFrame struct {
+	windowSize  int
+	contentSize int64 // -1表示帧头未给出
+	checksum    bool
+	decoded     int64
+	hash        *xxHash64
+
+	history []byte // 已解压数据（至少保留windowSize字节供匹配引用）
+	block   []byte // 压缩块读取缓冲
+
+	// 跨块复用的状态
+	repeat   [3]int
+	huffman  *zstdHuffmanTable
+	llTable  *zstdFSETable
+	ofTable  *zstdFSETable
+	mlTable  *zstdFSETable
+	literals []byte
+}
+
+func readZstdFrameHeader(r *bufio.Reader) (*zstdFrame, error) {
+	descriptor, err := r.ReadByte()
+	if err != nil {
+		return nil, errZstdCorrupt
+	}
+	fcsFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	if descriptor&0x08 != 0 {
+		return nil, errors.New("zstd: reserved frame header bit set")
+	}
+	frame := &zstdFrame{checksum: descriptor&0x04 != 0, contentSize: -1, repeat: [3]int{1, 4, 8}}
+
+	if !singleSegment {
+		windowDescriptor, err := r.ReadByte()
+		if err != nil {
+			return nil, errZstdCorrupt
+		}
+		windowLog := 10 + uint(windowDescriptor>>3)
+		if windowLog > 30 {
+			return nil, fmt.Errorf("zstd: window log %d too large", windowLog)
+		}
+		base := 1 << windowLog
+		frame.windowSize = base + base/8*int(windowDescriptor&7)
+	}
+
+	if dictSize := []int{0, 1, 2, 4}[descriptor&3]; dictSize > 0 {
+		var dict [4]byte
+		if _, err := io.ReadFull(r, dict[:dictSize]); err != nil {
+			return nil, errZstdCorrupt
+		}
+		if binary.LittleEndian.Uint32(dict[:]) != 0 {
+			return nil, errors.New("zstd: dictionaries are not supported")
+		}
+	}
+
+	fcsSize := []int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	if fcsSize > 0 {
+		var fcs [8]byte
+		if _, err := io.ReadFull(r, fcs[:fcsSize]); err != nil {
+			return nil, errZstdCorrupt
+		}
+		frame.contentSize = int64(binary.LittleEndian.Uint64(fcs[:]))
+		if fcsSize == 2 {
+			frame.contentSize += 256
+		}
+		if frame.contentSize < 0 {
+			return nil, errZstdCorrupt
+		}
+	}
+	if singleSegment {
+		if frame.contentSize > zstdMaxWindowSize {
+			return nil, fmt.Errorf("zstd: window size %d exceeds limit", frame.contentSize)
+		}
+		frame.windowSize = int(frame.contentSize)
+	}
+	if frame.windowSize > zstdMaxWindowSize {
+		return nil, fmt.Errorf("zstd: window size %d exceeds limit", frame.windowSize)
+	}
+	if frame.checksum {
+		frame.hash = newXXHash64()
+	}
+	return frame, nil
+}
+
+// decodeBlock 解压一个块，返回新产生的数据（在下次调用前有效）与是否为帧内最后一块
+func (f *zstdFrame) decodeBlock(r *bufio.Reader) ([]byte, bool, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, false, errZstdCorrupt
+	}
+	value := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	last := value&1 != 0
+	blockType := (value >> 1) & 3
+	size := value >> 3
+
+	maxBlock := min(max(f.windowSize, 1), zstdMaxBlockSize)
+	if blockType != 1 && size > maxBlock {
+		return nil, false, errZstdCorrupt
+	}
+	f.trimHistory()
+	start := len(f.history)
+
+	switch blockType {
+	case 0: // Raw
+		f.history = append(f.history, make([]byte, size)...)
+		if _, err := io.ReadFull(r, f.history[start:]); err != nil {
+			return nil, false, errZstdCorrupt
+		}
+	case 1: // RLE
+		if size > maxBlock {
+			return nil, false, errZstdCorrupt
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, false, errZstdCorrupt
+		}
+		for i := 0; i < size; i++ {
+			f.history = append(f.history, b)
+		}
+	case 2: // Compressed
+		if cap(f.block) < size {
+			f.block = make([]byte, size)
+		}
+		f.block = f.block[:size]
+		if _, err := io.ReadFull(r, f.block); err != nil {
+			return nil, false, errZstdCorrupt
+		}
+		if err := f.decodeCompressed(f.block); err != nil {
+			return nil, false, err
+		}
+		if len(f.history)-start > zstdMaxBlockSize {
+			return nil, false, errZstdCorrupt
+		}
+	default:
+		return nil, false, errZstdCorrupt
+	}
+
+	out := f.history[start:]
+	f.decoded += int64(len(out))
+	if f.contentSize >= 0 && f.decoded > f.contentSize {
+		return nil, false, errors.New("zstd: frame content larger than declared size")
+	}
+	if f.hash != nil {
+		f.hash.Write(out)
+	}
+	return out, last, nil
+}
+
+// trimHistory 历史超过两倍窗口时只保留最近windowSize字节
+func (f *zstdFrame) trimHistory() {
+	keep := max(f.windowSize, zstdMaxBlockSize)
+	if len(f.history) > 2*keep {
+		n := copy(f.history, f.history[len(f.history)-keep:])
+		f.history = f.history[:n]
+	}
+}
+
+// finish 帧结束：核对声明的内容大小与校验和
+func (f *zstdFrame) finish(r *bufio.Reader) error {
+	if f.contentSize >= 0 && f.decoded != f.contentSize {
+		return errors.New("zstd: frame content size mismatch")
+	}
+	if !f.checksum {
+		return nil
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return errZstdCorrupt
+	}
+	if uint32(f.hash.Sum64()) != binary.LittleEndian.Uint32(sum[:]) {
+		return errors.New("zstd: checksum mismatch")
+	}
+	return nil
+}
+
+// ============= 压缩块 =============
+
+func (f *zstdFrame) decodeCompressed(data []byte) error {
+	consumed, err := f.decodeLiterals(data)
+	if err != nil {
+		return err
+	}
+	return f.decodeSequences(data[consumed:])
+}
+
+// decodeLiterals 解析字面量段到f.literals，返回消耗的字节数
+func (f *zstdFrame) decodeLiterals(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, errZstdCorrupt
+	}
+	literalsType := data[0] & 3
+	sizeFormat := (data[0] >> 2) & 3
+
+	if literalsType <= 1 { // Raw / RLE
+		var size, headerSize int
+		switch sizeFormat {
+		case 0, 2:
+			size, headerSize = int(data[0]>>3), 1
+		case 1:
+			if len(data) < 2 {
+				return 0, errZstdCorrupt
+			}
+			size, headerSize = int(data[0]>>4)|int(data[1])<<4, 2
+		case 3:
+			if len(data) < 3 {
+				return 0, errZstdCorrupt
+			}
+			size, headerSize = int(data[0]>>4)|int(data[1])<<4|int(data[2])<<12, 3
+		}
+		if size > zstdMaxBlockSize {
+			return 0, errZstdCorrupt
+		}
+		if literalsType == 0 {
+			if len(data) < headerSize+size {
+				return 0, errZstdCorrupt
+			}
+			f.literals = append(f.literals[:0], data[headerSize:headerSize+size]...)
+			return headerSize + size, nil
+		}
+		if len(data) < headerSize+1 {
+			return 0, errZstdCorrupt
+		}
+		f.literals = f.literals[:0]
+		for i := 0; i < size; i++ {
+			f.literals = append(f.literals, data[headerSize])
+		}
+		return headerSize + 1, nil
+	}
+
+	// Compressed / Treeless
+	var regenerated, compressed, headerSize int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(data) < 3 {
+			return 0, errZstdCorrupt
+		}
+		v := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+		regenerated, compressed, headerSize = (v>>4)&0x3FF, (v>>14)&0x3FF, 3
+		if sizeFormat == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(data) < 4 {
+			return 0, errZstdCorrupt
+		}
+		v := int(binary.LittleEndian.Uint32(data))
+		regenerated, compressed, headerSize = (v>>4)&0x3FFF, (v>>18)&0x3FFF, 4
+	case 3:
+		if len(data) < 5 {
+			return 0, errZstdCorrupt
+		}
+		v := int(binary.LittleEndian.Uint32(data)) | int(data[4])<<32
+		regenerated, compressed, headerSize = (v>>4)&0x3FFFF, (v>>22)&0x3FFFF, 5
+	}
+	if regenerated > zstdMaxBlockSize || len(data) < headerSize+compressed {
+		return 0, errZstdCorrupt
+	}
+	payload := data[headerSize : headerSize+compressed]
+
+	if literalsType == 2 {
+		table, n, err := readZstdHuffmanTable(payload)
+		if err != nil {
+			return 0, err
+		}
+		f.huffman = table
+		payload = payload[n:]
+	} else if f.huffman == nil {
+		return 0, errZstdCorrupt
+	}
+
+	if cap(f.literals) < regenerated {
+		f.literals = make([]byte, regenerated)
+	}
+	f.literals = f.literals[:regenerated]
+	if streams == 1 {
+		if err := f.huffman.decode(payload, f.literals); err != nil {
+			return 0, err
+		}
+		return headerSize + compressed, nil
+	}
+
+	if len(payload) < 6 {
+		return 0, errZstdCorrupt
+	}
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(payload)),
+		int(binary.LittleEndian.Uint16(payload[2:])),
+		int(binary.LittleEndian.Uint16(payload[4:])),
+	}
+	sizes[3] = len(payload) - 6 - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return 0, errZstdCorrupt
+	}
+	segment := (regenerated + 3) / 4
+	if 3*segment > regenerated {
+		return 0, errZstdCorrupt
+	}
+	payload = payload[6:]
+	for i, size := range sizes {
+		out := f.literals[i*segment:]
+		if i < 3 {
+			out = out[:segment]
+		}
+		if err := f.huffman.decode(payload[:size], out); err != nil {
+			return 0, err
+		}
+		payload = payload[size:]
+	}
+	return headerSize + compressed, nil
+}
+
+// ============= 序列 =============
+
+var (
+	zstdLLBaseline = [36]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536}
+	zstdLLBits = [36]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	zstdMLBaseline = [53]uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	zstdMLBits = [53]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	zstdLLDefault = mustZstdFSETable([]int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}, 6)
+	zstdMLDefault = mustZstdFSETable([]int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1, -1, -1, -1}, 6)
+	zstdOFDefault = mustZstdFSETable([]int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+func (f *zstdFrame) decodeSequences(data []byte) error {
+	if len(data) == 0 {
+		return errZstdCorrupt
+	}
+	count := int(data[0])
+	switch {
+	case count == 0:
+		f.history = append(f.history, f.literals...)
+		return nil
+	case count < 128:
+		data = data[1:]
+	case count < 255:
+		if len(data) < 2 {
+			return errZstdCorrupt
+		}
+		count = (count-128)<<8 + int(data[1])
+		data = data[2:]
+	default:
+		if len(data) < 3 {
+			return errZstdCorrupt
+		}
+		count = int(data[1]) + int(data[2])<<8 + 0x7F00
+		data = data[3:]
+	}
+
+	if len(data) == 0 {
+		return errZstdCorrupt
+	}
+	modes := data[0]
+	if modes&3 != 0 {
+		return errZstdCorrupt
+	}
+	data = data[1:]
+	var err error
+	if f.llTable, data, err = selectZstdFSETable(modes>>6, data, f.llTable, zstdLLDefault, 35, 9); err != nil {
+		return err
+	}
+	if f.ofTable, data, err = selectZstdFSETable((modes>>4)&3, data, f.ofTable, zstdOFDefault, 31, 8); err != nil {
+		return err
+	}
+	if f.mlTable, data, err = selectZstdFSETable((modes>>2)&3, data, f.mlTable, zstdMLDefault, 52, 9); err != nil {
+		return err
+	}
+
+	br, err := newZstdBackwardBits(data)
+	if err != nil {
+		return err
+	}
+	llState := br.read(f.llTable.log)
+	ofState := br.read(f.ofTable.log)
+	mlState := br.read(f.mlTable.log)
+
+	literals := f.literals
+	for i := 0; i < count; i++ {
+		llEntry := f.llTable.entries[llState]
+		ofEntry := f.ofTable.entries[ofState]
+		mlEntry := f.mlTable.entries[mlState]
+		if llEntry.symbol > 35 || mlEntry.symbol > 52 || ofEntry.symbol > 31 {
+			return errZstdCorrupt
+		}
+
+		offsetValue := 1<<ofEntry.symbol + int(br.read(uint(ofEntry.symbol)))
+		matchLength := int(zstdMLBaseline[mlEntry.symbol]) + int(br.read(uint(zstdMLBits[mlEntry.symbol])))
+		literalLength := int(zstdLLBaseline[llEntry.symbol]) + int(br.read(uint(zstdLLBits[llEntry.symbol])))
+
+		offset, err := f.resolveOffset(offsetValue, literalLength)
+		if err != nil {
+			return err
+		}
+
+		if literalLength > len(literals) {
+			return errZstdCorrupt
+		}
+		f.history = append(f.history, literals[:literalLength]...)
+		literals = literals[literalLength:]
+
+		if offset > len(f.history) {
+			return errZstdCorrupt
+		}
+		start := len(f.history) - offset
+		if offset >= matchLength {
+			f.history = append(f.history, f.history[start:start+matchLength]...)
+		} else {
+			// 重叠匹配（如游程）需逐字节复制
+			for j := 0; j < matchLength; j++ {
+				f.history = append(f.history, f.history[start+j])
+			}
+		}
+
+		if i < count-1 {
+			llState = int(llEntry.baseline) + int(br.read(uint(llEntry.bits)))
+			mlState = int(mlEntry.baseline) + int(br.read(uint(mlEntry.bits)))
+			ofState = int(ofEntry.baseline) + int(br.read(uint(ofEntry.bits)))
+		}
+	}
+	if br.remaining != 0 {
+		return errZstdCorrupt
+	}
+	f.history = append(f.history, literals...)
+	return nil
+}
+
+// resolveOffset 把Offset_Value换算为实际偏移并更新重复偏移
+func (f *zstdFrame) resolveOffset(value, literalLength int) (int, error) {
+	if value > 3 {
+		offset := value - 3
+		f.repeat = [3]int{offset, f.repeat[0], f.repeat[1]}
+		return offset, nil
+	}
+	if literalLength == 0 {
+		value++
+	}
+	var offset int
+	switch value {
+	case 1:
+		offset = f.repeat[0]
+	case 2:
+		offset = f.repeat[1]
+		f.repeat = [3]int{offset, f.repeat[0], f.repeat[2]}
+	case 3:
+		offset = f.repeat[2]
+		f.repeat = [3]int{offset, f.repeat[0], f.repeat[1]}
+	default:
+		offset = f.repeat[0] - 1
+		f.repeat = [3]int{offset, f.repeat[0], f.repeat[1]}
+	}
+	if offset <= 0 {
+		return 0, errZstdCorrupt
+	}
+	return offset, nil
+}
+
+// selectZstdFSETable 按压缩模式选择序列码表，返回剩余数据
+func selectZstdFSETable(mode byte, data []byte, previous, predefined *zstdFSETable, maxSymbol, maxLog int) (*zstdFSETable, []byte, error) {
+	switch mode {
+	case 0:
+		return predefined, data, nil
+	case 1:
+		if len(data) == 0 {
+			return nil, nil, errZstdCorrupt
+		}
+		return &zstdFSETable{entries: []zstdFSEEntry{{symbol: data[0]}}}, data[1:], nil
+	case 2:
+		counts, log, n, err := readZstdFSECounts(data, maxSymbol, maxLog)
+		if err != nil {
+			return nil, nil, err
+		}
+		table, err := newZstdFSETable(counts, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		return table, data[n:], nil
+	default:
+		if previous == nil {
+			return nil, nil, errZstdCorrupt
+		}
+		return previous, data, nil
+	}
+}
+
+// ============= FSE =============
+
+type zstdFSEEntry struct {
+	symbol   uint8
+	bits     uint8
+	baseline uint16
+}
+
+type zstdFSETable struct {
+	log     uint
+	entries []zstdFSEEntry
+}
+
+func mustZstdFSETable(counts []int16, log uint) *zstdFSETable {
+	table, err := newZstdFSETable(counts, log)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// newZstdFSETable 由归一化频率构建FSE解码表（-1表示"小于1"的概率）
+func newZstdFSETable(counts []int16, log uint) (*zstdFSETable, error) {
+	size := 1 << log
+	entries := make([]zstdFSEEntry, size)
+	next := make([]int, len(counts))
+	high := size - 1
+	for symbol, count := range counts {
+		if count == -1 {
+			if high < 0 {
+				return nil, errZstdCorrupt
+			}
+			entries[high].symbol = uint8(symbol)
+			high--
+			next[symbol] = 1
+		} else {
+			next[symbol] = int(count)
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	position := 0
+	for symbol, count := range counts {
+		for i := 0; i < int(count); i++ {
+			entries[position].symbol = uint8(symbol)
+			position = (position + step) & mask
+			for position > high {
+				position = (position + step) & mask
+			}
+		}
+	}
+	if position != 0 {
+		return nil, errZstdCorrupt
+	}
+
+	for i := range entries {
+		symbol := entries[i].symbol
+		state := next[symbol]
+		next[symbol]++
+		if state <= 0 {
+			return nil, errZstdCorrupt
+		}
+		nbBits := log - uint(bits.Len(uint(state))-1)
+		entries[i].bits = uint8(nbBits)
+		entries[i].baseline = uint16(state<<nbBits - size)
+	}
+	return &zstdFSETable{log: log, entries: entries}, nil
+}
+
+// readZstdFSECounts 解析FSE表描述，返回归一化频率、精度与消耗的字节数
+func readZstdFSECounts(data []byte, maxSymbol, maxLog int) ([]int16, uint, int, error) {
+	br := zstdForwardBits{data: data}
+	log := uint(br.read(4)) + 5
+	if int(log) > maxLog {
+		return nil, 0, 0, errZstdCorrupt
+	}
+
+	counts := make([]int16, 0, maxSymbol+1)
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	nbBits := log + 1
+	for remaining > 1 {
+		if len(counts) > maxSymbol {
+			return nil, 0, 0, errZstdCorrupt
+		}
+		maxValue := 2*threshold - 1 - remaining
+		var value int
+		if low := int(br.peek(nbBits - 1)); low < maxValue {
+			value = low
+			br.skip(nbBits - 1)
+		} else {
+			value = int(br.peek(nbBits))
+			if value >= threshold {
+				value -= maxValue
+			}
+			br.skip(nbBits)
+		}
+		count := value - 1
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		counts = append(counts, int16(count))
+
+		if count == 0 {
+			for {
+				repeat := int(br.read(2))
+				for i := 0; i < repeat; i++ {
+					counts = append(counts, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+			if len(counts) > maxSymbol+1 {
+				return nil, 0, 0, errZstdCorrupt
+			}
+		}
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+		if br.overflow() {
+			return nil, 0, 0, errZstdCorrupt
+		}
+	}
+	if remaining != 1 {
+		return nil, 0, 0, errZstdCorrupt
+	}
+	return counts, log, br.bytesConsumed(), nil
+}
+
+// ============= Huffman =============
+
+type zstdHuffmanEntry struct {
+	symbol uint8
+	bits   uint8
+}
+
+type zstdHuffmanTable struct {
+	maxBits uint
+	entries []zstdHuffmanEntry
+}
+
+// readZstdHuffmanTable 解析Huffman树描述（直接4位权重或FSE压缩权重），返回表与消耗的字节数
+func readZstdHuffmanTable(data []byte) (*zstdHuffmanTable, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	header := int(data[0])
+	var weights []uint8
+	consumed := 0
+	if header >= 128 {
+		count := header - 127
+		consumed = 1 + (count+1)/2
+		if len(data) < consumed {
+			return nil, 0, errZstdCorrupt
+		}
+		weights = make([]uint8, count)
+		for i := range weights {
+			b := data[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 15
+			}
+		}
+	} else {
+		consumed = 1 + header
+		if len(data) < consumed {
+			return nil, 0, errZstdCorrupt
+		}
+		var err error
+		if weights, err = decodeZstdHuffmanWeights(data[1:consumed]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// 末尾权重由其余权重推出：总和补齐到2的幂
+	total := 0
+	for _, w := range weights {
+		if w > 11 {
+			return nil, 0, errZstdCorrupt
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 || len(weights) > 255 {
+		return nil, 0, errZstdCorrupt
+	}
+	maxBits := uint(bits.Len(uint(total)))
+	rest := 1<<maxBits - total
+	if maxBits > 11 || rest&(rest-1) != 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+
+	table := &zstdHuffmanTable{maxBits: maxBits, entries: make([]zstdHuffmanEntry, 1<<maxBits)}
+	position := 0
+	for w := uint8(1); w <= uint8(maxBits); w++ {
+		span := 1 << (w - 1)
+		for symbol, weight := range weights {
+			if weight != w {
+				continue
+			}
+			entry := zstdHuffmanEntry{symbol: uint8(symbol), bits: uint8(maxBits + 1 - uint(w))}
+			for i := 0; i < span; i++ {
+				table.entries[position+i] = entry
+			}
+			position += span
+		}
+	}
+	if position != len(table.entries) {
+		return nil, 0, errZstdCorrupt
+	}
+	return table, consumed, nil
+}
+
+// decodeZstdHuffmanWeights 用两个交替状态解码FSE压缩的权重
+func decodeZstdHuffmanWeights(data []byte) ([]uint8, error) {
+	counts, log, n, err := readZstdFSECounts(data, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	table, err := newZstdFSETable(counts, log)
+	if err != nil {
+		return nil, err
+	}
+	br, err := newZstdBackwardBits(data[n:])
+	if err != nil {
+		return nil, err
+	}
+
+	states := [2]int{br.read(log), br.read(log)}
+	weights := make([]uint8, 0, 255)
+	for current := 0; ; current ^= 1 {
+		entry := table.entries[states[current]]
+		weights = append(weights, entry.symbol)
+		states[current] = int(entry.baseline) + br.read(uint(entry.bits))
+		if br.remaining < 0 {
+			weights = append(weights, table.entries[states[current^1]].symbol)
+			break
+		}
+		if len(weights) > 255 {
+			return nil, errZstdCorrupt
+		}
+	}
+	if len(weights) > 255 {
+		return nil, errZstdCorrupt
+	}
+	return weights, nil
+}
+
+// decode 解码一个Huffman流，恰好填满out
+func (t *zstdHuffmanTable) decode(data []byte, out []byte) error {
+	br, err := newZstdBackwardBits(data)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		entry := t.entries[br.peek(t.maxBits)]
+		out[i] = entry.symbol
+		br.remaining -= int(entry.bits)
+	}
+	if br.remaining != 0 {
+		return errZstdCorrupt
+	}
+	return nil
+}
+
+// ============= 位流 =============
+
+// zstdForwardBits 小端顺序读取的位流（FSE表描述）
+type zstdForwardBits struct {
+	data []byte
+	pos  uint // 已消耗的位数
+}
+
+func (b *zstdForwardBits) peek(n uint) uint64 {
+	return extractZstdBits(b.data, int(b.pos), n)
+}
+
+func (b *zstdForwardBits) skip(n uint) {
+	b.pos += n
+}
+
+func (b *zstdForwardBits) read(n uint) uint64 {
+	v := b.peek(n)
+	b.pos += n
+	return v
+}
+
+func (b *zstdForwardBits) overflow() bool {
+	return int(b.pos) > 8*len(b.data)
+}
+
+func (b *zstdForwardBits) bytesConsumed() int {
+	return int(b.pos+7) / 8
+}
+
+// zstdBackwardBits 从末尾向前读取的位流（Huffman与序列），末字节最高的1位为起始标记。
+// 越过开头的位按0补齐，remaining变为负数表示读取越界
+type zstdBackwardBits struct {
+	data      []byte
+	remaining int
+}
+
+func newZstdBackwardBits(data []byte) (*zstdBackwardBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errZstdCorrupt
+	}
+	remaining := 8*len(data) - 8 + bits.Len8(data[len(data)-1]) - 1
+	return &zstdBackwardBits{data: data, remaining: remaining}, nil
+}
+
+func (b *zstdBackwardBits) peek(n uint) int {
+	start := b.remaining - int(n)
+	if start >= 0 {
+		return int(extractZstdBits(b.data, start, n))
+	}
+	if b.remaining <= 0 {
+		return 0
+	}
+	return int(extractZstdBits(b.data, 0, uint(b.remaining))) << uint(-start)
+}
+
+func (b *zstdBackwardBits) read(n uint) int {
+	if n == 0 {
+		return 0
+	}
+	v := b.peek(n)
+	b.remaining -= int(n)
+	return v
+}
+
+// extractZstdBits 取data中从第start位起的n位（n<=56），超出末尾的位为0
+func extractZstdBits(data []byte, start int, n uint) uint64 {
+	if n == 0 {
+		return 0
+	}
+	index := start >> 3
+	var word uint64
+	for i := 0; i < 8 && index+i < len(data); i++ {
+		word |= uint64(data[index+i]) << (8 * i)
+	}
+	return (word >> uint(start&7)) & (1<<n - 1)
+}
+
+// ============= XXH64（内容校验和） =============
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxHash64 种子为0的流式XXH64
+type xxHash64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int
+}
+
+func newXXHash64() *xxHash64 {
+	p1, p2 := xxPrime1, xxPrime2 // 按uint64回绕相加（常量表达式会溢出报错）
+	return &xxHash64{v: [4]uint64{p1 + p2, p2, 0, -p1}}
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMerge(acc, v uint64) uint64 {
+	acc ^= xxRound(0, v)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (h *xxHash64) Write(p []byte) {
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		k := copy(h.buf[h.n:], p)
+		h.n += k
+		p = p[k:]
+		if h.n < 32 {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for len(p) >= 32 {
+		h.stripe(p[:32])
+		p = p[32:]
+	}
+	h.n = copy(h.buf[:], p)
+}
+
+func (h *xxHash64) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxRound(h.v[i], binary.LittleEndian.Uint64(p[8*i:]))
+	}
+}
+
+func (h *xxHash64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = xxMerge(acc, v)
+		}
+	} else {
+		acc = h.v[2] + xxPrime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxPrime1
+	}
+	acc ^= acc >> 33
+	acc *= xxPrime2
+	acc ^= acc >> 29
+	acc *= xxPrime3
+	acc ^= acc >> 32
+	return acc
+}
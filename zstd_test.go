@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func readZstd(data []byte) ([]byte, error) {
+	r, err := newZstdReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func zstdFixture(t *testing.T) (compressed, plain []byte) {
+	t.Helper()
+	compressed, err := os.ReadFile("testdata/synthetic_blocks.jsonl.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err = os.ReadFile("testdata/synthetic.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compressed, plain
+}
+
+func TestZstdConcatenatedAndSkippableFrames(t *testing.T) {
+	compressed, plain := zstdFixture(t)
+
+	skippable := binary.LittleEndian.AppendUint32(nil, zstdSkippableMagic|3)
+	skippable = binary.LittleEndian.AppendUint32(skippable, 5)
+	skippable = append(skippable, "hello"...)
+
+	var input []byte
+	input = append(input, skippable...)
+	input = append(input, compressed...)
+	input = append(input, skippable...)
+	input = append(input, compressed...)
+
+	got, err := readZstd(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte(nil), plain...), plain...); !bytes.Equal(got, want) {
+		t.Fatalf("decoded %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestZstdRawAndRLEBlocks(t *testing.T) {
+	// 单段帧（内容大小1字节编码），一个Raw块与一个RLE块
+	frame := binary.LittleEndian.AppendUint32(nil, zstdFrameMagic)
+	frame = append(frame, 0x20, 8)
+	frame = append(frame, 3<<3|0<<1, 0, 0)
+	frame = append(frame, "abc"...)
+	frame = append(frame, 5<<3|1<<1|1, 0, 0, 'z')
+
+	got, err := readZstd(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abczzzzz" {
+		t.Fatalf("decoded %q", got)
+	}
+
+	// 声明的内容大小与实际不符
+	frame[5] = 9
+	if _, err := readZstd(frame); err == nil {
+		t.Fatal("content size mismatch not detected")
+	}
+}
+
+func TestZstdChecksumMismatch(t *testing.T) {
+	compressed, _ := zstdFixture(t)
+	corrupt := append([]byte(nil), compressed...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := readZstd(corrupt); err == nil {
+		t.Fatal("checksum mismatch not detected")
+	}
+}
+
+func TestZstdCorruptInputDoesNotPanic(t *testing.T) {
+	compressed, _ := zstdFixture(t)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		corrupt := append([]byte(nil), compressed...)
+		for flips := 1 + rng.Intn(4); flips > 0; flips-- {
+			corrupt[rng.Intn(len(corrupt))] ^= byte(1 + rng.Intn(255))
+		}
+		if rng.Intn(4) == 0 {
+			corrupt = corrupt[:rng.Intn(len(corrupt))]
+		}
+		// 损坏的输入应返回错误（个别翻转可能恰好落在不影响结果的位置）
+		readZstd(corrupt)
+	}
+
+	if _, err := readZstd(compressed[:len(compressed)/2]); err == nil {
+		t.Fatal("truncated frame not detected")
+	}
+	if _, err := readZstd([]byte{1, 2, 3, 4, 5}); err == nil {
+		t.Fatal("invalid magic accepted")
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	} {
+		h := newXXHash64()
+		h.Write([]byte(tc.input))
+		if got := h.Sum64(); got != tc.want {
+			t.Errorf("XXH64(%q) = %#x, want %#x", tc.input, got, tc.want)
+		}
+	}
+}